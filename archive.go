@@ -0,0 +1,267 @@
+package go3dm
+
+import (
+    "archive/zip"
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "fmt"
+    "image"
+    "io"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+)
+
+func init() {
+    RegisterFormat(&Format{Name: "zip", Extensions: []string{".zip"},
+        Sniff: func(header []byte) bool {
+            return bytes.HasPrefix(header, []byte("PK\x03\x04"))
+        },
+        Load: loadZip,
+    })
+}
+
+// Decompressor returns a reader for the decompressed contents of r.
+type Decompressor func(r io.Reader) (io.ReadCloser, error)
+
+type decompressorEntry struct {
+    ext string
+    magic string
+    decompressor Decompressor
+}
+
+var decompressors = struct {
+    sync.RWMutex
+    list []decompressorEntry
+}{list: []decompressorEntry{
+    {".gz", "\x1f\x8b", func(r io.Reader) (io.ReadCloser, error) {
+        return gzip.NewReader(r)
+    }},
+}}
+
+// RegisterDecompressor registers a decompressor for files starting with
+// magic, so that model files compressed with it are loaded transparently.
+// ext is the extension of compressed files, e.g. ".zst", which is ignored
+// when the model format is chosen by extension. gzip is supported by
+// default; zstd can be added with a third-party decoder:
+//
+//   go3dm.RegisterDecompressor(".zst", "\x28\xb5\x2f\xfd",
+//       func(r io.Reader) (io.ReadCloser, error) {
+//           d, err := zstd.NewReader(r)
+//           if err != nil { return nil, err }
+//           return d.IOReadCloser(), nil
+//       })
+func RegisterDecompressor(ext, magic string, decompressor Decompressor) {
+    decompressors.Lock()
+    defer decompressors.Unlock()
+    decompressors.list = append([]decompressorEntry{
+        {strings.ToLower(ext), magic, decompressor}}, decompressors.list...)
+}
+
+// readCloser closes both the decompressing reader and the file.
+type readCloser struct {
+    io.Reader
+    closers []io.Closer
+}
+
+func (rc *readCloser) Close() error {
+    var err error
+    for _, c := range rc.closers {
+        if cerr := c.Close(); err == nil { err = cerr }
+    }
+    return err
+}
+
+// openFile opens path for reading, decompressing it if it starts with the
+// magic of a registered decompressor.
+func openFile(path string) (io.ReadCloser, error) {
+    f, err := os.Open(path)
+    if err != nil { return nil, err }
+    r, err := decompress(f)
+    if err != nil {
+        f.Close()
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    return &readCloser{r, []io.Closer{r, f}}, nil
+}
+
+// decompress returns a reader for the decompressed contents of r, or for
+// r itself if it isn't compressed.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+    br := bufio.NewReader(r)
+    decompressors.RLock()
+    list := decompressors.list
+    decompressors.RUnlock()
+    for _, entry := range list {
+        magic, err := br.Peek(len(entry.magic))
+        if err == nil && string(magic) == entry.magic {
+            return entry.decompressor(br)
+        }
+    }
+    return io.NopCloser(br), nil
+}
+
+// trimCompressionExt removes the extension of a registered decompressor
+// from path, e.g. "model.obj.gz" becomes "model.obj".
+func trimCompressionExt(path string) string {
+    ext := strings.ToLower(filepath.Ext(path))
+    decompressors.RLock()
+    defer decompressors.RUnlock()
+    for _, entry := range decompressors.list {
+        if ext == entry.ext { return path[:len(path)-len(ext)] }
+    }
+    return path
+}
+
+// Zip bundles
+
+// loadZip loads a zip archive by its contents: as a 3MF package if it
+// holds the package's root model part, otherwise as an OBJ bundle.
+func loadZip(zipPath string, opts *LoadOptions) (*Model, error) {
+    archive, err := zip.OpenReader(zipPath)
+    if err != nil { return nil, err }
+    files := make(map[string]*zip.File)
+    for _, f := range archive.File {
+        files[strings.TrimPrefix(f.Name, "/")] = f
+    }
+    _, is3MF := files[threeMFRootModel(files)]
+    archive.Close()
+    if is3MF { return Load3MF(zipPath, opts) }
+    return loadOBJZip(zipPath, opts)
+}
+
+// loadOBJZip loads the OBJ file contained in a zip archive together with
+// its material library and textures. If the archive contains several OBJ
+// files, the one closest to the root is used. Textures found in the
+// archive are referenced as embedded textures and decoded if
+// opts.LoadTextures is set; other texture paths are resolved relative to
+// the archive's directory.
+func loadOBJZip(zipPath string, opts *LoadOptions) (*Model, error) {
+    archive, err := zip.OpenReader(zipPath)
+    if err != nil { return nil, err }
+    defer archive.Close()
+    bundle := newZipBundle(&archive.Reader)
+    objEntry := bundle.findOBJ()
+    if objEntry == nil {
+        return nil, fmt.Errorf("No OBJ file in %s", zipPath)
+    }
+    r, err := bundle.open(objEntry)
+    if err != nil { return nil, err }
+    objMesh, err := LoadOBJFrom(r, opts.Index)
+    r.Close()
+    if err != nil { return nil, err }
+
+    folder := filepath.Dir(zipPath)
+    model := &Model{Mesh: &objMesh.TriangleMesh,
+        Materials: make(map[string]*Material)}
+    if objMesh.MTLLib != "" {
+        mtlName := path.Join(path.Dir(objEntry.Name),
+            filepath.ToSlash(normaliseTexturePath(objMesh.MTLLib)))
+        mtlEntry := bundle.find(mtlName)
+        if mtlEntry == nil {
+            return nil, fmt.Errorf("Can't open mtllib: %s", objMesh.MTLLib)
+        }
+        r, err := bundle.open(mtlEntry)
+        if err != nil { return nil, err }
+        matList, err := LoadMTLFrom(r)
+        r.Close()
+        if err != nil { return nil, err }
+        for _, mat := range matList {
+            mat.Folder = folder
+            model.Materials[mat.Name] = mat
+            err := bundle.embedTextures(mat, path.Dir(mtlEntry.Name),
+                model, opts)
+            if err != nil { return nil, err }
+        }
+    }
+    processTextures(model, opts)
+    return model, nil
+}
+
+type zipBundle struct {
+    reader *zip.Reader
+    // Entries by lower case name
+    entries map[string]*zip.File
+}
+
+func newZipBundle(reader *zip.Reader) *zipBundle {
+    b := &zipBundle{reader, make(map[string]*zip.File)}
+    for _, f := range reader.File {
+        if strings.HasPrefix(f.Name, "__MACOSX/") ||
+            f.FileInfo().IsDir() { continue }
+        b.entries[strings.ToLower(path.Clean(f.Name))] = f
+    }
+    return b
+}
+
+// find returns the entry with the given name, ignoring case.
+func (b *zipBundle) find(name string) *zip.File {
+    return b.entries[strings.ToLower(path.Clean(name))]
+}
+
+func (b *zipBundle) findOBJ() *zip.File {
+    candidates := make([]*zip.File, 0)
+    for _, f := range b.entries {
+        name := strings.ToLower(trimCompressionExt(f.Name))
+        if strings.HasSuffix(name, ".obj") {
+            candidates = append(candidates, f)
+        }
+    }
+    if len(candidates) == 0 { return nil }
+    sort.Slice(candidates, func(i, j int) bool {
+        di := strings.Count(candidates[i].Name, "/")
+        dj := strings.Count(candidates[j].Name, "/")
+        if di != dj { return di < dj }
+        return candidates[i].Name < candidates[j].Name
+    })
+    return candidates[0]
+}
+
+// open opens an entry, decompressing compressed files within the archive.
+func (b *zipBundle) open(f *zip.File) (io.ReadCloser, error) {
+    rc, err := f.Open()
+    if err != nil { return nil, err }
+    r, err := decompress(rc)
+    if err != nil {
+        rc.Close()
+        return nil, fmt.Errorf("%s: %v", f.Name, err)
+    }
+    return &readCloser{r, []io.Closer{r, rc}}, nil
+}
+
+// embedTextures replaces texture maps found in the archive by embedded
+// texture references, decoding the images if opts.LoadTextures is set.
+// Lookups are case-insensitive and fall back to the file name alone.
+func (b *zipBundle) embedTextures(mat *Material, dir string, model *Model,
+    opts *LoadOptions) error {
+    for _, ref := range mat.textureMaps() {
+        if *ref == "" || filepath.IsAbs(*ref) { continue }
+        name := filepath.ToSlash(normaliseTexturePath(*ref))
+        entry := b.find(path.Join(dir, name))
+        if entry == nil { entry = b.find(path.Join(dir, path.Base(name))) }
+        if entry == nil { continue }
+        *ref = embeddedTexturePrefix + entry.Name
+        if !opts.LoadTextures { continue }
+        if _, ok := model.Textures[*ref]; ok { continue }
+        r, err := entry.Open()
+        if err != nil { return err }
+        data, err := io.ReadAll(r)
+        r.Close()
+        if err != nil { return err }
+        img, err := DecodeTexture(bytes.NewReader(data), path.Ext(name))
+        if err != nil {
+            model.Warnings = append(model.Warnings, fmt.Sprintf(
+                "Can't decode texture %s: %v", entry.Name, err))
+            continue
+        }
+        if model.Textures == nil {
+            model.Textures = make(map[string]image.Image)
+        }
+        model.Textures[*ref] = img
+    }
+    return nil
+}
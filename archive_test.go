@@ -0,0 +1,147 @@
+package go3dm
+
+import (
+    "archive/zip"
+    "bytes"
+    "compress/gzip"
+    "image"
+    "image/color"
+    "image/png"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func gzipFile(t *testing.T, src, dst string) {
+    data, err := os.ReadFile(src)
+    if err != nil { t.Fatal(err) }
+    var buf bytes.Buffer
+    w := gzip.NewWriter(&buf)
+    w.Write(data)
+    if err = w.Close(); err != nil { t.Fatal(err) }
+    if err = os.WriteFile(dst, buf.Bytes(), 0644); err != nil { t.Fatal(err) }
+}
+
+func TestLoadGzip(t *testing.T) {
+    t.Log("Testing: gzip Compressed OBJ")
+    dir := t.TempDir()
+    gzipFile(t, "test-meshes/cubes.obj", filepath.Join(dir, "cubes.obj.gz"))
+    gzipFile(t, "test-meshes/cubes.mtl", filepath.Join(dir, "cubes.mtl"))
+    mesh, materials, err := LoadOBJ(filepath.Join(dir, "cubes.obj.gz"), true)
+    if err != nil { t.Error(err); return }
+    checkMesh(t, mesh, cubesIndexedVertices, nil, cubesIndexedNormals,
+        cubesVertexIndex, cubesObjects)
+    checkMaterials(t, materials, cubesMaterials)
+
+    model, err := Load(filepath.Join(dir, "cubes.obj.gz"),
+        &LoadOptions{Index: true})
+    if err != nil { t.Error(err); return }
+    checkMesh(t, model.Mesh, cubesIndexedVertices, nil, cubesIndexedNormals,
+        cubesVertexIndex, cubesObjects)
+}
+
+func TestLoadOBJZip(t *testing.T) {
+    t.Log("Testing: Zipped OBJ Bundle")
+    img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+    img.Set(0, 0, color.NRGBA{0, 255, 0, 255})
+    var pngData bytes.Buffer
+    if err := png.Encode(&pngData, img); err != nil { t.Fatal(err) }
+    obj := strings.Replace(texplaneOBJ, "mtllib texplane.mtl",
+        "mtllib ../materials/plane.mtl", 1)
+    files := []struct{ name, data string }{
+        {"bundle/models/plane.obj", obj},
+        {"bundle/models/extra/other.obj", "v 0 0 0\n"},
+        {"bundle/materials/plane.mtl",
+            "newmtl Material\nKd 1 1 1\nmap_Kd Textures\\Bricks.png\n" +
+            "map_Ks missing.png\n"},
+        {"bundle/materials/textures/bricks.PNG", pngData.String()},
+    }
+    var buf bytes.Buffer
+    zw := zip.NewWriter(&buf)
+    for _, f := range files {
+        w, err := zw.Create(f.name)
+        if err != nil { t.Fatal(err) }
+        io.WriteString(w, f.data)
+    }
+    if err := zw.Close(); err != nil { t.Fatal(err) }
+    dir := t.TempDir()
+    zipPath := filepath.Join(dir, "plane.zip")
+    if err := os.WriteFile(zipPath, buf.Bytes(), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    model, err := Load(zipPath, &LoadOptions{LoadTextures: true})
+    if err != nil { t.Error(err); return }
+    checkMesh(t, model.Mesh, texplaneVertices, texplaneTexCoords,
+        texplaneNormals, nil, texplaneObjects)
+    mat := model.Materials["Material"]
+    if mat == nil { t.Error("Material not loaded"); return }
+    ref := "embedded:bundle/materials/textures/bricks.PNG"
+    if mat.KdMap != ref {
+        t.Errorf("Unexpected texture reference: %s", mat.KdMap)
+    }
+    if tex := model.Textures[ref]; tex == nil || tex.Bounds().Dx() != 2 {
+        t.Error("Texture not decoded")
+    }
+    if mat.KsMap != filepath.Join(dir, "missing.png") {
+        t.Errorf("Unexpected texture path: %s", mat.KsMap)
+    }
+}
+
+func TestLoadZipFormats(t *testing.T) {
+    t.Log("Testing: Zipped OBJ Bundle and 3MF Package")
+    source, err := LoadOBJFrom(strings.NewReader(texplaneOBJ), true)
+    if err != nil { t.Error(err); return }
+    dir := t.TempDir()
+    var tmf bytes.Buffer
+    err = Write3MF(&tmf, &source.TriangleMesh, nil)
+    if err != nil { t.Error(err); return }
+    var bundle bytes.Buffer
+    zw := zip.NewWriter(&bundle)
+    w, err := zw.Create("plane.obj")
+    if err != nil { t.Fatal(err) }
+    io.WriteString(w, "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n")
+    if err := zw.Close(); err != nil { t.Fatal(err) }
+    for name, data := range map[string][]byte{"tmf.zip": tmf.Bytes(),
+        "obj.zip": bundle.Bytes()} {
+        err = os.WriteFile(filepath.Join(dir, name), data, 0644)
+        if err != nil { t.Fatal(err) }
+    }
+
+    model, err := Load(filepath.Join(dir, "tmf.zip"), nil)
+    if err != nil { t.Error(err); return }
+    if model.Mesh.cornerCount() != 6 {
+        t.Errorf("Unexpected 3MF mesh %v", model.Mesh)
+    }
+    model, err = Load(filepath.Join(dir, "obj.zip"), nil)
+    if err != nil { t.Error(err); return }
+    checkFloats(t, "Vertices", model.Mesh.Vertices,
+        []float32{0, 0, 0, 1, 0, 0, 0, 1, 0})
+}
+
+func TestRegisterDecompressor(t *testing.T) {
+    t.Log("Testing: Custom Decompressor")
+    // A toy format: magic followed by the bytes of the file, inverted
+    RegisterDecompressor(".inv", "INV!", func(r io.Reader) (io.ReadCloser,
+        error) {
+        data, err := io.ReadAll(r)
+        if err != nil { return nil, err }
+        data = data[4:]
+        for i := range data { data[i] = ^data[i] }
+        return io.NopCloser(bytes.NewReader(data)), nil
+    })
+    data, err := os.ReadFile("test-meshes/cubes.obj")
+    if err != nil { t.Fatal(err) }
+    for i := range data { data[i] = ^data[i] }
+    dir := t.TempDir()
+    path := filepath.Join(dir, "cubes.obj.inv")
+    err = os.WriteFile(path, append([]byte("INV!"), data...), 0644)
+    if err != nil { t.Fatal(err) }
+    gzipFile(t, "test-meshes/cubes.mtl", filepath.Join(dir, "cubes.mtl"))
+    model, err := Load(path, &LoadOptions{Index: true})
+    if err != nil { t.Error(err); return }
+    checkMesh(t, model.Mesh, cubesIndexedVertices, nil, cubesIndexedNormals,
+        cubesVertexIndex, cubesObjects)
+}
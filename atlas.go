@@ -0,0 +1,334 @@
+package go3dm
+
+import (
+    "fmt"
+    "image"
+    "image/color"
+    "image/draw"
+    "sort"
+)
+
+// AtlasOptions controls texture atlas packing.
+type AtlasOptions struct {
+    // Name of the merged material, "atlas" if empty
+    Name string
+    // Path of the atlas texture stored in the merged material's KdMap
+    TexturePath string
+    // Pixels of padding around each texture, filled by edge extension
+    Padding int
+    // Maximum width and height of the atlas, 4096 if 0
+    MaxSize int
+}
+
+// Atlas is the result of packing the diffuse textures of a mesh's
+// materials into a single image.
+type Atlas struct {
+    Image *image.NRGBA
+    Material *Material
+    // Region of the atlas used by each source material
+    Regions map[string]image.Rectangle
+}
+
+type atlasEntry struct {
+    key string
+    img image.Image
+    rect image.Rectangle
+}
+
+// PackAtlas packs the diffuse textures used by the mesh objects into a
+// single atlas image and rewrites the mesh's texture coordinates and
+// material references to use the merged material. Materials without a
+// diffuse texture are baked as small tiles of their diffuse colour.
+// textures are keyed by KdMap, as returned by LoadTextures. PackAtlas
+// fails if a texture coordinate lies outside the 0..1 range, as tiling
+// textures can't be represented in an atlas. The mesh is only modified if
+// packing succeeds. The merged material takes its ambient, specular and
+// transparency values from the material of the first mesh object.
+func PackAtlas(mesh *TriangleMesh, materials map[string]*Material,
+    textures map[string]image.Image, opts *AtlasOptions) (*Atlas, error) {
+    if opts == nil { opts = &AtlasOptions{} }
+    maxSize := opts.MaxSize
+    if maxSize == 0 { maxSize = 4096 }
+    name := opts.Name
+    if name == "" { name = "atlas" }
+    vertexCount := len(mesh.Vertices) / 3
+    texCoords := mesh.TextureCoords
+    if texCoords == nil {
+        texCoords = make([]float32, vertexCount*2)
+    }
+
+    // Collect one entry per texture (or untextured material)
+    entries := make([]*atlasEntry, 0)
+    entryMap := make(map[string]*atlasEntry)
+    objEntries := make([]*atlasEntry, len(mesh.Objects))
+    for idx, mo := range mesh.Objects {
+        mat, ok := materials[mo.MaterialRef]
+        if !ok {
+            return nil, fmt.Errorf("Unknown material %s for object %s",
+                mo.MaterialRef, mo.Name)
+        }
+        key := "map:" + mat.KdMap
+        if mat.KdMap == "" { key = "mat:" + mat.Name }
+        entry, ok := entryMap[key]
+        if !ok {
+            entry = &atlasEntry{key: key}
+            if mat.KdMap != "" {
+                entry.img, ok = textures[mat.KdMap]
+                if !ok {
+                    return nil, fmt.Errorf("Texture not loaded: %s",
+                        mat.KdMap)
+                }
+                if mesh.TextureCoords == nil {
+                    return nil, fmt.Errorf(
+                        "Material %s is textured but mesh has no " +
+                        "texture coordinates", mat.Name)
+                }
+            } else {
+                entry.img = solidTile(mat.Kd)
+            }
+            entryMap[key] = entry
+            entries = append(entries, entry)
+        }
+        objEntries[idx] = entry
+        if mat.KdMap == "" { continue }
+        err := forEachObjectVertex(mesh, mo, func(v uint32) error {
+            u, w := texCoords[v*2], texCoords[v*2+1]
+            if u < -uvEpsilon || u > 1+uvEpsilon ||
+                w < -uvEpsilon || w > 1+uvEpsilon {
+                return fmt.Errorf("Object %s uses tiling texture " +
+                    "coordinates (%g, %g), which can't be atlased",
+                    mo.Name, u, w)
+            }
+            return nil
+        })
+        if err != nil { return nil, err }
+    }
+    if len(entries) == 0 {
+        return nil, fmt.Errorf("Mesh has no objects to atlas")
+    }
+
+    width, height, err := packRects(entries, opts.Padding, maxSize)
+    if err != nil { return nil, err }
+    atlasImg := image.NewNRGBA(image.Rect(0, 0, width, height))
+    for _, entry := range entries {
+        draw.Draw(atlasImg, entry.rect, entry.img,
+            entry.img.Bounds().Min, draw.Src)
+        extendEdges(atlasImg, entry.rect, opts.Padding)
+    }
+
+    // Remap texture coordinates, duplicating indexed vertices that are
+    // shared between objects using different atlas regions.
+    type dupKey struct {
+        v uint32
+        entry *atlasEntry
+    }
+    owners := make([]*atlasEntry, vertexCount)
+    duplicates := make(map[dupKey]uint32)
+    newTexCoords := make([]float32, len(texCoords))
+    copy(newTexCoords, texCoords)
+    newMesh := *mesh
+    newMesh.VertexIndex = append([]uint32(nil), mesh.VertexIndex...)
+    for idx, mo := range mesh.Objects {
+        entry := objEntries[idx]
+        solid := entry.key[:4] == "mat:"
+        remap := func(v uint32) uint32 {
+            if owners[v] != nil && owners[v] != entry {
+                if dup, ok := duplicates[dupKey{v, entry}]; ok {
+                    return dup
+                }
+                newTexCoords = append(newTexCoords,
+                    texCoords[v*2], texCoords[v*2+1])
+                dup := duplicateVertex(&newMesh, v)
+                owners = append(owners, nil)
+                duplicates[dupKey{v, entry}] = dup
+                v = dup
+            }
+            if owners[v] == nil {
+                owners[v] = entry
+                u, w := float64(newTexCoords[v*2]),
+                    float64(newTexCoords[v*2+1])
+                if solid { u, w = 0.5, 0.5 }
+                r := entry.rect
+                newTexCoords[v*2] = float32((float64(r.Min.X) +
+                    u * float64(r.Dx())) / float64(width))
+                newTexCoords[v*2+1] = float32(1 - (float64(r.Min.Y) +
+                    (1 - w) * float64(r.Dy())) / float64(height))
+            }
+            return v
+        }
+        if newMesh.VertexIndex != nil {
+            start := int(mo.VertexOffset)
+            for i := start; i < start + int(mo.VertexCount); i++ {
+                newMesh.VertexIndex[i] = remap(newMesh.VertexIndex[i])
+            }
+        } else {
+            forEachObjectVertex(mesh, mo, func(v uint32) error {
+                remap(v)
+                return nil
+            })
+        }
+    }
+
+    merged := &Material{Name: name, Kd: []float32{1, 1, 1},
+        KdMap: opts.TexturePath}
+    first := materials[mesh.Objects[0].MaterialRef]
+    merged.Ka, merged.Ks = first.Ka, first.Ks
+    merged.Ns, merged.Tr = first.Ns, first.Tr
+    atlas := &Atlas{atlasImg, merged, make(map[string]image.Rectangle)}
+    for idx, mo := range mesh.Objects {
+        atlas.Regions[mo.MaterialRef] = objEntries[idx].rect
+    }
+    newObjects := make([]*MeshObject, len(mesh.Objects))
+    for idx, mo := range mesh.Objects {
+        newObj := *mo
+        newObj.MaterialRef = name
+        newObjects[idx] = &newObj
+    }
+    newMesh.TextureCoords = newTexCoords
+    newMesh.Objects = newObjects
+    *mesh = newMesh
+    return atlas, nil
+}
+
+const uvEpsilon = 1e-4
+
+func forEachObjectVertex(mesh *TriangleMesh, mo *MeshObject,
+    fn func(v uint32) error) error {
+    start := int(mo.VertexOffset)
+    end := start + int(mo.VertexCount)
+    for i := start; i < end; i++ {
+        v := uint32(i)
+        if mesh.VertexIndex != nil { v = mesh.VertexIndex[i] }
+        if err := fn(v); err != nil { return err }
+    }
+    return nil
+}
+
+// duplicateVertex appends a copy of vertex v's position, normal, colour,
+// attributes and morph frame data to the mesh and returns the index of
+// the copy. Texture coordinates are left to the caller.
+func duplicateVertex(mesh *TriangleMesh, v uint32) uint32 {
+    mesh.Vertices = append(mesh.Vertices, mesh.Vertices[v*3:v*3+3]...)
+    if mesh.Normals != nil {
+        mesh.Normals = append(mesh.Normals, mesh.Normals[v*3:v*3+3]...)
+    }
+    if mesh.Colors != nil {
+        mesh.Colors = append(mesh.Colors, mesh.Colors[v*4:v*4+4]...)
+    }
+    attrs := make([]*VertexAttribute, len(mesh.Attributes))
+    for i, attr := range mesh.Attributes {
+        size := uint32(attr.Size)
+        dup := *attr
+        dup.Values = append(attr.Values, attr.Values[v*size:(v+1)*size]...)
+        attrs[i] = &dup
+    }
+    if mesh.Attributes != nil { mesh.Attributes = attrs }
+    frames := make([]*MorphFrame, len(mesh.MorphFrames))
+    for i, frame := range mesh.MorphFrames {
+        dup := *frame
+        dup.Vertices = append(frame.Vertices, frame.Vertices[v*3:v*3+3]...)
+        if frame.Normals != nil {
+            dup.Normals = append(frame.Normals,
+                frame.Normals[v*3:v*3+3]...)
+        }
+        frames[i] = &dup
+    }
+    if mesh.MorphFrames != nil { mesh.MorphFrames = frames }
+    return uint32(len(mesh.Vertices)/3 - 1)
+}
+
+func solidTile(kd []float32) image.Image {
+    c := color.NRGBA{255, 255, 255, 255}
+    if len(kd) >= 3 {
+        c.R, c.G, c.B = unitToByte(kd[0]), unitToByte(kd[1]),
+            unitToByte(kd[2])
+    }
+    return image.NewUniform(c)
+}
+
+func unitToByte(v float32) uint8 {
+    if v <= 0 { return 0 }
+    if v >= 1 { return 255 }
+    return uint8(v * 255 + 0.5)
+}
+
+const solidTileSize = 4
+
+// packRects assigns atlas rectangles to entries using a bottom-left
+// skyline packer, doubling the atlas size until everything fits.
+func packRects(entries []*atlasEntry, padding, maxSize int) (int, int,
+    error) {
+    sizes := make([]image.Point, len(entries))
+    area := 0
+    for i, entry := range entries {
+        size := image.Pt(solidTileSize, solidTileSize)
+        if _, ok := entry.img.(*image.Uniform); !ok {
+            size = entry.img.Bounds().Size()
+        }
+        sizes[i] = size.Add(image.Pt(padding*2, padding*2))
+        area += sizes[i].X * sizes[i].Y
+    }
+    order := make([]int, len(entries))
+    for i := range order { order[i] = i }
+    sort.SliceStable(order, func(a, b int) bool {
+        return sizes[order[a]].Y > sizes[order[b]].Y
+    })
+    width, height := 1, 1
+    for width * height < area {
+        if width <= height { width *= 2 } else { height *= 2 }
+    }
+    for width <= maxSize && height <= maxSize {
+        if skylinePack(sizes, order, width, height, entries, padding) {
+            return width, height, nil
+        }
+        if width <= height { width *= 2 } else { height *= 2 }
+    }
+    return 0, 0, fmt.Errorf("Textures don't fit into a %dx%d atlas",
+        maxSize, maxSize)
+}
+
+func skylinePack(sizes []image.Point, order []int, width, height int,
+    entries []*atlasEntry, padding int) bool {
+    // skyline[x] is the height of the filled area in column x
+    skyline := make([]int, width)
+    for _, i := range order {
+        size := sizes[i]
+        if size.X > width { return false }
+        bestX, bestY := -1, height
+        for x := 0; x + size.X <= width; x++ {
+            y := 0
+            for _, h := range skyline[x:x+size.X] {
+                if h > y { y = h }
+            }
+            if y < bestY { bestX, bestY = x, y }
+        }
+        if bestX < 0 || bestY + size.Y > height { return false }
+        for x := bestX; x < bestX + size.X; x++ {
+            skyline[x] = bestY + size.Y
+        }
+        origin := image.Pt(bestX + padding, bestY + padding)
+        entries[i].rect = image.Rectangle{Min: origin,
+            Max: origin.Add(size.Sub(image.Pt(padding*2, padding*2)))}
+    }
+    return true
+}
+
+// extendEdges fills the padding around r with the edge pixels of r.
+func extendEdges(img *image.NRGBA, r image.Rectangle, padding int) {
+    if padding == 0 { return }
+    outer := r.Inset(-padding).Intersect(img.Bounds())
+    for y := outer.Min.Y; y < outer.Max.Y; y++ {
+        for x := outer.Min.X; x < outer.Max.X; x++ {
+            if image.Pt(x, y).In(r) { continue }
+            sx, sy := clampInt(x, r.Min.X, r.Max.X-1),
+                clampInt(y, r.Min.Y, r.Max.Y-1)
+            img.SetNRGBA(x, y, img.NRGBAAt(sx, sy))
+        }
+    }
+}
+
+func clampInt(v, lo, hi int) int {
+    if v < lo { return lo }
+    if v > hi { return hi }
+    return v
+}
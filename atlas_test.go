@@ -0,0 +1,121 @@
+package go3dm
+
+import (
+    "image"
+    "image/color"
+    "strings"
+    "testing"
+)
+
+func atlasTestMesh() (*TriangleMesh, map[string]*Material,
+    map[string]image.Image) {
+    mesh := &TriangleMesh{
+        Vertices: []float32{
+            0, 0, 0,  1, 0, 0,  1, 1, 0,  0, 1, 0,  2, 0, 0,
+        },
+        TextureCoords: []float32{
+            0, 0,  1, 0,  1, 1,  0, 1,  0.5, 0.5,
+        },
+        // Vertices 0, 1 and 2 are shared between objects
+        VertexIndex: []uint32{0, 1, 2,  2, 3, 0,  1, 4, 2},
+        Objects: []*MeshObject{
+            &MeshObject{"red", 0, 3, "red", false},
+            &MeshObject{"blue", 3, 3, "blue", false},
+            &MeshObject{"green", 6, 3, "green", false},
+        },
+    }
+    materials := map[string]*Material{
+        "red": &Material{Name: "red", KdMap: "red.png"},
+        "blue": &Material{Name: "blue", KdMap: "blue.png"},
+        "green": &Material{Name: "green", Kd: []float32{0, 1, 0}},
+    }
+    textures := map[string]image.Image{
+        "red.png": solidImage(8, 8, color.NRGBA{255, 0, 0, 255}),
+        "blue.png": solidImage(4, 4, color.NRGBA{0, 0, 255, 255}),
+    }
+    return mesh, materials, textures
+}
+
+func solidImage(w, h int, c color.NRGBA) image.Image {
+    img := image.NewNRGBA(image.Rect(0, 0, w, h))
+    for i := 0; i < len(img.Pix); i += 4 {
+        img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] =
+            c.R, c.G, c.B, c.A
+    }
+    return img
+}
+
+func TestPackAtlas(t *testing.T) {
+    t.Log("Testing: Texture Atlas")
+    mesh, materials, textures := atlasTestMesh()
+    // Unused, but sorted first
+    materials["aaa"] = &Material{Name: "aaa", Ns: 99}
+    materials["red"].Ns = 10
+    frame := &MorphFrame{Name: "scaled",
+        Vertices: make([]float32, len(mesh.Vertices))}
+    for i, v := range mesh.Vertices { frame.Vertices[i] = v * 2 }
+    mesh.MorphFrames = []*MorphFrame{frame}
+    atlas, err := PackAtlas(mesh, materials, textures,
+        &AtlasOptions{Padding: 1, TexturePath: "atlas.png"})
+    if err != nil { t.Error(err); return }
+    if atlas.Material.KdMap != "atlas.png" {
+        t.Error("Unexpected atlas material")
+    }
+    if len(mesh.Vertices) != 27 || len(mesh.TextureCoords) != 18 {
+        t.Errorf("Shared vertices not duplicated: %d", len(mesh.Vertices))
+        return
+    }
+    if atlas.Material.Ns != 10 {
+        t.Errorf("Unexpected atlas material Ns %g", atlas.Material.Ns)
+    }
+    frame = mesh.MorphFrames[0]
+    if len(frame.Vertices) != len(mesh.Vertices) {
+        t.Errorf("Morph frame vertices not duplicated: %d",
+            len(frame.Vertices))
+        return
+    }
+    for i, v := range mesh.Vertices {
+        if frame.Vertices[i] != v * 2 {
+            t.Errorf("Unexpected morph frame vertex %d", i / 3)
+            break
+        }
+    }
+    expected := map[string]color.NRGBA{
+        "red": {255, 0, 0, 255},
+        "blue": {0, 0, 255, 255},
+        "green": {0, 255, 0, 255},
+    }
+    bounds := atlas.Image.Bounds()
+    for _, mo := range mesh.Objects {
+        if mo.MaterialRef != "atlas" {
+            t.Error("Object material not rewritten")
+        }
+        forEachObjectVertex(mesh, mo, func(v uint32) error {
+            // Sample the texel inside the region the UV points at
+            u, w := mesh.TextureCoords[v*2], mesh.TextureCoords[v*2+1]
+            x := int(u * float32(bounds.Dx() - 1))
+            y := int((1 - w) * float32(bounds.Dy() - 1))
+            c := atlas.Image.NRGBAAt(x, y)
+            if c != expected[mo.Name] {
+                t.Errorf("Object %s samples %v at %d,%d",
+                    mo.Name, c, x, y)
+            }
+            return nil
+        })
+    }
+}
+
+func TestPackAtlasTiling(t *testing.T) {
+    t.Log("Testing: Texture Atlas (Tiling UVs)")
+    mesh, materials, textures := atlasTestMesh()
+    mesh.TextureCoords[2] = 2
+    vertices := mesh.Vertices
+    _, err := PackAtlas(mesh, materials, textures, nil)
+    if err == nil || !strings.Contains(err.Error(), "tiling") {
+        t.Errorf("Expected tiling error, got %v", err)
+    }
+    if len(mesh.Vertices) != len(vertices) ||
+        mesh.Objects[0].MaterialRef != "red" {
+        t.Error("Mesh modified by failed packing")
+    }
+}
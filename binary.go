@@ -0,0 +1,377 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "hash/crc32"
+    "io"
+    "math"
+    "os"
+    "path/filepath"
+)
+
+// Binary cache format
+//
+// All values are little-endian. The file starts with a 24 byte header:
+//
+//   magic "G3DM", format version (uint32), payload length (uint64),
+//   CRC-32 (IEEE) of the payload (uint32), reserved (uint32)
+//
+// The payload consists of the source files the data was created from,
+// the vertex arrays, vertex attributes, face attributes, morph frames and
+// the point cloud flag (since version 2), mesh objects and materials.
+// Arrays are stored as a uint32 element count followed by the raw
+// float32 or uint32 values, strings as a uint32 length followed by the
+// bytes padded to a multiple of four, so that arrays stay 4-byte aligned
+// when the file is memory mapped.
+
+const (
+    binaryMagic = "G3DM"
+    binaryVersion = 2
+    binaryHeaderSize = 24
+)
+
+func init() {
+    RegisterFormat(&Format{Name: "g3dm", Extensions: []string{".g3dm"},
+        Sniff: func(header []byte) bool {
+            return bytes.HasPrefix(header, []byte(binaryMagic))
+        },
+        Load: func(path string, opts *LoadOptions) (*Model, error) {
+            data, err := os.ReadFile(path)
+            if err != nil { return nil, err }
+            mesh, materials, err := DecodeBinary(data)
+            if err != nil { return nil, err }
+            if !opts.Index && mesh.VertexIndex != nil { unindex(mesh) }
+            return meshModel(mesh, materials, opts), nil
+        },
+        Save: func(path string, mesh *TriangleMesh,
+            materials map[string]*Material, opts *SaveOptions) error {
+            return writeFile(path, func(w io.Writer) error {
+                return WriteBinary(w, mesh, materials)
+            })
+        },
+    })
+}
+
+// binarySource records a source file of cached data.
+type binarySource struct {
+    path string
+    size int64
+    modTime int64
+}
+
+// WriteBinary writes mesh and materials in go3dm's binary format.
+func WriteBinary(writer io.Writer, mesh *TriangleMesh,
+    materials map[string]*Material) error {
+    return writeBinary(writer, mesh, materials, nil)
+}
+
+func writeBinary(writer io.Writer, mesh *TriangleMesh,
+    materials map[string]*Material, sources []binarySource) error {
+    e := &binaryEncoder{}
+    e.u32(uint32(len(sources)))
+    for _, s := range sources {
+        e.str(s.path)
+        e.u64(uint64(s.size))
+        e.u64(uint64(s.modTime))
+    }
+    e.f32s(mesh.Vertices)
+    e.f32s(mesh.Normals)
+    e.f32s(mesh.TextureCoords)
+    e.f32s(mesh.Colors)
+    e.u32(uint32(len(mesh.VertexIndex)))
+    for _, v := range mesh.VertexIndex { e.u32(v) }
+    for _, attrs := range [][]*VertexAttribute{mesh.Attributes,
+        mesh.FaceAttributes} {
+        e.u32(uint32(len(attrs)))
+        for _, attr := range attrs {
+            e.str(attr.Name)
+            e.u32(uint32(attr.Size))
+            e.f32s(attr.Values)
+        }
+    }
+    e.u32(uint32(len(mesh.MorphFrames)))
+    for _, frame := range mesh.MorphFrames {
+        e.str(frame.Name)
+        e.f32s(frame.Vertices)
+        e.f32s(frame.Normals)
+    }
+    points := uint32(0)
+    if mesh.Points { points = 1 }
+    e.u32(points)
+    e.u32(uint32(len(mesh.Objects)))
+    for _, mo := range mesh.Objects {
+        e.str(mo.Name)
+        e.u32(uint32(mo.VertexOffset))
+        e.u32(uint32(mo.VertexCount))
+        e.str(mo.MaterialRef)
+        smooth := uint32(0)
+        if mo.Smooth { smooth = 1 }
+        e.u32(smooth)
+    }
+    names := sortedMaterialNames(materials)
+    e.u32(uint32(len(names)))
+    for _, name := range names {
+        mat := materials[name]
+        e.str(mat.Name)
+        e.f32s(mat.Ka)
+        e.f32s(mat.Kd)
+        e.f32s(mat.Ks)
+        e.u32(math.Float32bits(mat.Ns))
+        e.u32(math.Float32bits(mat.Tr))
+        e.str(mat.KaMap)
+        e.str(mat.KdMap)
+        e.str(mat.KsMap)
+        e.str(mat.Folder)
+    }
+
+    header := make([]byte, binaryHeaderSize)
+    le := binary.LittleEndian
+    copy(header, binaryMagic)
+    le.PutUint32(header[4:], binaryVersion)
+    le.PutUint64(header[8:], uint64(len(e.buf)))
+    le.PutUint32(header[16:], crc32.ChecksumIEEE(e.buf))
+    if _, err := writer.Write(header); err != nil { return err }
+    _, err := writer.Write(e.buf)
+    return err
+}
+
+// ReadBinary reads data written by WriteBinary. See DecodeBinary.
+func ReadBinary(reader io.Reader) (*TriangleMesh, map[string]*Material,
+    error) {
+    data, err := io.ReadAll(reader)
+    if err != nil { return nil, nil, err }
+    return DecodeBinary(data)
+}
+
+// DecodeBinary decodes data written by WriteBinary, e.g. the contents of
+// a memory mapped file. The checksum is verified before decoding. The
+// returned mesh doesn't reference data.
+func DecodeBinary(data []byte) (*TriangleMesh, map[string]*Material,
+    error) {
+    mesh, materials, _, err := decodeBinary(data)
+    return mesh, materials, err
+}
+
+func decodeBinary(data []byte) (*TriangleMesh, map[string]*Material,
+    []binarySource, error) {
+    le := binary.LittleEndian
+    if len(data) < binaryHeaderSize ||
+        string(data[:4]) != binaryMagic {
+        return nil, nil, nil, fmt.Errorf("Not a go3dm binary file")
+    }
+    version := le.Uint32(data[4:])
+    if version < 1 || version > binaryVersion {
+        return nil, nil, nil, fmt.Errorf("Unsupported binary version %d",
+            version)
+    }
+    length := le.Uint64(data[8:])
+    if length != uint64(len(data) - binaryHeaderSize) {
+        return nil, nil, nil, fmt.Errorf("Truncated binary file")
+    }
+    payload := data[binaryHeaderSize:]
+    if crc32.ChecksumIEEE(payload) != le.Uint32(data[16:]) {
+        return nil, nil, nil, fmt.Errorf("Binary file checksum mismatch")
+    }
+
+    d := &binaryDecoder{data: payload}
+    sources := make([]binarySource, d.count(12))
+    for i := range sources {
+        sources[i].path = d.str()
+        sources[i].size = int64(d.u64())
+        sources[i].modTime = int64(d.u64())
+    }
+    mesh := &TriangleMesh{}
+    mesh.Vertices = d.f32s()
+    mesh.Normals = d.f32s()
+    mesh.TextureCoords = d.f32s()
+    mesh.Colors = d.f32s()
+    if n := d.count(4); n > 0 {
+        mesh.VertexIndex = make([]uint32, n)
+        for i := range mesh.VertexIndex { mesh.VertexIndex[i] = d.u32() }
+    }
+    attributes := func() []*VertexAttribute {
+        var attrs []*VertexAttribute
+        for i, n := 0, d.count(12); i < n; i++ {
+            attr := &VertexAttribute{Name: d.str()}
+            attr.Size = int(d.u32())
+            attr.Values = d.f32s()
+            attrs = append(attrs, attr)
+        }
+        return attrs
+    }
+    mesh.Attributes = attributes()
+    if version >= 2 {
+        mesh.FaceAttributes = attributes()
+        for i, n := 0, d.count(12); i < n; i++ {
+            frame := &MorphFrame{Name: d.str()}
+            frame.Vertices, frame.Normals = d.f32s(), d.f32s()
+            mesh.MorphFrames = append(mesh.MorphFrames, frame)
+        }
+        mesh.Points = d.u32() != 0
+    }
+    mesh.Objects = make([]*MeshObject, d.count(20))
+    for i := range mesh.Objects {
+        mo := &MeshObject{Name: d.str()}
+        mo.VertexOffset = int32(d.u32())
+        mo.VertexCount = int32(d.u32())
+        mo.MaterialRef = d.str()
+        mo.Smooth = d.u32() != 0
+        mesh.Objects[i] = mo
+    }
+    materials := make(map[string]*Material)
+    for i, n := 0, d.count(44); i < n; i++ {
+        mat := &Material{Name: d.str()}
+        mat.Ka, mat.Kd, mat.Ks = d.f32s(), d.f32s(), d.f32s()
+        mat.Ns = math.Float32frombits(d.u32())
+        mat.Tr = math.Float32frombits(d.u32())
+        mat.KaMap, mat.KdMap, mat.KsMap = d.str(), d.str(), d.str()
+        mat.Folder = d.str()
+        materials[mat.Name] = mat
+    }
+    if d.err != nil { return nil, nil, nil, d.err }
+    return mesh, materials, sources, nil
+}
+
+type binaryEncoder struct {
+    buf []byte
+}
+
+func (e *binaryEncoder) u32(v uint32) {
+    e.buf = append(e.buf, byte(v), byte(v >> 8), byte(v >> 16),
+        byte(v >> 24))
+}
+
+func (e *binaryEncoder) u64(v uint64) {
+    e.u32(uint32(v))
+    e.u32(uint32(v >> 32))
+}
+
+func (e *binaryEncoder) f32s(values []float32) {
+    e.u32(uint32(len(values)))
+    for _, v := range values { e.u32(math.Float32bits(v)) }
+}
+
+func (e *binaryEncoder) str(s string) {
+    e.u32(uint32(len(s)))
+    e.buf = append(e.buf, s...)
+    for len(e.buf) % 4 != 0 { e.buf = append(e.buf, 0) }
+}
+
+// binaryDecoder reads values until the first error, after which it
+// returns zero values.
+type binaryDecoder struct {
+    data []byte
+    off int
+    err error
+}
+
+func (d *binaryDecoder) take(n int) []byte {
+    if d.err != nil { return nil }
+    if n < 0 || n > len(d.data) - d.off {
+        d.err = fmt.Errorf("Corrupt binary file")
+        return nil
+    }
+    b := d.data[d.off:d.off+n]
+    d.off += n
+    return b
+}
+
+func (d *binaryDecoder) u32() uint32 {
+    b := d.take(4)
+    if b == nil { return 0 }
+    return binary.LittleEndian.Uint32(b)
+}
+
+func (d *binaryDecoder) u64() uint64 {
+    b := d.take(8)
+    if b == nil { return 0 }
+    return binary.LittleEndian.Uint64(b)
+}
+
+// count reads an element count, checking it against the remaining data
+// given the minimum size of an element.
+func (d *binaryDecoder) count(elemSize int) int {
+    n := int(d.u32())
+    if d.err == nil && n > (len(d.data) - d.off) / elemSize {
+        d.err = fmt.Errorf("Corrupt binary file")
+    }
+    if d.err != nil { return 0 }
+    return n
+}
+
+func (d *binaryDecoder) f32s() []float32 {
+    n := d.count(4)
+    if n == 0 { return nil }
+    b := d.take(n*4)
+    if b == nil { return nil }
+    values := make([]float32, n)
+    for i := range values {
+        values[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+    }
+    return values
+}
+
+func (d *binaryDecoder) str() string {
+    n := d.count(1)
+    s := string(d.take(n))
+    d.take((4 - n % 4) % 4)
+    return s
+}
+
+// LoadOBJCached loads an OBJ file like LoadOBJ, caching the result in a
+// binary file next to it (the OBJ path with ".g3dm" appended). The cache
+// is used as long as the OBJ and its material library are unchanged,
+// i.e. have the same size and modification time, and was created with
+// the same index setting. Failing to write the cache isn't an error.
+func LoadOBJCached(objPath string, index bool) (*TriangleMesh,
+    map[string]*Material, error) {
+    objPath, err := filepath.Abs(objPath)
+    if err != nil { return nil, nil, err }
+    cachePath := objPath + ".g3dm"
+    if data, err := os.ReadFile(cachePath); err == nil {
+        mesh, materials, sources, err := decodeBinary(data)
+        if err == nil && validCacheSources(objPath, sources) &&
+            (mesh.VertexIndex != nil) == index {
+            return mesh, materials, nil
+        }
+    }
+    model, mtlPath, err := loadOBJModel(objPath, &LoadOptions{Index: index})
+    if err != nil { return nil, nil, err }
+    paths := []string{objPath}
+    if mtlPath != "" { paths = append(paths, mtlPath) }
+    sources := make([]binarySource, 0, len(paths))
+    for _, path := range paths {
+        info, err := os.Stat(path)
+        if err != nil { return model.Mesh, model.Materials, nil }
+        sources = append(sources, binarySource{path, info.Size(),
+            info.ModTime().UnixNano()})
+    }
+    var buf bytes.Buffer
+    if writeBinary(&buf, model.Mesh, model.Materials, sources) == nil {
+        // Write to a temporary file first so that concurrent readers
+        // never see a partial cache
+        tmp, err := os.CreateTemp(filepath.Dir(cachePath),
+            filepath.Base(cachePath))
+        if err == nil {
+            _, err = tmp.Write(buf.Bytes())
+            if closeErr := tmp.Close(); err == nil { err = closeErr }
+            if err == nil { err = os.Rename(tmp.Name(), cachePath) }
+            if err != nil { os.Remove(tmp.Name()) }
+        }
+    }
+    return model.Mesh, model.Materials, nil
+}
+
+func validCacheSources(objPath string, sources []binarySource) bool {
+    if len(sources) == 0 || sources[0].path != objPath { return false }
+    for _, s := range sources {
+        info, err := os.Stat(s.path)
+        if err != nil || info.Size() != s.size ||
+            info.ModTime().UnixNano() != s.modTime {
+            return false
+        }
+    }
+    return true
+}
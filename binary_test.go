@@ -0,0 +1,146 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/binary"
+    "hash/crc32"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+    t.Log("Testing: Binary Round Trip")
+    mesh, materials, err := LoadOBJ("test-meshes/cubes.obj", true)
+    if err != nil { t.Error(err); return }
+    mesh.Colors = make([]float32, len(mesh.Vertices) / 3 * 4)
+    mesh.Colors[3] = 0.5
+    mesh.Attributes = []*VertexAttribute{
+        &VertexAttribute{"weight", 1, make([]float32, len(mesh.Vertices) / 3)},
+    }
+    var buf bytes.Buffer
+    if err = WriteBinary(&buf, mesh, materials); err != nil {
+        t.Error(err)
+        return
+    }
+    data := buf.Bytes()
+    loaded, loadedMaterials, err := ReadBinary(bytes.NewReader(data))
+    if err != nil { t.Error(err); return }
+    checkMesh(t, loaded, mesh.Vertices, mesh.TextureCoords, mesh.Normals,
+        mesh.VertexIndex, mesh.Objects)
+    checkMaterials(t, loadedMaterials, cubesMaterials)
+    if loadedMaterials["redCube"].Folder != materials["redCube"].Folder {
+        t.Error("Material folder not restored")
+    }
+    if len(loaded.Colors) != len(mesh.Colors) || loaded.Colors[3] != 0.5 ||
+        loaded.Attribute("weight") == nil {
+        t.Error("Colours or attributes not restored")
+    }
+    if loaded.TextureCoords != nil {
+        t.Error("Absent texture coordinates not restored as nil")
+    }
+
+    data[len(data)-5] ^= 0xff
+    if _, _, err = DecodeBinary(data); err == nil {
+        t.Error("Checksum mismatch not detected")
+    }
+    if _, _, err = DecodeBinary(data[:len(data)-4]); err == nil {
+        t.Error("Truncated data not detected")
+    }
+}
+
+func TestBinaryAnimation(t *testing.T) {
+    t.Log("Testing: Binary Morph Frames and Face Attributes")
+    model, err := LoadMD2From(bytes.NewReader(md2TestData()), "",
+        &LoadOptions{Index: true})
+    if err != nil { t.Error(err); return }
+    mesh := model.Mesh
+    mesh.FaceAttributes = []*VertexAttribute{
+        &VertexAttribute{"cell", 1, []float32{4, 5}}}
+    var buf bytes.Buffer
+    if err = WriteBinary(&buf, mesh, nil); err != nil { t.Error(err); return }
+    loaded, _, err := DecodeBinary(buf.Bytes())
+    if err != nil { t.Error(err); return }
+    if len(loaded.MorphFrames) != len(mesh.MorphFrames) {
+        t.Errorf("Expected %d morph frames, got %d", len(mesh.MorphFrames),
+            len(loaded.MorphFrames))
+        return
+    }
+    for i, frame := range mesh.MorphFrames {
+        if loaded.MorphFrames[i].Name != frame.Name {
+            t.Errorf("Unexpected morph frame %s", loaded.MorphFrames[i].Name)
+        }
+        checkFloats(t, "Frame vertices", loaded.MorphFrames[i].Vertices,
+            frame.Vertices)
+        checkFloats(t, "Frame normals", loaded.MorphFrames[i].Normals,
+            frame.Normals)
+    }
+    if attr := loaded.FaceAttribute("cell"); attr == nil {
+        t.Error("Face attribute not restored")
+    } else {
+        checkFloats(t, "Face attribute", attr.Values, []float32{4, 5})
+    }
+
+    // Version 1 files have neither
+    e := &binaryEncoder{}
+    e.u32(0)
+    e.f32s([]float32{0, 0, 0, 1, 0, 0, 0, 1, 0})
+    for i := 0; i < 7; i++ { e.u32(0) }
+    header := make([]byte, binaryHeaderSize)
+    copy(header, binaryMagic)
+    binary.LittleEndian.PutUint32(header[4:], 1)
+    binary.LittleEndian.PutUint64(header[8:], uint64(len(e.buf)))
+    binary.LittleEndian.PutUint32(header[16:], crc32.ChecksumIEEE(e.buf))
+    loaded, _, err = DecodeBinary(append(header, e.buf...))
+    if err != nil { t.Error(err); return }
+    if len(loaded.Vertices) != 9 || loaded.MorphFrames != nil {
+        t.Errorf("Unexpected version 1 mesh %v", loaded)
+    }
+}
+
+func TestLoadOBJCached(t *testing.T) {
+    t.Log("Testing: OBJ Cache")
+    dir := t.TempDir()
+    for _, name := range []string{"cubes.obj", "cubes.mtl"} {
+        data, err := os.ReadFile(filepath.Join("test-meshes", name))
+        if err != nil { t.Fatal(err) }
+        if err = os.WriteFile(filepath.Join(dir, name), data, 0644);
+            err != nil {
+            t.Fatal(err)
+        }
+    }
+    objPath := filepath.Join(dir, "cubes.obj")
+    mesh, materials, err := LoadOBJCached(objPath, true)
+    if err != nil { t.Error(err); return }
+    checkMesh(t, mesh, cubesIndexedVertices, nil, cubesIndexedNormals,
+        cubesVertexIndex, cubesObjects)
+    cachePath := objPath + ".g3dm"
+    data, err := os.ReadFile(cachePath)
+    if err != nil { t.Error("Cache not written"); return }
+
+    // Replace the cached mesh to tell whether the cache is used
+    _, _, sources, err := decodeBinary(data)
+    if err != nil { t.Error(err); return }
+    marker := &TriangleMesh{Vertices: []float32{1, 2, 3},
+        VertexIndex: []uint32{0, 0, 0}, Objects: []*MeshObject{}}
+    var buf bytes.Buffer
+    writeBinary(&buf, marker, materials, sources)
+    os.WriteFile(cachePath, buf.Bytes(), 0644)
+    mesh, _, err = LoadOBJCached(objPath, true)
+    if err != nil { t.Error(err); return }
+    if len(mesh.Vertices) != 3 { t.Error("Cache not used") }
+
+    // A different index setting or a modified MTL invalidates the cache
+    mesh, _, err = LoadOBJCached(objPath, false)
+    if err != nil { t.Error(err); return }
+    if len(mesh.Vertices) == 3 || mesh.VertexIndex != nil {
+        t.Error("Cache used with different index setting")
+    }
+    os.WriteFile(cachePath, buf.Bytes(), 0644)
+    later := time.Now().Add(time.Minute)
+    os.Chtimes(filepath.Join(dir, "cubes.mtl"), later, later)
+    mesh, _, err = LoadOBJCached(objPath, true)
+    if err != nil { t.Error(err); return }
+    if len(mesh.Vertices) == 3 { t.Error("Cache not invalidated") }
+}
@@ -0,0 +1,228 @@
+package go3dm
+
+import (
+    "math"
+)
+
+// meshVertex holds all attributes of a single vertex while building
+// a mesh. Attributes the mesh doesn't have are left zero.
+type meshVertex struct {
+    Position [3]float32
+    Normal [3]float32
+    TexCoord [2]float32
+}
+
+// meshBuilder assembles a TriangleMesh from triangle vertices, welding
+// identical vertices when indexing is enabled, similar to the way the OBJ
+// loader shares v/vt/vn combinations.
+type meshBuilder struct {
+    index bool
+    hasNormals bool
+    hasTexCoords bool
+    vertices *f32VA
+    normals *f32VA
+    texCoords *f32VA
+    indicies []uint32
+    vertexMap map[meshVertex]uint32
+    objects []*MeshObject
+}
+
+func newMeshBuilder(index, hasNormals, hasTexCoords bool) *meshBuilder {
+    return &meshBuilder{
+        index, hasNormals, hasTexCoords,
+        NewF32VA(3), NewF32VA(3), NewF32VA(2),
+        make([]uint32, 0, 10),
+        make(map[meshVertex]uint32),
+        make([]*MeshObject, 0, 1),
+    }
+}
+
+// beginObject starts a new mesh object. Vertices added afterwards belong
+// to it.
+func (b *meshBuilder) beginObject(name, materialRef string, smooth bool) {
+    offset := int32(b.vertices.VectorCount())
+    if b.index { offset = int32(len(b.indicies)) }
+    b.objects = append(b.objects,
+        &MeshObject{name, offset, 0, materialRef, smooth})
+}
+
+func (b *meshBuilder) addVertex(v *meshVertex) {
+    if len(b.objects) == 0 { b.beginObject("unknown", "", false) }
+    mo := b.objects[len(b.objects)-1]
+    mo.VertexCount++
+    if b.index {
+        // Attributes the mesh doesn't have must not prevent welding
+        key := *v
+        if !b.hasNormals { key.Normal = [3]float32{} }
+        if !b.hasTexCoords { key.TexCoord = [2]float32{} }
+        if idx, ok := b.vertexMap[key]; ok {
+            b.indicies = append(b.indicies, idx)
+            return
+        }
+        idx := uint32(b.vertices.VectorCount())
+        b.vertexMap[key] = idx
+        b.indicies = append(b.indicies, idx)
+    }
+    b.vertices.AppendVector(v.Position[:])
+    if b.hasNormals { b.normals.AppendVector(v.Normal[:]) }
+    if b.hasTexCoords { b.texCoords.AppendVector(v.TexCoord[:]) }
+}
+
+// addTriangle adds a triangle with the given flat normal.
+func (b *meshBuilder) addTriangle(p [3][3]float32, normal [3]float32) {
+    for i := 0; i < 3; i++ {
+        b.addVertex(&meshVertex{Position: p[i], Normal: normal})
+    }
+}
+
+// mesh returns the built mesh, dropping objects without vertices.
+func (b *meshBuilder) mesh() *TriangleMesh {
+    mesh := &TriangleMesh{Objects: make([]*MeshObject, 0, len(b.objects))}
+    for _, mo := range b.objects {
+        if mo.VertexCount > 0 { mesh.Objects = append(mesh.Objects, mo) }
+    }
+    if b.vertices.VectorCount() > 0 { mesh.Vertices = b.vertices.Values }
+    if b.hasNormals && len(b.normals.Values) > 0 {
+        mesh.Normals = b.normals.Values
+    }
+    if b.hasTexCoords && len(b.texCoords.Values) > 0 {
+        mesh.TextureCoords = b.texCoords.Values
+    }
+    if b.index && len(b.indicies) > 0 { mesh.VertexIndex = b.indicies }
+    return mesh
+}
+
+// Geometry helpers
+
+// vertexIndex returns the vertex referenced by the i-th triangle corner.
+func (m *TriangleMesh) vertexIndex(i int) uint32 {
+    if m.VertexIndex != nil { return m.VertexIndex[i] }
+    return uint32(i)
+}
+
+// cornerCount returns the number of triangle corners (3 per triangle).
+func (m *TriangleMesh) cornerCount() int {
+    if m.VertexIndex != nil { return len(m.VertexIndex) }
+    if m.Points { return 0 }
+    return len(m.Vertices) / 3
+}
+
+// objects returns the mesh objects, or a single object covering every
+// triangle if the mesh has none.
+func (m *TriangleMesh) objects() []*MeshObject {
+    if len(m.Objects) > 0 { return m.Objects }
+    return []*MeshObject{
+        &MeshObject{"go3dm", 0, int32(m.cornerCount()), "", false}}
+}
+
+func (m *TriangleMesh) position(v uint32) [3]float32 {
+    return [3]float32{m.Vertices[v*3], m.Vertices[v*3+1], m.Vertices[v*3+2]}
+}
+
+// faceNormal returns the unit normal of the counter-clockwise triangle
+// a, b, c, or a zero vector for degenerate triangles.
+func faceNormal(a, b, c [3]float32) [3]float32 {
+    u := [3]float64{float64(b[0] - a[0]), float64(b[1] - a[1]),
+        float64(b[2] - a[2])}
+    v := [3]float64{float64(c[0] - a[0]), float64(c[1] - a[1]),
+        float64(c[2] - a[2])}
+    return normalize3([3]float64{
+        u[1]*v[2] - u[2]*v[1],
+        u[2]*v[0] - u[0]*v[2],
+        u[0]*v[1] - u[1]*v[0],
+    })
+}
+
+func normalize3(n [3]float64) [3]float32 {
+    l := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2])
+    if l == 0 { return [3]float32{} }
+    return [3]float32{float32(n[0]/l), float32(n[1]/l), float32(n[2]/l)}
+}
+
+// computeVertexNormals sets mesh.Normals to the area weighted average of
+// the normals of the triangles sharing each vertex.
+func computeVertexNormals(mesh *TriangleMesh) {
+    vertexCount := len(mesh.Vertices) / 3
+    sums := make([]float64, vertexCount*3)
+    for i := 0; i + 2 < mesh.cornerCount(); i += 3 {
+        v := [3]uint32{mesh.vertexIndex(i), mesh.vertexIndex(i+1),
+            mesh.vertexIndex(i+2)}
+        a, b, c := mesh.position(v[0]), mesh.position(v[1]),
+            mesh.position(v[2])
+        // The unnormalised cross product is weighted by triangle area
+        u := [3]float64{float64(b[0] - a[0]), float64(b[1] - a[1]),
+            float64(b[2] - a[2])}
+        w := [3]float64{float64(c[0] - a[0]), float64(c[1] - a[1]),
+            float64(c[2] - a[2])}
+        n := [3]float64{
+            u[1]*w[2] - u[2]*w[1],
+            u[2]*w[0] - u[0]*w[2],
+            u[0]*w[1] - u[1]*w[0],
+        }
+        for _, idx := range v {
+            for j := 0; j < 3; j++ { sums[int(idx)*3+j] += n[j] }
+        }
+    }
+    mesh.Normals = make([]float32, vertexCount*3)
+    for i := 0; i < vertexCount; i++ {
+        n := normalize3([3]float64{sums[i*3], sums[i*3+1], sums[i*3+2]})
+        copy(mesh.Normals[i*3:], n[:])
+    }
+}
+
+// computeWeldedNormals is like computeVertexNormals, but vertices with
+// the same position share their normal, so that vertices split at
+// texture seams don't show.
+func computeWeldedNormals(mesh *TriangleMesh) {
+    welded := make(map[[3]float32]uint32)
+    positionIndex := make([]uint32, len(mesh.Vertices) / 3)
+    positions := make([]float32, 0, len(mesh.Vertices))
+    for v := range positionIndex {
+        p := mesh.position(uint32(v))
+        idx, ok := welded[p]
+        if !ok {
+            idx = uint32(len(positions) / 3)
+            welded[p] = idx
+            positions = append(positions, p[:]...)
+        }
+        positionIndex[v] = idx
+    }
+    weldedMesh := &TriangleMesh{Vertices: positions,
+        VertexIndex: make([]uint32, mesh.cornerCount())}
+    for i := range weldedMesh.VertexIndex {
+        weldedMesh.VertexIndex[i] = positionIndex[mesh.vertexIndex(i)]
+    }
+    computeVertexNormals(weldedMesh)
+    mesh.Normals = make([]float32, len(mesh.Vertices))
+    for v, idx := range positionIndex {
+        copy(mesh.Normals[v*3:v*3+3], weldedMesh.Normals[idx*3:])
+    }
+}
+
+// unindex converts an indexed mesh into a mesh with one vertex per
+// triangle corner. Object offsets are unaffected, as they index corners
+// in both representations.
+func unindex(mesh *TriangleMesh) {
+    if mesh.VertexIndex == nil { return }
+    expand := func(values []float32, size int) []float32 {
+        if values == nil { return nil }
+        result := make([]float32, 0, len(mesh.VertexIndex)*size)
+        for _, v := range mesh.VertexIndex {
+            idx := int(v) * size
+            result = append(result, values[idx:idx+size]...)
+        }
+        return result
+    }
+    mesh.Vertices = expand(mesh.Vertices, 3)
+    mesh.Normals = expand(mesh.Normals, 3)
+    mesh.TextureCoords = expand(mesh.TextureCoords, 2)
+    mesh.Colors = expand(mesh.Colors, 4)
+    for _, attr := range mesh.Attributes {
+        attr.Values = expand(attr.Values, attr.Size)
+    }
+    for _, frame := range mesh.MorphFrames {
+        frame.Vertices = expand(frame.Vertices, 3)
+        frame.Normals = expand(frame.Normals, 3)
+    }
+    mesh.VertexIndex = nil
+}
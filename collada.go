@@ -0,0 +1,757 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "math"
+    "net/url"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// COLLADA 1.4 document structure, restricted to the parts go3dm reads.
+
+type colladaDocument struct {
+    Unit struct {
+        Meter float64 `xml:"meter,attr"`
+    } `xml:"asset>unit"`
+    UpAxis string `xml:"asset>up_axis"`
+    Images []struct {
+        ID string `xml:"id,attr"`
+        InitFrom string `xml:"init_from"`
+    } `xml:"library_images>image"`
+    Effects []*colladaEffect `xml:"library_effects>effect"`
+    Materials []struct {
+        ID string `xml:"id,attr"`
+        Name string `xml:"name,attr"`
+        InstanceEffect struct {
+            URL string `xml:"url,attr"`
+        } `xml:"instance_effect"`
+    } `xml:"library_materials>material"`
+    Geometries []*colladaGeometry `xml:"library_geometries>geometry"`
+    Controllers []*colladaController `xml:"library_controllers>controller"`
+    Animations []struct {
+        ID string `xml:"id,attr"`
+    } `xml:"library_animations>animation"`
+    Nodes []*colladaNode `xml:"library_nodes>node"`
+    VisualScenes []*struct {
+        ID string `xml:"id,attr"`
+        Nodes []*colladaNode `xml:"node"`
+    } `xml:"library_visual_scenes>visual_scene"`
+    Scene struct {
+        URL string `xml:"url,attr"`
+    } `xml:"scene>instance_visual_scene"`
+}
+
+type colladaEffect struct {
+    ID string `xml:"id,attr"`
+    NewParams []struct {
+        SID string `xml:"sid,attr"`
+        Surface string `xml:"surface>init_from"`
+        Sampler string `xml:"sampler2D>source"`
+    } `xml:"profile_COMMON>newparam"`
+    Phong *colladaShader `xml:"profile_COMMON>technique>phong"`
+    Blinn *colladaShader `xml:"profile_COMMON>technique>blinn"`
+    Lambert *colladaShader `xml:"profile_COMMON>technique>lambert"`
+    Constant *colladaShader `xml:"profile_COMMON>technique>constant"`
+}
+
+type colladaShader struct {
+    Emission *colladaColor `xml:"emission"`
+    Ambient *colladaColor `xml:"ambient"`
+    Diffuse *colladaColor `xml:"diffuse"`
+    Specular *colladaColor `xml:"specular"`
+    Shininess string `xml:"shininess>float"`
+    Transparent *colladaColor `xml:"transparent"`
+    Transparency string `xml:"transparency>float"`
+}
+
+// colladaColor is a colour or texture parameter of a shader.
+type colladaColor struct {
+    Opaque string `xml:"opaque,attr"`
+    Color string `xml:"color"`
+    Texture *struct {
+        Texture string `xml:"texture,attr"`
+    } `xml:"texture"`
+}
+
+type colladaGeometry struct {
+    ID string `xml:"id,attr"`
+    Name string `xml:"name,attr"`
+    Mesh *colladaMesh `xml:"mesh"`
+}
+
+type colladaMesh struct {
+    Sources []*colladaSource `xml:"source"`
+    Vertices struct {
+        ID string `xml:"id,attr"`
+        Inputs []*colladaInput `xml:"input"`
+    } `xml:"vertices"`
+    // Primitive elements in document order; other elements of the mesh,
+    // e.g. extra, are filtered when the geometry is loaded
+    Primitives []*colladaPrimitive `xml:",any"`
+}
+
+type colladaSource struct {
+    ID string `xml:"id,attr"`
+    FloatArray string `xml:"float_array"`
+    Accessor struct {
+        Count int `xml:"count,attr"`
+        Offset int `xml:"offset,attr"`
+        Stride int `xml:"stride,attr"`
+        Params []struct {
+            Name string `xml:"name,attr"`
+        } `xml:"param"`
+    } `xml:"technique_common>accessor"`
+}
+
+type colladaInput struct {
+    Semantic string `xml:"semantic,attr"`
+    Source string `xml:"source,attr"`
+    Offset int `xml:"offset,attr"`
+    Set int `xml:"set,attr"`
+}
+
+type colladaPrimitive struct {
+    XMLName xml.Name
+    Material string `xml:"material,attr"`
+    Inputs []*colladaInput `xml:"input"`
+    VCount string `xml:"vcount"`
+    P []string `xml:"p"`
+    // Polygons with holes, only the outer boundary is used
+    PH []struct {
+        P string `xml:"p"`
+    } `xml:"ph"`
+}
+
+type colladaController struct {
+    ID string `xml:"id,attr"`
+    Skin *struct {
+        Source string `xml:"source,attr"`
+        BindShapeMatrix string `xml:"bind_shape_matrix"`
+    } `xml:"skin"`
+    Morph *struct {
+        Source string `xml:"source,attr"`
+    } `xml:"morph"`
+}
+
+type colladaNode struct {
+    ID string `xml:"id,attr"`
+    Name string `xml:"name,attr"`
+    Nodes []*colladaNode `xml:"node"`
+    Geometries []*colladaInstance `xml:"instance_geometry"`
+    Controllers []*colladaInstance `xml:"instance_controller"`
+    InstanceNodes []struct {
+        URL string `xml:"url,attr"`
+    } `xml:"instance_node"`
+    // Transformation elements in document order, other elements are
+    // ignored
+    Transforms []struct {
+        XMLName xml.Name
+        Values string `xml:",chardata"`
+    } `xml:",any"`
+}
+
+type colladaInstance struct {
+    URL string `xml:"url,attr"`
+    Materials []struct {
+        Symbol string `xml:"symbol,attr"`
+        Target string `xml:"target,attr"`
+    } `xml:"bind_material>technique_common>instance_material"`
+}
+
+func init() {
+    RegisterFormat(&Format{Name: "collada", Extensions: []string{".dae"},
+        Sniff: func(header []byte) bool {
+            return bytes.Contains(header, []byte("<COLLADA"))
+        },
+        Load: LoadCOLLADA})
+}
+
+// LoadCOLLADA loads a COLLADA (.dae) file. See LoadCOLLADAFrom.
+func LoadCOLLADA(daePath string, opts *LoadOptions) (*Model, error) {
+    daePath, err := filepath.Abs(daePath)
+    if err != nil { return nil, err }
+    f, err := openFile(daePath)
+    if err != nil { return nil, err }
+    defer f.Close()
+    return LoadCOLLADAFrom(f, filepath.Dir(daePath), opts)
+}
+
+// LoadCOLLADAFrom loads a COLLADA document. Images are resolved relative
+// to dir. The nodes of the visual scene are flattened with their
+// transforms applied and the result is converted to metres with Y up.
+// Each triangles, polylist or polygons element of an instantiated
+// geometry becomes a mesh object; faces without normals get flat
+// normals. Common profile effects are converted to materials. Animations
+// and skinning aren't supported and are reported as warnings, skinned
+// geometry is loaded in its bind shape.
+func LoadCOLLADAFrom(reader io.Reader, dir string,
+    opts *LoadOptions) (*Model, error) {
+    if opts == nil { opts = &LoadOptions{} }
+    doc := new(colladaDocument)
+    if err := xml.NewDecoder(reader).Decode(doc); err != nil {
+        return nil, fmt.Errorf("Invalid COLLADA document: %v", err)
+    }
+    l := &colladaLoader{doc: doc, dir: dir,
+        model: &Model{Materials: make(map[string]*Material)},
+        materialNames: make(map[string]string),
+        nodes: make(map[string]*colladaNode)}
+    if len(doc.Animations) > 0 {
+        l.warn("COLLADA animations ignored (%d)", len(doc.Animations))
+    }
+    if err := l.loadMaterials(); err != nil { return nil, err }
+
+    // Collect the instantiated primitives first, to know whether the mesh
+    // has texture coordinates
+    for _, node := range doc.Nodes { l.indexNodes(node) }
+    for _, scene := range doc.VisualScenes {
+        for _, node := range scene.Nodes { l.indexNodes(node) }
+    }
+    if len(doc.VisualScenes) == 0 {
+        return nil, fmt.Errorf("COLLADA document without visual scene")
+    }
+    scene := doc.VisualScenes[0]
+    for _, s := range doc.VisualScenes {
+        if "#" + s.ID == doc.Scene.URL { scene = s }
+    }
+    root := identityMat4
+    switch strings.TrimSpace(doc.UpAxis) {
+    case "Z_UP": root = mat4{1, 0, 0, 0, 0, 0, -1, 0, 0, 1, 0, 0, 0, 0, 0, 1}
+    case "X_UP": root = mat4{0, 1, 0, 0, -1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+    }
+    if meter := doc.Unit.Meter; meter > 0 && meter != 1 {
+        scale := identityMat4
+        scale[0], scale[5], scale[10] = meter, meter, meter
+        root = root.mul(scale)
+    }
+    for _, node := range scene.Nodes {
+        if err := l.loadNode(node, root, 0); err != nil { return nil, err }
+    }
+
+    builder := newMeshBuilder(opts.Index, true, l.hasTexCoords)
+    for _, prim := range l.primitives {
+        if err := l.buildPrimitive(builder, prim); err != nil {
+            return nil, err
+        }
+    }
+    mesh := builder.mesh()
+    if len(mesh.Vertices) == 0 {
+        return nil, fmt.Errorf("COLLADA scene contains no triangles")
+    }
+    l.model.Mesh = mesh
+    processTextures(l.model, opts)
+    return l.model, nil
+}
+
+type colladaLoader struct {
+    doc *colladaDocument
+    dir string
+    model *Model
+    // Material names by COLLADA material ID
+    materialNames map[string]string
+    nodes map[string]*colladaNode
+    primitives []*colladaPrimitiveInstance
+    hasTexCoords bool
+}
+
+// colladaPrimitiveInstance is a primitive placed in the scene.
+type colladaPrimitiveInstance struct {
+    name string
+    geometry *colladaGeometry
+    primitive *colladaPrimitive
+    materialRef string
+    transform mat4
+}
+
+func (l *colladaLoader) warn(format string, args ...interface{}) {
+    l.model.Warnings = append(l.model.Warnings, fmt.Sprintf(format, args...))
+}
+
+func (l *colladaLoader) indexNodes(node *colladaNode) {
+    if node.ID != "" { l.nodes[node.ID] = node }
+    for _, child := range node.Nodes { l.indexNodes(child) }
+}
+
+func (l *colladaLoader) loadMaterials() error {
+    effects := make(map[string]*colladaEffect)
+    for _, effect := range l.doc.Effects { effects[effect.ID] = effect }
+    images := make(map[string]string)
+    for _, img := range l.doc.Images {
+        images[img.ID] = strings.TrimSpace(img.InitFrom)
+    }
+    for _, m := range l.doc.Materials {
+        name := m.Name
+        if name == "" { name = m.ID }
+        for base, n := name, 2; l.model.Materials[name] != nil; n++ {
+            name = fmt.Sprintf("%s.%d", base, n)
+        }
+        mat := &Material{Name: name, Folder: l.dir,
+            Ka: []float32{0, 0, 0}, Kd: []float32{0.8, 0.8, 0.8},
+            Ks: []float32{0, 0, 0}, Tr: 1}
+        effect := effects[strings.TrimPrefix(m.InstanceEffect.URL, "#")]
+        if effect == nil {
+            l.warn("COLLADA material %s: effect %s not found", name,
+                m.InstanceEffect.URL)
+        } else {
+            err := effect.apply(mat, images)
+            if err != nil {
+                return fmt.Errorf("COLLADA effect %s: %v", effect.ID, err)
+            }
+        }
+        l.model.Materials[name] = mat
+        l.materialNames[m.ID] = name
+    }
+    return nil
+}
+
+// apply sets the material's colours and texture from the effect.
+func (e *colladaEffect) apply(mat *Material, images map[string]string) error {
+    shader := e.Phong
+    if shader == nil { shader = e.Blinn }
+    if shader == nil { shader = e.Lambert }
+    if shader == nil {
+        shader = e.Constant
+        if shader == nil { return nil }
+        // Constant shading only has an emission colour
+        shader.Diffuse = shader.Emission
+    }
+    if d := shader.Diffuse; d != nil && d.Texture != nil {
+        mat.KdMap = e.texturePath(d.Texture.Texture, images)
+        mat.Kd = []float32{1, 1, 1}
+    }
+    for _, p := range []struct {
+        color *colladaColor
+        dest []float32
+    }{{shader.Ambient, mat.Ka}, {shader.Diffuse, mat.Kd},
+        {shader.Specular, mat.Ks}} {
+        if p.color == nil || p.color.Texture != nil { continue }
+        rgba, err := parseColladaFloats(p.color.Color)
+        if err != nil { return err }
+        copy(p.dest, rgba)
+    }
+    if shader.Shininess != "" {
+        v, err := strconv.ParseFloat(strings.TrimSpace(shader.Shininess), 32)
+        if err != nil { return err }
+        mat.Ns = float32(v)
+    }
+    // Opacity, see "Determining Transparency" in the COLLADA specification
+    transparency := 1.0
+    if shader.Transparency != "" {
+        v, err := strconv.ParseFloat(strings.TrimSpace(shader.Transparency),
+            64)
+        if err != nil { return err }
+        transparency = v
+    }
+    if t := shader.Transparent; t != nil && t.Texture == nil {
+        rgba, err := parseColladaFloats(t.Color)
+        if err != nil { return err }
+        if len(rgba) == 4 {
+            if t.Opaque == "RGB_ZERO" {
+                luminance := 0.212671*float64(rgba[0]) +
+                    0.71516*float64(rgba[1]) + 0.072169*float64(rgba[2])
+                mat.Tr = float32(1 - luminance*transparency)
+            } else {
+                mat.Tr = float32(float64(rgba[3]) * transparency)
+            }
+        }
+    } else if shader.Transparency != "" {
+        mat.Tr = float32(transparency)
+    }
+    mat.Tr = float32(math.Max(0, math.Min(1, float64(mat.Tr))))
+    return nil
+}
+
+// texturePath resolves a texture reference through the effect's sampler
+// and surface parameters to an image file path.
+func (e *colladaEffect) texturePath(ref string,
+    images map[string]string) string {
+    for _, p := range e.NewParams {
+        if p.SID == ref && p.Sampler != "" { ref = p.Sampler }
+    }
+    for _, p := range e.NewParams {
+        if p.SID == ref && p.Surface != "" { ref = p.Surface }
+    }
+    path, ok := images[ref]
+    if !ok { path = ref }
+    path = strings.TrimPrefix(path, "file://")
+    if unescaped, err := url.PathUnescape(path); err == nil {
+        path = unescaped
+    }
+    // file:///C:/... leaves a slash before the drive letter
+    if len(path) > 2 && path[0] == '/' && path[2] == ':' { path = path[1:] }
+    return filepath.FromSlash(path)
+}
+
+func (l *colladaLoader) loadNode(node *colladaNode, parent mat4,
+    depth int) error {
+    if depth > 64 { return fmt.Errorf("COLLADA nodes nested too deeply") }
+    world := parent
+    for _, t := range node.Transforms {
+        m, ok, err := colladaTransform(t.XMLName.Local, t.Values)
+        if err != nil {
+            return fmt.Errorf("COLLADA node %s: %v", node.ID, err)
+        }
+        if ok { world = world.mul(m) }
+    }
+    name := node.Name
+    if name == "" { name = node.ID }
+    for _, inst := range node.Geometries {
+        if err := l.addInstance(name, inst, "", world); err != nil {
+            return err
+        }
+    }
+    for _, inst := range node.Controllers {
+        if err := l.addController(name, inst, world); err != nil {
+            return err
+        }
+    }
+    for _, child := range node.Nodes {
+        if err := l.loadNode(child, world, depth + 1); err != nil {
+            return err
+        }
+    }
+    for _, inst := range node.InstanceNodes {
+        child, ok := l.nodes[strings.TrimPrefix(inst.URL, "#")]
+        if !ok { return fmt.Errorf("COLLADA node %s not found", inst.URL) }
+        if err := l.loadNode(child, world, depth + 1); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// colladaTransform returns the matrix of a transformation element, ok is
+// false for elements that aren't transformations.
+func colladaTransform(element, values string) (mat4, bool, error) {
+    switch element {
+    case "matrix", "translate", "rotate", "scale":
+    default:
+        return mat4{}, false, nil
+    }
+    v, err := parseColladaFloats(values)
+    if err != nil { return mat4{}, false, err }
+    expected := map[string]int{"matrix": 16, "translate": 3, "rotate": 4,
+        "scale": 3}[element]
+    if len(v) != expected {
+        return mat4{}, false, fmt.Errorf("Invalid %s", element)
+    }
+    f := func(i int) float64 { return float64(v[i]) }
+    switch element {
+    case "matrix":
+        // COLLADA matrices are row-major
+        var m mat4
+        for row := 0; row < 4; row++ {
+            for col := 0; col < 4; col++ {
+                m[col*4+row] = f(row*4+col)
+            }
+        }
+        return m, true, nil
+    case "translate":
+        return trsMat4([3]float64{f(0), f(1), f(2)}, [4]float64{0, 0, 0, 1},
+            [3]float64{1, 1, 1}), true, nil
+    case "scale":
+        return trsMat4([3]float64{}, [4]float64{0, 0, 0, 1},
+            [3]float64{f(0), f(1), f(2)}), true, nil
+    }
+    axis := normalize3([3]float64{f(0), f(1), f(2)})
+    half := f(3) * math.Pi / 360
+    s := math.Sin(half)
+    q := [4]float64{float64(axis[0]) * s, float64(axis[1]) * s,
+        float64(axis[2]) * s, math.Cos(half)}
+    return trsMat4([3]float64{}, q, [3]float64{1, 1, 1}), true, nil
+}
+
+func (l *colladaLoader) findGeometry(ref string) *colladaGeometry {
+    for _, g := range l.doc.Geometries {
+        if "#" + g.ID == ref { return g }
+    }
+    return nil
+}
+
+func (l *colladaLoader) addController(name string, inst *colladaInstance,
+    world mat4) error {
+    var controller *colladaController
+    for _, c := range l.doc.Controllers {
+        if "#" + c.ID == inst.URL { controller = c }
+    }
+    if controller == nil {
+        return fmt.Errorf("COLLADA controller %s not found", inst.URL)
+    }
+    source, bind := "", identityMat4
+    switch {
+    case controller.Skin != nil:
+        l.warn("COLLADA skinning ignored for %s", name)
+        source = controller.Skin.Source
+        if strings.TrimSpace(controller.Skin.BindShapeMatrix) != "" {
+            m, _, err := colladaTransform("matrix",
+                controller.Skin.BindShapeMatrix)
+            if err != nil { return err }
+            bind = m
+        }
+    case controller.Morph != nil:
+        l.warn("COLLADA morph targets ignored for %s", name)
+        source = controller.Morph.Source
+    }
+    // Skins may refer to morph controllers, use the morph's base mesh
+    for _, c := range l.doc.Controllers {
+        if "#" + c.ID == source && c.Morph != nil { source = c.Morph.Source }
+    }
+    return l.addInstance(name, inst, source, world.mul(bind))
+}
+
+// addInstance records the primitives of an instantiated geometry. The
+// geometry is given by geometryURL if not empty, by the instance URL otherwise.
+func (l *colladaLoader) addInstance(name string, inst *colladaInstance,
+    geometryURL string, world mat4) error {
+    if geometryURL == "" { geometryURL = inst.URL }
+    geometry := l.findGeometry(geometryURL)
+    if geometry == nil {
+        return fmt.Errorf("COLLADA geometry %s not found", geometryURL)
+    }
+    if geometry.Mesh == nil {
+        l.warn("COLLADA geometry %s ignored: not a mesh", geometry.ID)
+        return nil
+    }
+    symbols := make(map[string]string)
+    for _, m := range inst.Materials {
+        symbols[m.Symbol] = l.materialNames[strings.TrimPrefix(m.Target, "#")]
+    }
+    primitives := make([]*colladaPrimitive, 0, len(geometry.Mesh.Primitives))
+    for _, prim := range geometry.Mesh.Primitives {
+        switch prim.XMLName.Local {
+        case "triangles", "polylist", "polygons":
+            primitives = append(primitives, prim)
+        case "lines", "linestrips", "tristrips", "trifans":
+            l.warn("COLLADA %s of geometry %s ignored", prim.XMLName.Local,
+                geometry.ID)
+        }
+    }
+    if name == "" { name = geometry.Name }
+    for p, prim := range primitives {
+        primName := name
+        if len(primitives) > 1 { primName = fmt.Sprintf("%s_%d", name, p) }
+        for _, input := range prim.Inputs {
+            if input.Semantic == "TEXCOORD" { l.hasTexCoords = true }
+        }
+        for _, input := range geometry.Mesh.Vertices.Inputs {
+            if input.Semantic == "TEXCOORD" { l.hasTexCoords = true }
+        }
+        l.primitives = append(l.primitives, &colladaPrimitiveInstance{
+            primName, geometry, prim, symbols[prim.Material], world})
+    }
+    return nil
+}
+
+// Minimum number of values per element of the inputs used
+var colladaInputSizes = map[string]int{
+    "POSITION": 3, "NORMAL": 3, "TEXCOORD": 2,
+}
+
+// colladaStream is an input of a primitive, resolved to its values.
+type colladaStream struct {
+    semantic string
+    offset int
+    values []float32
+    size int
+}
+
+func (l *colladaLoader) buildPrimitive(builder *meshBuilder,
+    inst *colladaPrimitiveInstance) error {
+    geometry, prim := inst.geometry, inst.primitive
+    sources := make(map[string]*colladaSource)
+    for _, s := range geometry.Mesh.Sources { sources["#" + s.ID] = s }
+    // Inputs of the vertices element share the VERTEX input's offset
+    var streams []*colladaStream
+    stride := 0
+    texSet := -1
+    for _, input := range prim.Inputs {
+        if input.Offset + 1 > stride { stride = input.Offset + 1 }
+        inputs := []*colladaInput{input}
+        if input.Semantic == "VERTEX" {
+            inputs = geometry.Mesh.Vertices.Inputs
+        }
+        for _, in := range inputs {
+            semantic := in.Semantic
+            if semantic == "TEXCOORD" {
+                // Only the first texture coordinate set is used
+                if texSet >= 0 && in.Set != texSet { continue }
+                texSet = in.Set
+            }
+            if semantic != "POSITION" && semantic != "NORMAL" &&
+                semantic != "TEXCOORD" { continue }
+            source, ok := sources[in.Source]
+            if !ok {
+                return fmt.Errorf("COLLADA source %s not found", in.Source)
+            }
+            values, size, err := source.read()
+            if err != nil {
+                return fmt.Errorf("COLLADA source %s: %v", in.Source, err)
+            }
+            if size < colladaInputSizes[semantic] {
+                return fmt.Errorf("Corrupt COLLADA source %s: %d values "+
+                    "per %s", in.Source, size, semantic)
+            }
+            streams = append(streams,
+                &colladaStream{semantic, input.Offset, values, size})
+        }
+    }
+    var position, normal, texCoord *colladaStream
+    for _, s := range streams {
+        switch s.semantic {
+        case "POSITION": position = s
+        case "NORMAL": normal = s
+        case "TEXCOORD": texCoord = s
+        }
+    }
+    if position == nil {
+        return fmt.Errorf("COLLADA geometry %s without positions",
+            geometry.ID)
+    }
+
+    // Polygon vertex counts
+    var counts []int
+    var indices []int
+    switch prim.XMLName.Local {
+    case "triangles":
+        p, err := parseColladaInts(strings.Join(prim.P, " "))
+        if err != nil { return err }
+        indices = p
+        for i := 0; i < len(p) / (stride*3); i++ { counts = append(counts, 3) }
+    case "polylist":
+        var err error
+        if counts, err = parseColladaInts(prim.VCount); err != nil {
+            return err
+        }
+        if indices, err = parseColladaInts(strings.Join(prim.P, " "));
+            err != nil {
+            return err
+        }
+        corners := 0
+        for _, count := range counts {
+            if count < 3 || count > len(indices) / stride - corners {
+                return fmt.Errorf("Corrupt COLLADA geometry %s: %d "+
+                    "vertices per polygon", geometry.ID, count)
+            }
+            corners += count
+        }
+    case "polygons":
+        polygons := prim.P
+        for _, ph := range prim.PH { polygons = append(polygons, ph.P) }
+        if len(prim.PH) > 0 {
+            l.warn("COLLADA polygon holes of geometry %s ignored",
+                geometry.ID)
+        }
+        for _, polygon := range polygons {
+            p, err := parseColladaInts(polygon)
+            if err != nil { return err }
+            counts = append(counts, len(p) / stride)
+            indices = append(indices, p...)
+        }
+    }
+
+    flip := inst.transform.determinant3() < 0
+    normalMat := inst.transform.normalMatrix()
+    builder.beginObject(inst.name, inst.materialRef, normal != nil)
+    vertex := func(corner int) (*meshVertex, error) {
+        v := &meshVertex{}
+        for _, s := range []*colladaStream{position, normal, texCoord} {
+            if s == nil { continue }
+            i := corner*stride + s.offset
+            if i >= len(indices) || indices[i] < 0 ||
+                (indices[i]+1)*s.size > len(s.values) {
+                return nil, fmt.Errorf("COLLADA geometry %s: index out of "+
+                    "range", geometry.ID)
+            }
+            values := s.values[indices[i]*s.size:]
+            switch s {
+            case position:
+                v.Position = inst.transform.transformPoint(
+                    [3]float32{values[0], values[1], values[2]})
+            case normal:
+                v.Normal = transformNormal(normalMat,
+                    [3]float32{values[0], values[1], values[2]})
+            default:
+                // COLLADA texture coordinates have their origin at the
+                // bottom left, like OBJ
+                v.TexCoord = [2]float32{values[0], values[1]}
+            }
+        }
+        return v, nil
+    }
+    corner := 0
+    for _, count := range counts {
+        polygon := make([]*meshVertex, count)
+        for i := range polygon {
+            v, err := vertex(corner + i)
+            if err != nil { return err }
+            polygon[i] = v
+        }
+        corner += count
+        for i := 1; i + 1 < count; i++ {
+            tri := [3]*meshVertex{polygon[0], polygon[i], polygon[i+1]}
+            if flip { tri[1], tri[2] = tri[2], tri[1] }
+            if normal == nil {
+                n := faceNormal(tri[0].Position, tri[1].Position,
+                    tri[2].Position)
+                for c := range tri {
+                    flat := *tri[c]
+                    flat.Normal = n
+                    tri[c] = &flat
+                }
+            }
+            for _, v := range tri { builder.addVertex(v) }
+        }
+    }
+    return nil
+}
+
+// read returns the values of a float source and the number of values per
+// element.
+func (s *colladaSource) read() ([]float32, int, error) {
+    values, err := parseColladaFloats(s.FloatArray)
+    if err != nil { return nil, 0, err }
+    acc := s.Accessor
+    size := len(acc.Params)
+    stride := acc.Stride
+    if stride == 0 { stride = 1 }
+    if size == 0 || size > stride { size = stride }
+    if acc.Count < 0 || acc.Offset < 0 || stride < 0 || acc.Count > 0 &&
+        acc.Offset + (acc.Count-1)*stride + size > len(values) {
+        return nil, 0, fmt.Errorf("Accessor out of range")
+    }
+    if acc.Offset == 0 && stride == size {
+        return values[:acc.Count*size], size, nil
+    }
+    result := make([]float32, 0, acc.Count*size)
+    for i := 0; i < acc.Count; i++ {
+        start := acc.Offset + i*stride
+        result = append(result, values[start:start+size]...)
+    }
+    return result, size, nil
+}
+
+func parseColladaFloats(s string) ([]float32, error) {
+    fields := strings.Fields(s)
+    values := make([]float32, len(fields))
+    for i, field := range fields {
+        v, err := strconv.ParseFloat(field, 32)
+        if err != nil { return nil, err }
+        values[i] = float32(v)
+    }
+    return values, nil
+}
+
+func parseColladaInts(s string) ([]int, error) {
+    fields := strings.Fields(s)
+    values := make([]int, len(fields))
+    for i, field := range fields {
+        v, err := strconv.Atoi(field)
+        if err != nil { return nil, err }
+        values[i] = v
+    }
+    return values, nil
+}
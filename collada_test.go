@@ -0,0 +1,163 @@
+package go3dm
+
+import (
+    "math"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+const quadDAE = `<?xml version="1.0" encoding="utf-8"?>
+<COLLADA xmlns="http://www.collada.org/2005/11/COLLADASchema" version="1.4.1">
+ <asset><unit meter="0.01" name="centimeter"/><up_axis>Z_UP</up_axis></asset>
+ <library_images>
+  <image id="bricks"><init_from>textures/bricks%20red.png</init_from></image>
+ </library_images>
+ <library_effects>
+  <effect id="texturedFX"><profile_COMMON>
+   <newparam sid="surface"><surface type="2D"><init_from>bricks</init_from></surface></newparam>
+   <newparam sid="sampler"><sampler2D><source>surface</source></sampler2D></newparam>
+   <technique sid="common"><phong>
+    <diffuse><texture texture="sampler" texcoord="UVSET0"/></diffuse>
+    <specular><color>0.5 0.5 0.5 1</color></specular>
+    <shininess><float>32</float></shininess>
+   </phong></technique>
+  </profile_COMMON></effect>
+  <effect id="redFX"><profile_COMMON><technique sid="common"><lambert>
+   <diffuse><color>1 0 0 1</color></diffuse>
+   <transparency><float>0.5</float></transparency>
+  </lambert></technique></profile_COMMON></effect>
+ </library_effects>
+ <library_materials>
+  <material id="texturedMat" name="textured"><instance_effect url="#texturedFX"/></material>
+  <material id="redMat" name="red"><instance_effect url="#redFX"/></material>
+ </library_materials>
+ <library_geometries>
+  <geometry id="quad" name="quad"><mesh>
+   <source id="pos"><float_array id="pos-array" count="12">0 0 0 1 0 0 1 1 0 0 1 0</float_array>
+    <technique_common><accessor source="#pos-array" count="4" stride="3">
+     <param name="X" type="float"/><param name="Y" type="float"/><param name="Z" type="float"/>
+    </accessor></technique_common></source>
+   <source id="nrm"><float_array id="nrm-array" count="3">0 0 1</float_array>
+    <technique_common><accessor source="#nrm-array" count="1" stride="3">
+     <param name="X" type="float"/><param name="Y" type="float"/><param name="Z" type="float"/>
+    </accessor></technique_common></source>
+   <source id="uv"><float_array id="uv-array" count="8">0 0 1 0 1 1 0 1</float_array>
+    <technique_common><accessor source="#uv-array" count="4" stride="2">
+     <param name="S" type="float"/><param name="T" type="float"/>
+    </accessor></technique_common></source>
+   <vertices id="verts"><input semantic="POSITION" source="#pos"/></vertices>
+   <polylist material="texturedSym" count="1">
+    <input semantic="VERTEX" source="#verts" offset="0"/>
+    <input semantic="NORMAL" source="#nrm" offset="1"/>
+    <input semantic="TEXCOORD" source="#uv" offset="2" set="0"/>
+    <vcount>4</vcount>
+    <p>0 0 0 1 0 1 2 0 2 3 0 3</p>
+   </polylist>
+   <triangles material="redSym" count="1">
+    <input semantic="VERTEX" source="#verts" offset="0"/>
+    <p>0 1 2</p>
+   </triangles>
+   <lines count="1"><input semantic="VERTEX" source="#verts" offset="0"/><p>0 1</p></lines>
+  </mesh></geometry>
+ </library_geometries>
+ <library_animations><animation id="spin"/></library_animations>
+ <library_nodes>
+  <node id="lib" name="lib"><instance_geometry url="#quad"/></node>
+ </library_nodes>
+ <library_visual_scenes>
+  <visual_scene id="scene">
+   <node id="parent" name="parent">
+    <translate>100 0 0</translate>
+    <instance_geometry url="#quad">
+     <bind_material><technique_common>
+      <instance_material symbol="texturedSym" target="#texturedMat"/>
+      <instance_material symbol="redSym" target="#redMat"/>
+     </technique_common></bind_material>
+    </instance_geometry>
+    <node id="child">
+     <matrix>1 0 0 0 0 1 0 0 0 0 1 50 0 0 0 1</matrix>
+     <instance_node url="#lib"/>
+    </node>
+   </node>
+  </visual_scene>
+ </library_visual_scenes>
+ <scene><instance_visual_scene url="#scene"/></scene>
+</COLLADA>
+`
+
+func TestLoadCOLLADA(t *testing.T) {
+    t.Log("Testing: COLLADA Import")
+    model, err := LoadCOLLADAFrom(strings.NewReader(quadDAE), "/models",
+        nil)
+    if err != nil { t.Error(err); return }
+    // Animation and lines warnings (the lines are instanced twice)
+    if len(model.Warnings) != 3 {
+        t.Errorf("Unexpected warnings %v", model.Warnings)
+    }
+    mesh := model.Mesh
+    expectedObjects := []*MeshObject{
+        &MeshObject{"parent_0", 0, 6, "textured", true},
+        &MeshObject{"parent_1", 6, 3, "red", false},
+        &MeshObject{"lib_0", 9, 6, "", true},
+        &MeshObject{"lib_1", 15, 3, "", false},
+    }
+    checkMesh(t, mesh, nil, nil, nil, nil, expectedObjects)
+    near := func(i int, expected [3]float32) bool {
+        for c := 0; c < 3; c++ {
+            if math.Abs(float64(mesh.Vertices[i*3+c] - expected[c])) > 1e-6 {
+                return false
+            }
+        }
+        return true
+    }
+    // Centimetres to metres, Z up to Y up
+    if !near(1, [3]float32{1.01, 0, 0}) || !near(2, [3]float32{1.01, 0, -0.01}) {
+        t.Errorf("Unexpected vertices %v", mesh.Vertices[:9])
+    }
+    if !near(9, [3]float32{1, 0.5, 0}) {
+        t.Errorf("Unexpected instanced node vertex %v", mesh.Vertices[27:30])
+    }
+    if mesh.Normals[1] != 1 || mesh.TextureCoords[4] != 1 ||
+        mesh.TextureCoords[5] != 1 {
+        t.Errorf("Unexpected normal or texture coordinates")
+    }
+    // Flat normals for faces without normals
+    if math.Abs(float64(mesh.Normals[6*3+1] - 1)) > 1e-6 {
+        t.Errorf("Unexpected flat normal %v", mesh.Normals[18:21])
+    }
+    textured := model.Materials["textured"]
+    if textured == nil ||
+        textured.KdMap != filepath.FromSlash("textures/bricks red.png") ||
+        textured.Ns != 32 || textured.Ks[0] != 0.5 ||
+        textured.Folder != "/models" {
+        t.Errorf("Unexpected material %v", textured)
+    }
+    red := model.Materials["red"]
+    if red == nil || red.Kd[0] != 1 || red.Kd[1] != 0 || red.Tr != 0.5 {
+        t.Errorf("Unexpected material %v", red)
+    }
+
+    t.Log("Testing: COLLADA Import (Indexed)")
+    model, err = LoadCOLLADAFrom(strings.NewReader(quadDAE), "",
+        &LoadOptions{Index: true})
+    if err != nil { t.Error(err); return }
+    if len(model.Mesh.VertexIndex) != 18 || len(model.Mesh.Vertices) >= 18*3 {
+        t.Error("Mesh not indexed")
+    }
+
+    corrupt := strings.Replace(quadDAE, `"#nrm-array" count="1" stride="3"`,
+        `"#nrm-array" count="1" stride="2"`, 1)
+    _, err = LoadCOLLADAFrom(strings.NewReader(corrupt), "", nil)
+    if err == nil || !strings.HasPrefix(err.Error(), "Corrupt COLLADA") {
+        t.Errorf("Expected error for short normals, got %v", err)
+    }
+    for _, vcount := range []string{"-3", "2000000000000", "5"} {
+        corrupt = strings.Replace(quadDAE, "<vcount>4</vcount>",
+            "<vcount>" + vcount + "</vcount>", 1)
+        _, err = LoadCOLLADAFrom(strings.NewReader(corrupt), "", nil)
+        if err == nil || !strings.HasPrefix(err.Error(), "Corrupt COLLADA") {
+            t.Errorf("Expected error for vcount %s, got %v", vcount, err)
+        }
+    }
+}
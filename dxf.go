@@ -0,0 +1,363 @@
+package go3dm
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// AutoCAD Drawing Exchange Format, 3DFACE and polyface mesh entities
+
+func init() {
+    RegisterFormat(&Format{Name: "dxf", Extensions: []string{".dxf"},
+        Sniff: func(header []byte) bool {
+            tokens := strings.Fields(string(header))
+            return len(tokens) >= 2 && (tokens[0] == "999" ||
+                tokens[0] == "0" && tokens[1] == "SECTION")
+        },
+        Load: func(path string, opts *LoadOptions) (*Model, error) {
+            mesh, materials, err := LoadDXF(path, opts.Index)
+            if err != nil { return nil, err }
+            return meshModel(mesh, materials, opts), nil
+        },
+        Save: func(path string, mesh *TriangleMesh,
+            materials map[string]*Material, opts *SaveOptions) error {
+            return writeFile(path, func(w io.Writer) error {
+                return WriteDXF(w, mesh, materials)
+            })
+        },
+    })
+}
+
+// dxfGroup is a group code and value pair.
+type dxfGroup struct {
+    code int
+    value string
+}
+
+// dxfEntity is a DXF object such as a section marker, table entry or
+// entity: its type followed by its groups.
+type dxfEntity struct {
+    kind string
+    groups []dxfGroup
+}
+
+func (e *dxfEntity) str(code int, def string) string {
+    for _, g := range e.groups {
+        if g.code == code { return g.value }
+    }
+    return def
+}
+
+func (e *dxfEntity) integer(code, def int) int {
+    v, err := strconv.Atoi(e.str(code, ""))
+    if err != nil { return def }
+    return v
+}
+
+// point returns the point with the given X group code, the Y and Z
+// codes being 10 and 20 higher.
+func (e *dxfEntity) point(code int) [3]float32 {
+    var p [3]float32
+    for i := range p {
+        v, _ := strconv.ParseFloat(e.str(code + i*10, "0"), 32)
+        p[i] = float32(v)
+    }
+    return p
+}
+
+// color returns the entity's true colour or ACI colour, resolving
+// BYLAYER with layers.
+func (e *dxfEntity) color(layers map[string][3]float32) [3]float32 {
+    if rgb := e.integer(420, -1); rgb >= 0 {
+        return [3]float32{float32(rgb>>16&255) / 255,
+            float32(rgb>>8&255) / 255, float32(rgb&255) / 255}
+    }
+    aci := e.integer(62, 256)
+    // Negative colours mark layers that are off
+    if aci < 0 { aci = -aci }
+    if aci == 256 {
+        if rgb, ok := layers[e.str(8, "0")]; ok { return rgb }
+        aci = 7
+    }
+    return aciColor(aci)
+}
+
+// LoadDXF loads the 3D faces of a DXF file. See LoadDXFFrom.
+func LoadDXF(dxfPath string, index bool) (*TriangleMesh,
+    map[string]*Material, error) {
+    dxfFile, err := openFile(dxfPath)
+    if err != nil { return nil, nil, err }
+    defer dxfFile.Close()
+    return LoadDXFFrom(dxfFile, index)
+}
+
+// LoadDXFFrom loads the 3DFACE entities and polyface meshes of an ASCII
+// DXF file. Faces are grouped into a mesh object per layer and colour,
+// named after the layer, with a material per colour. Colours are AutoCAD
+// Color Index or true colours, BYLAYER colours are taken from the layer
+// table. Coordinates are converted from DXF's Z up to Y up. Other
+// entities and block definitions are ignored. If index is false, the
+// geometry is expanded to one vertex per triangle corner.
+func LoadDXFFrom(reader io.Reader, index bool) (*TriangleMesh,
+    map[string]*Material, error) {
+    entities, err := readDXFEntities(reader)
+    if err != nil { return nil, nil, err }
+
+    type dxfFaces struct {
+        layer string
+        materialRef string
+        triangles [][3][3]float32
+    }
+    layers := make(map[string][3]float32)
+    materials := make(map[string]*Material)
+    groups := make([]*dxfFaces, 0)
+    groupMap := make(map[[2]string]*dxfFaces)
+    addFace := func(e *dxfEntity, corners [][3]float32) {
+        rgb := e.color(layers)
+        materialRef := colorMaterialName(rgb)
+        if _, ok := materials[materialRef]; !ok {
+            materials[materialRef] = colorMaterial(materialRef, rgb)
+        }
+        layer := e.str(8, "0")
+        key := [2]string{layer, materialRef}
+        faces, ok := groupMap[key]
+        if !ok {
+            faces = &dxfFaces{layer: layer, materialRef: materialRef}
+            groupMap[key] = faces
+            groups = append(groups, faces)
+        }
+        // Triangles have their last corner repeated
+        if corners[3] == corners[2] { corners = corners[:3] }
+        for i := 1; i + 1 < len(corners); i++ {
+            tri := [3][3]float32{corners[0], corners[i], corners[i+1]}
+            if tri[0] == tri[1] || tri[1] == tri[2] || tri[0] == tri[2] {
+                continue
+            }
+            for c := range tri { copy(tri[c][:], zUpToYUp(tri[c])) }
+            faces.triangles = append(faces.triangles, tri)
+        }
+    }
+
+    section := ""
+    for i := 0; i < len(entities); i++ {
+        e := entities[i]
+        switch {
+        case e.kind == "SECTION":
+            section = e.str(2, "")
+        case e.kind == "ENDSEC":
+            section = ""
+        case section == "TABLES" && e.kind == "LAYER":
+            layers[e.str(2, "0")] = e.color(nil)
+        case section != "ENTITIES":
+            // Block definitions are only used through INSERT entities
+        case e.kind == "3DFACE":
+            addFace(e, [][3]float32{e.point(10), e.point(11), e.point(12),
+                e.point(13)})
+        case e.kind == "POLYLINE" && e.integer(70, 0) & 64 != 0:
+            // Polyface meshes list their vertices, then faces indexing
+            // them, as VERTEX entities up to a SEQEND
+            vertices := make([][3]float32, 0)
+            for i++; i < len(entities) && entities[i].kind == "VERTEX"; i++ {
+                v := entities[i]
+                flags := v.integer(70, 0)
+                if flags & 64 != 0 {
+                    vertices = append(vertices, v.point(10))
+                    continue
+                }
+                if flags & 128 == 0 { continue }
+                corners := make([][3]float32, 0, 4)
+                for code := 71; code <= 74; code++ {
+                    idx := v.integer(code, 0)
+                    // Negative indices mark invisible edges
+                    if idx < 0 { idx = -idx }
+                    if idx == 0 { break }
+                    if idx > len(vertices) {
+                        return nil, nil, fmt.Errorf("DXF polyface vertex " +
+                            "index %d out of range", idx)
+                    }
+                    corners = append(corners, vertices[idx-1])
+                }
+                if len(corners) < 3 { continue }
+                if len(corners) == 3 { corners = append(corners, corners[2]) }
+                // Faces without their own layer or colour use the
+                // polyline's
+                face := &dxfEntity{kind: v.kind,
+                    groups: append([]dxfGroup(nil), v.groups...)}
+                for _, g := range e.groups {
+                    if g.code == 8 && v.str(8, "") == "" ||
+                        (g.code == 62 || g.code == 420) &&
+                        v.str(62, "") == "" && v.str(420, "") == "" {
+                        face.groups = append(face.groups, g)
+                    }
+                }
+                addFace(face, corners)
+            }
+            if i < len(entities) && entities[i].kind != "SEQEND" { i-- }
+        }
+    }
+
+    b := newMeshBuilder(index, false, false)
+    for _, faces := range groups {
+        b.beginObject(faces.layer, faces.materialRef, false)
+        for _, tri := range faces.triangles {
+            for c := range tri { b.addVertex(&meshVertex{Position: tri[c]}) }
+        }
+    }
+    mesh := b.mesh()
+    // Drop materials of groups without usable faces
+    used := make(map[string]bool)
+    for _, mo := range mesh.Objects { used[mo.MaterialRef] = true }
+    for name := range materials {
+        if !used[name] { delete(materials, name) }
+    }
+    return mesh, materials, nil
+}
+
+// readDXFEntities reads the group code and value pairs of an ASCII DXF
+// file, split at code 0.
+func readDXFEntities(reader io.Reader) ([]*dxfEntity, error) {
+    scanner := bufio.NewScanner(reader)
+    scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+    entities := make([]*dxfEntity, 0)
+    var entity *dxfEntity
+    for lineNo := 1; scanner.Scan(); lineNo += 2 {
+        line := strings.TrimSpace(scanner.Text())
+        if lineNo == 1 && strings.HasPrefix(line, "AutoCAD Binary DXF") {
+            return nil, fmt.Errorf("Binary DXF isn't supported")
+        }
+        code, err := strconv.Atoi(line)
+        if err != nil {
+            return nil, fmt.Errorf("DXF line %d: invalid group code %q",
+                lineNo, line)
+        }
+        if !scanner.Scan() {
+            return nil, fmt.Errorf("DXF line %d: missing group value",
+                lineNo + 1)
+        }
+        value := strings.TrimSpace(scanner.Text())
+        switch {
+        case code == 0:
+            if value == "EOF" { return entities, nil }
+            entity = &dxfEntity{kind: value}
+            entities = append(entities, entity)
+        case code == 999:
+            // Comment
+        case entity == nil:
+            return nil, fmt.Errorf("DXF line %d: group outside of an " +
+                "entity", lineNo)
+        default:
+            entity.groups = append(entity.groups, dxfGroup{code, value})
+        }
+    }
+    if err := scanner.Err(); err != nil { return nil, err }
+    if len(entities) == 0 { return nil, fmt.Errorf("Not a DXF file") }
+    return entities, nil
+}
+
+// aciColor returns the RGB value of an AutoCAD Color Index.
+func aciColor(aci int) [3]float32 {
+    switch {
+    case aci >= 1 && aci <= 6:
+        hue := [6][3]float32{{1, 0, 0}, {1, 1, 0}, {0, 1, 0}, {0, 1, 1},
+            {0, 0, 1}, {1, 0, 1}}
+        return hue[aci-1]
+    case aci == 8 || aci == 9:
+        gray := float32(128 + (aci - 8) * 64) / 255
+        return [3]float32{gray, gray, gray}
+    case aci >= 10 && aci <= 249:
+        // 24 hues in 15° steps, each in five shades of full and half
+        // saturation
+        hue := float64((aci - 10) / 10) * 15
+        variant := (aci - 10) % 10
+        value := [5]float32{1, 0.65, 0.5, 0.3, 0.15}[variant/2]
+        var rgb [3]float32
+        for c := range rgb {
+            // Distance of the hue from the channel's primary, in sixths
+            d := math.Mod(hue / 60 - float64(c) * 2 + 6, 6)
+            if d > 3 { d = 6 - d }
+            rgb[c] = float32(math.Max(0, math.Min(1, 2 - d)))
+            if variant % 2 == 1 { rgb[c] = rgb[c] * 0.5 + 0.5 }
+            rgb[c] *= value
+        }
+        return rgb
+    case aci >= 250 && aci <= 255:
+        gray := float32([6]int{51, 80, 105, 130, 190, 255}[aci-250]) / 255
+        return [3]float32{gray, gray, gray}
+    }
+    // 7 and invalid indices, including BYBLOCK
+    return [3]float32{1, 1, 1}
+}
+
+// nearestACI returns the AutoCAD Color Index closest to rgb.
+func nearestACI(rgb [3]float32) int {
+    best, bestDist := 7, float32(math.MaxFloat32)
+    for aci := 1; aci <= 255; aci++ {
+        c := aciColor(aci)
+        var dist float32
+        for i := range c { dist += (c[i] - rgb[i]) * (c[i] - rgb[i]) }
+        if dist < bestDist { best, bestDist = aci, dist }
+    }
+    return best
+}
+
+// dxfLayerName replaces characters that aren't allowed in layer names.
+func dxfLayerName(name string) string {
+    if name == "" { return "0" }
+    return strings.Map(func(r rune) rune {
+        if strings.ContainsRune("<>/\\\":;?*|=`", r) || r < ' ' {
+            return '_'
+        }
+        return r
+    }, name)
+}
+
+// WriteDXF writes mesh as an AutoCAD R12 ASCII DXF file of 3DFACE
+// entities, one layer per mesh object. If materials is not nil, faces of
+// mesh objects whose material is known get the AutoCAD Color Index
+// closest to the material's diffuse colour, the others use the layer
+// colour. Coordinates are converted from Y up to DXF's Z up. Normals,
+// texture coordinates and vertex colours aren't written.
+func WriteDXF(writer io.Writer, mesh *TriangleMesh,
+    materials map[string]*Material) error {
+    objects := mesh.objects()
+    w := bufio.NewWriter(writer)
+    group := func(code int, value string) {
+        fmt.Fprintf(w, "%3d\n%s\n", code, value)
+    }
+    group(999, "written by go3dm")
+    group(0, "SECTION")
+    group(2, "HEADER")
+    group(9, "$ACADVER")
+    group(1, "AC1009")
+    group(0, "ENDSEC")
+    group(0, "SECTION")
+    group(2, "ENTITIES")
+    for _, mo := range objects {
+        layer := dxfLayerName(mo.Name)
+        color := 256
+        if mat, ok := materials[mo.MaterialRef]; ok && len(mat.Kd) >= 3 {
+            color = nearestACI([3]float32{mat.Kd[0], mat.Kd[1], mat.Kd[2]})
+        }
+        start := int(mo.VertexOffset)
+        for i := start; mo.VertexOffset >= 0 &&
+            i + 2 < start + int(mo.VertexCount); i += 3 {
+            group(0, "3DFACE")
+            group(8, layer)
+            if color != 256 { group(62, strconv.Itoa(color)) }
+            // The third corner is repeated as the fourth
+            for c := 0; c < 4; c++ {
+                p := mesh.position(mesh.vertexIndex(i + c - c/3))
+                group(10 + c, formatF32(p[0], -1))
+                group(20 + c, formatF32(-p[2], -1))
+                group(30 + c, formatF32(p[1], -1))
+            }
+        }
+    }
+    group(0, "ENDSEC")
+    group(0, "EOF")
+    return w.Flush()
+}
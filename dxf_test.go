@@ -0,0 +1,202 @@
+package go3dm
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+// A layer table, a quad and a triangle on layer walls and a polyface
+// triangle on layer roof, which is off
+const facesDXF = `  0
+SECTION
+  2
+TABLES
+  0
+TABLE
+  2
+LAYER
+  0
+LAYER
+  2
+walls
+ 62
+1
+  0
+LAYER
+  2
+roof
+ 62
+-5
+  0
+ENDTAB
+  0
+ENDSEC
+  0
+SECTION
+  2
+ENTITIES
+  0
+3DFACE
+  8
+walls
+ 10
+0
+ 20
+0
+ 30
+0
+ 11
+1
+ 21
+0
+ 31
+0
+ 12
+1
+ 22
+0
+ 32
+1
+ 13
+0
+ 23
+0
+ 33
+1
+  0
+3DFACE
+  8
+walls
+ 62
+3
+ 10
+0
+ 20
+0
+ 30
+0
+ 11
+1
+ 21
+0
+ 31
+0
+ 12
+0
+ 22
+1
+ 32
+0
+ 13
+0
+ 23
+1
+ 33
+0
+  0
+POLYLINE
+  8
+roof
+ 66
+1
+ 70
+64
+  0
+VERTEX
+ 10
+0
+ 20
+0
+ 30
+1
+ 70
+192
+  0
+VERTEX
+ 10
+1
+ 20
+0
+ 30
+1
+ 70
+192
+  0
+VERTEX
+ 10
+0
+ 20
+1
+ 30
+1
+ 70
+192
+  0
+VERTEX
+ 70
+128
+ 71
+1
+ 72
+2
+ 73
+-3
+  0
+SEQEND
+  0
+ENDSEC
+  0
+EOF
+`
+
+func TestLoadDXF(t *testing.T) {
+    t.Log("Testing: DXF 3DFACE and Polyface Import")
+    mesh, materials, err := LoadDXFFrom(strings.NewReader(facesDXF), true)
+    if err != nil { t.Error(err); return }
+    checkMesh(t, mesh,
+        []float32{0, 0, 0,  1, 0, 0,  1, 1, 0,  0, 1, 0,  0, 0, -1,
+            0, 1, -1},
+        nil, nil,
+        []uint32{0, 1, 2,  0, 2, 3,  0, 1, 4,  3, 2, 5},
+        []*MeshObject{
+            &MeshObject{"walls", 0, 6, "color_ff0000", false},
+            &MeshObject{"walls", 6, 3, "color_00ff00", false},
+            &MeshObject{"roof", 9, 3, "color_0000ff", false},
+        })
+    checkMaterials(t, materials, []*Material{
+        colorMaterial("color_0000ff", [3]float32{0, 0, 1}),
+        colorMaterial("color_00ff00", [3]float32{0, 1, 0}),
+        colorMaterial("color_ff0000", [3]float32{1, 0, 0}),
+    })
+
+    _, _, err = LoadDXFFrom(strings.NewReader("  0\nSECTION\nx\n"), true)
+    if err == nil { t.Error("Invalid group code not rejected") }
+}
+
+func TestDXFRoundTrip(t *testing.T) {
+    t.Log("Testing: DXF Round Trip")
+    source, materials, err := LoadDXFFrom(strings.NewReader(facesDXF),
+        false)
+    if err != nil { t.Error(err); return }
+    var buf bytes.Buffer
+    if err = WriteDXF(&buf, source, materials); err != nil {
+        t.Error(err)
+        return
+    }
+    mesh, loaded, err := LoadDXFFrom(&buf, false)
+    if err != nil { t.Error(err); return }
+    checkMesh(t, mesh, source.Vertices, nil, nil, nil, source.Objects)
+    if len(loaded) != len(materials) {
+        t.Errorf("Unexpected materials %v", loaded)
+    }
+
+    for _, aci := range []int{1, 7, 8, 13, 30, 254} {
+        if n := nearestACI(aciColor(aci)); n != aci {
+            t.Errorf("ACI %d: nearest index %d", aci, n)
+        }
+    }
+    if rgb := aciColor(30); rgb != [3]float32{1, 0.5, 0} {
+        t.Errorf("Unexpected ACI 30 colour %v", rgb)
+    }
+}
@@ -0,0 +1,145 @@
+package go3dm
+
+import (
+    "encoding/json"
+)
+
+// glTF 2.0 document structure, restricted to the parts go3dm reads and
+// writes.
+
+const (
+    gltfByte = 5120
+    gltfUnsignedByte = 5121
+    gltfShort = 5122
+    gltfUnsignedShort = 5123
+    gltfUnsignedInt = 5125
+    gltfFloat = 5126
+
+    gltfArrayBuffer = 34962
+    gltfElementArrayBuffer = 34963
+
+    gltfTriangles = 4
+
+    glbMagic = 0x46546C67
+    glbChunkJSON = 0x4E4F534A
+    glbChunkBIN = 0x004E4942
+)
+
+var gltfTypeSizes = map[string]int{
+    "SCALAR": 1, "VEC2": 2, "VEC3": 3, "VEC4": 4,
+    "MAT2": 4, "MAT3": 9, "MAT4": 16,
+}
+
+var gltfComponentSizes = map[int]int{
+    gltfByte: 1, gltfUnsignedByte: 1, gltfShort: 2, gltfUnsignedShort: 2,
+    gltfUnsignedInt: 4, gltfFloat: 4,
+}
+
+type gltfDocument struct {
+    Asset gltfAsset `json:"asset"`
+    ExtensionsUsed []string `json:"extensionsUsed,omitempty"`
+    ExtensionsRequired []string `json:"extensionsRequired,omitempty"`
+    Scene *int `json:"scene,omitempty"`
+    Scenes []*gltfScene `json:"scenes,omitempty"`
+    Nodes []*gltfNode `json:"nodes,omitempty"`
+    Meshes []*gltfMesh `json:"meshes,omitempty"`
+    Materials []*gltfMaterial `json:"materials,omitempty"`
+    Textures []*gltfTexture `json:"textures,omitempty"`
+    Images []*gltfImage `json:"images,omitempty"`
+    Accessors []*gltfAccessor `json:"accessors,omitempty"`
+    BufferViews []*gltfBufferView `json:"bufferViews,omitempty"`
+    Buffers []*gltfBuffer `json:"buffers,omitempty"`
+}
+
+type gltfAsset struct {
+    Version string `json:"version"`
+    Generator string `json:"generator,omitempty"`
+}
+
+type gltfScene struct {
+    Name string `json:"name,omitempty"`
+    Nodes []int `json:"nodes"`
+}
+
+type gltfNode struct {
+    Name string `json:"name,omitempty"`
+    Mesh *int `json:"mesh,omitempty"`
+    Children []int `json:"children,omitempty"`
+    Matrix []float64 `json:"matrix,omitempty"`
+    Translation []float64 `json:"translation,omitempty"`
+    Rotation []float64 `json:"rotation,omitempty"`
+    Scale []float64 `json:"scale,omitempty"`
+}
+
+type gltfMesh struct {
+    Name string `json:"name,omitempty"`
+    Primitives []*gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+    Attributes map[string]int `json:"attributes"`
+    Indices *int `json:"indices,omitempty"`
+    Material *int `json:"material,omitempty"`
+    Mode *int `json:"mode,omitempty"`
+    Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+}
+
+type gltfMaterial struct {
+    Name string `json:"name,omitempty"`
+    PBR *gltfPBR `json:"pbrMetallicRoughness,omitempty"`
+    AlphaMode string `json:"alphaMode,omitempty"`
+    DoubleSided bool `json:"doubleSided,omitempty"`
+    Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+}
+
+type gltfPBR struct {
+    BaseColorFactor []float64 `json:"baseColorFactor,omitempty"`
+    BaseColorTexture *gltfTextureInfo `json:"baseColorTexture,omitempty"`
+    MetallicFactor *float64 `json:"metallicFactor,omitempty"`
+    RoughnessFactor *float64 `json:"roughnessFactor,omitempty"`
+}
+
+type gltfTextureInfo struct {
+    Index int `json:"index"`
+    TexCoord int `json:"texCoord,omitempty"`
+}
+
+type gltfTexture struct {
+    Source *int `json:"source,omitempty"`
+}
+
+type gltfImage struct {
+    Name string `json:"name,omitempty"`
+    URI string `json:"uri,omitempty"`
+    MimeType string `json:"mimeType,omitempty"`
+    BufferView *int `json:"bufferView,omitempty"`
+}
+
+type gltfAccessor struct {
+    BufferView *int `json:"bufferView,omitempty"`
+    ByteOffset int `json:"byteOffset,omitempty"`
+    ComponentType int `json:"componentType"`
+    Normalized bool `json:"normalized,omitempty"`
+    Count int `json:"count"`
+    Type string `json:"type"`
+    Min []float64 `json:"min,omitempty"`
+    Max []float64 `json:"max,omitempty"`
+    Sparse json.RawMessage `json:"sparse,omitempty"`
+}
+
+type gltfBufferView struct {
+    Buffer int `json:"buffer"`
+    ByteOffset int `json:"byteOffset,omitempty"`
+    ByteLength int `json:"byteLength"`
+    ByteStride int `json:"byteStride,omitempty"`
+    Target int `json:"target,omitempty"`
+}
+
+type gltfBuffer struct {
+    URI string `json:"uri,omitempty"`
+    ByteLength int `json:"byteLength"`
+}
+
+func intPtr(v int) *int { return &v }
+
+func float64Ptr(v float64) *float64 { return &v }
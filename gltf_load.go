@@ -0,0 +1,595 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "image"
+    "io"
+    "math"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+func init() {
+    save := func(path string, mesh *TriangleMesh,
+        materials map[string]*Material, opts *SaveOptions) error {
+        gltfOpts := &GLTFWriteOptions{EmbedTextures: opts.EmbedTextures,
+            TextureDir: filepath.Dir(path), Textures: opts.Textures}
+        return writeFile(path, func(w io.Writer) error {
+            if strings.EqualFold(filepath.Ext(path), ".glb") ||
+                strings.EqualFold(opts.Format, "glb") {
+                return WriteGLB(w, mesh, materials, gltfOpts)
+            }
+            return WriteGLTF(w, mesh, materials, gltfOpts)
+        })
+    }
+    RegisterFormat(&Format{Name: "gltf", Extensions: []string{".gltf"},
+        Sniff: func(header []byte) bool {
+            return bytes.HasPrefix(bytes.TrimSpace(header), []byte("{"))
+        },
+        Load: LoadGLTF, Save: save})
+    RegisterFormat(&Format{Name: "glb", Extensions: []string{".glb"},
+        Sniff: func(header []byte) bool {
+            return bytes.HasPrefix(header, []byte("glTF"))
+        },
+        Load: LoadGLTF, Save: save})
+}
+
+// LoadGLTF loads a .gltf or .glb file. See LoadGLTFFrom.
+func LoadGLTF(gltfPath string, opts *LoadOptions) (*Model, error) {
+    gltfPath, err := filepath.Abs(gltfPath)
+    if err != nil { return nil, err }
+    f, err := openFile(gltfPath)
+    if err != nil { return nil, err }
+    defer f.Close()
+    return LoadGLTFFrom(f, filepath.Dir(gltfPath), opts)
+}
+
+// LoadGLTFFrom loads glTF 2.0 JSON or GLB data. External buffers and
+// images are resolved relative to dir. The default scene's node hierarchy
+// is flattened with node transforms applied to positions and normals;
+// each triangle primitive becomes a mesh object. Materials are converted
+// from pbrMetallicRoughness to Phong. Extensions aren't supported: used
+// extensions are reported as warnings, required ones cause an error.
+// Embedded images are only decoded if opts.LoadTextures is set.
+func LoadGLTFFrom(reader io.Reader, dir string,
+    opts *LoadOptions) (*Model, error) {
+    if opts == nil { opts = &LoadOptions{} }
+    data, err := io.ReadAll(reader)
+    if err != nil { return nil, err }
+    var jsonData, glbBin []byte
+    if len(data) >= 12 && binary.LittleEndian.Uint32(data) == glbMagic {
+        jsonData, glbBin, err = parseGLB(data)
+        if err != nil { return nil, err }
+    } else {
+        jsonData = data
+    }
+    doc := new(gltfDocument)
+    if err = json.Unmarshal(jsonData, doc); err != nil {
+        return nil, fmt.Errorf("Invalid glTF JSON: %v", err)
+    }
+    if !strings.HasPrefix(doc.Asset.Version, "2.") {
+        return nil, fmt.Errorf("Unsupported glTF version %s",
+            doc.Asset.Version)
+    }
+    if len(doc.ExtensionsRequired) > 0 {
+        return nil, fmt.Errorf("Unsupported required glTF extensions: %s",
+            strings.Join(doc.ExtensionsRequired, ", "))
+    }
+    l := &gltfLoader{doc: doc, dir: dir, glbBin: glbBin,
+        mesh: &TriangleMesh{Objects: make([]*MeshObject, 0)},
+        model: &Model{Materials: make(map[string]*Material)},
+        opts: opts}
+    for _, ext := range doc.ExtensionsUsed {
+        l.warn("Unsupported glTF extension ignored: %s", ext)
+    }
+    if err = l.loadBuffers(); err != nil { return nil, err }
+    if err = l.loadMaterials(); err != nil { return nil, err }
+    if err = l.loadScene(); err != nil { return nil, err }
+    mesh := l.mesh
+    if len(mesh.Vertices) == 0 {
+        return nil, fmt.Errorf("glTF contains no triangle geometry")
+    }
+    if l.missingNormals { mesh.Normals = nil }
+    if l.missingTexCoords { mesh.TextureCoords = nil }
+    if !l.hasColors { mesh.Colors = nil }
+    if !opts.Index { unindex(mesh) }
+    l.model.Mesh = mesh
+    processTextures(l.model, opts)
+    return l.model, nil
+}
+
+func parseGLB(data []byte) ([]byte, []byte, error) {
+    le := binary.LittleEndian
+    if le.Uint32(data[4:]) != 2 {
+        return nil, nil, fmt.Errorf("Unsupported GLB version %d",
+            le.Uint32(data[4:]))
+    }
+    var jsonData, bin []byte
+    for offset := 12; offset + 8 <= len(data); {
+        length := int(le.Uint32(data[offset:]))
+        chunkType := le.Uint32(data[offset+4:])
+        offset += 8
+        if length < 0 || offset + length > len(data) {
+            return nil, nil, fmt.Errorf("Invalid GLB chunk length")
+        }
+        switch chunkType {
+        case glbChunkJSON:
+            jsonData = data[offset:offset+length]
+        case glbChunkBIN:
+            bin = data[offset:offset+length]
+        }
+        offset += length
+    }
+    if jsonData == nil {
+        return nil, nil, fmt.Errorf("GLB without JSON chunk")
+    }
+    return jsonData, bin, nil
+}
+
+type gltfLoader struct {
+    doc *gltfDocument
+    dir string
+    glbBin []byte
+    buffers [][]byte
+    materialNames []string
+    mesh *TriangleMesh
+    model *Model
+    opts *LoadOptions
+    // Set if some primitive lacks the attribute, in which case it is
+    // dropped from the whole mesh.
+    missingNormals bool
+    missingTexCoords bool
+    hasColors bool
+}
+
+func (l *gltfLoader) warn(format string, args ...interface{}) {
+    l.model.Warnings = append(l.model.Warnings, fmt.Sprintf(format, args...))
+}
+
+// readURI returns the data referenced by a data URI or a file relative to
+// the glTF file.
+func (l *gltfLoader) readURI(uri string) ([]byte, error) {
+    if strings.HasPrefix(uri, "data:") {
+        comma := strings.Index(uri, ",")
+        if comma < 0 || !strings.HasSuffix(uri[:comma], ";base64") {
+            return nil, fmt.Errorf("Unsupported data URI")
+        }
+        return base64.StdEncoding.DecodeString(uri[comma+1:])
+    }
+    path, err := url.PathUnescape(uri)
+    if err != nil { return nil, err }
+    return os.ReadFile(makeAbsPath(l.dir, filepath.FromSlash(path)))
+}
+
+func (l *gltfLoader) loadBuffers() error {
+    l.buffers = make([][]byte, len(l.doc.Buffers))
+    for i, buf := range l.doc.Buffers {
+        var data []byte
+        if buf.URI == "" {
+            if i != 0 || l.glbBin == nil {
+                return fmt.Errorf("glTF buffer %d has no data", i)
+            }
+            data = l.glbBin
+        } else {
+            var err error
+            data, err = l.readURI(buf.URI)
+            if err != nil {
+                return fmt.Errorf("Can't load glTF buffer %d: %v", i, err)
+            }
+        }
+        if len(data) < buf.ByteLength {
+            return fmt.Errorf("glTF buffer %d is too short", i)
+        }
+        l.buffers[i] = data
+    }
+    return nil
+}
+
+// bufferViewData returns the bytes of a buffer view.
+func (l *gltfLoader) bufferViewData(idx int) ([]byte, *gltfBufferView,
+    error) {
+    if idx < 0 || idx >= len(l.doc.BufferViews) {
+        return nil, nil, fmt.Errorf("Invalid buffer view %d", idx)
+    }
+    view := l.doc.BufferViews[idx]
+    if view.Buffer < 0 || view.Buffer >= len(l.buffers) ||
+        view.ByteOffset < 0 || view.ByteLength < 0 || view.ByteStride < 0 ||
+        view.ByteOffset > len(l.buffers[view.Buffer]) ||
+        view.ByteLength > len(l.buffers[view.Buffer]) - view.ByteOffset {
+        return nil, nil, fmt.Errorf("Buffer view %d out of range", idx)
+    }
+    return l.buffers[view.Buffer][view.ByteOffset:
+        view.ByteOffset+view.ByteLength], view, nil
+}
+
+// accessorData validates an accessor and returns it with the number of
+// components per element and the accessor's bytes and stride within its
+// buffer view. The data is nil for accessors without buffer view.
+func (l *gltfLoader) accessorData(idx int) (*gltfAccessor, int, []byte,
+    int, error) {
+    if idx < 0 || idx >= len(l.doc.Accessors) {
+        return nil, 0, nil, 0, fmt.Errorf("Invalid accessor %d", idx)
+    }
+    acc := l.doc.Accessors[idx]
+    size := gltfTypeSizes[acc.Type]
+    compSize := gltfComponentSizes[acc.ComponentType]
+    if size == 0 || compSize == 0 {
+        return nil, 0, nil, 0, fmt.Errorf("Accessor %d: unsupported type",
+            idx)
+    }
+    if acc.Sparse != nil {
+        return nil, 0, nil, 0, fmt.Errorf("Accessor %d: sparse accessors "+
+            "aren't supported", idx)
+    }
+    if acc.Count < 0 || acc.Count > math.MaxInt32 || acc.ByteOffset < 0 {
+        return nil, 0, nil, 0, fmt.Errorf("Corrupt accessor %d", idx)
+    }
+    if acc.BufferView == nil { return acc, size, nil, 0, nil }
+    data, view, err := l.bufferViewData(*acc.BufferView)
+    if err != nil { return nil, 0, nil, 0, err }
+    elemSize := size * compSize
+    stride := view.ByteStride
+    if stride == 0 { stride = elemSize }
+    // offset + stride*(count-1) + elemSize <= len(data), without overflow
+    if acc.Count > 0 && (acc.ByteOffset > len(data) - elemSize ||
+        (len(data) - elemSize - acc.ByteOffset) / stride < acc.Count - 1) {
+        return nil, 0, nil, 0, fmt.Errorf("Accessor %d out of range", idx)
+    }
+    return acc, size, data[acc.ByteOffset:], stride, nil
+}
+
+// readAccessor returns the values of an accessor as floats, converting
+// normalized integers to 0..1 (or -1..1), together with the number of
+// components per element.
+func (l *gltfLoader) readAccessor(idx int) ([]float32, int, error) {
+    acc, size, data, stride, err := l.accessorData(idx)
+    if err != nil { return nil, 0, err }
+    values := make([]float32, acc.Count*size)
+    // Accessors without buffer view are initialised with zeros
+    if data == nil { return values, size, nil }
+    compSize := gltfComponentSizes[acc.ComponentType]
+    le := binary.LittleEndian
+    for i := 0; i < acc.Count; i++ {
+        elem := data[i*stride:]
+        for c := 0; c < size; c++ {
+            p := elem[c*compSize:]
+            var v float64
+            switch acc.ComponentType {
+            case gltfFloat:
+                v = float64(math.Float32frombits(le.Uint32(p)))
+            case gltfUnsignedInt:
+                v = float64(le.Uint32(p))
+            case gltfUnsignedShort:
+                v = float64(le.Uint16(p))
+                if acc.Normalized { v /= 65535 }
+            case gltfShort:
+                v = float64(int16(le.Uint16(p)))
+                if acc.Normalized { v = math.Max(v / 32767, -1) }
+            case gltfUnsignedByte:
+                v = float64(p[0])
+                if acc.Normalized { v /= 255 }
+            case gltfByte:
+                v = float64(int8(p[0]))
+                if acc.Normalized { v = math.Max(v / 127, -1) }
+            }
+            values[i*size+c] = float32(v)
+        }
+    }
+    return values, size, nil
+}
+
+// readIndices returns the values of an index accessor, which must hold
+// unsigned integer scalars. They are decoded directly, as float32 can't
+// represent indices above 2^24.
+func (l *gltfLoader) readIndices(idx int) ([]uint32, error) {
+    acc, size, data, stride, err := l.accessorData(idx)
+    if err != nil { return nil, err }
+    switch acc.ComponentType {
+    case gltfUnsignedByte, gltfUnsignedShort, gltfUnsignedInt:
+    default: size = 0
+    }
+    if size != 1 { return nil, fmt.Errorf("Invalid index accessor %d", idx) }
+    indices := make([]uint32, acc.Count)
+    if data == nil { return indices, nil }
+    le := binary.LittleEndian
+    for i := range indices {
+        p := data[i*stride:]
+        switch acc.ComponentType {
+        case gltfUnsignedInt: indices[i] = le.Uint32(p)
+        case gltfUnsignedShort: indices[i] = uint32(le.Uint16(p))
+        default: indices[i] = uint32(p[0])
+        }
+    }
+    return indices, nil
+}
+
+func (l *gltfLoader) loadMaterials() error {
+    used := make(map[string]bool)
+    for i, gm := range l.doc.Materials {
+        name := gm.Name
+        if name == "" { name = fmt.Sprintf("material%d", i) }
+        for base, n := name, 2; used[name]; n++ {
+            name = fmt.Sprintf("%s.%d", base, n)
+        }
+        used[name] = true
+        l.materialNames = append(l.materialNames, name)
+        mat := &Material{Name: name, Folder: l.dir,
+            Ka: []float32{0, 0, 0}, Kd: []float32{1, 1, 1},
+            Ks: []float32{0.04, 0.04, 0.04}, Tr: 1}
+        for ext := range gm.Extensions {
+            l.warn("Unsupported glTF extension ignored in material %s: %s",
+                name, ext)
+        }
+        if pbr := gm.PBR; pbr != nil {
+            alpha := 1.0
+            if len(pbr.BaseColorFactor) == 4 {
+                for c := 0; c < 3; c++ {
+                    mat.Kd[c] = float32(pbr.BaseColorFactor[c])
+                }
+                alpha = pbr.BaseColorFactor[3]
+            }
+            if gm.AlphaMode == "BLEND" { mat.Tr = float32(alpha) }
+            metallic, roughness := 1.0, 1.0
+            if pbr.MetallicFactor != nil { metallic = *pbr.MetallicFactor }
+            if pbr.RoughnessFactor != nil { roughness = *pbr.RoughnessFactor }
+            // Inverse of the mapping used by WriteGLTF
+            roughness = math.Max(roughness, 0.01)
+            mat.Ns = float32(math.Min(2 / (roughness*roughness) - 2, 1000))
+            for c := 0; c < 3; c++ {
+                mat.Ks[c] = float32(0.04 + (float64(mat.Kd[c]) - 0.04) *
+                    metallic)
+            }
+            if tex := pbr.BaseColorTexture; tex != nil {
+                ref, err := l.textureRef(tex.Index)
+                if err != nil { return err }
+                mat.KdMap = ref
+            }
+        }
+        l.model.Materials[name] = mat
+    }
+    return nil
+}
+
+// textureRef returns the texture map reference for a glTF texture: the
+// file path for external images, or an embedded texture key whose
+// decoded image is added to Model.Textures.
+func (l *gltfLoader) textureRef(idx int) (string, error) {
+    if idx < 0 || idx >= len(l.doc.Textures) ||
+        l.doc.Textures[idx].Source == nil ||
+        *l.doc.Textures[idx].Source < 0 ||
+        *l.doc.Textures[idx].Source >= len(l.doc.Images) {
+        return "", fmt.Errorf("Invalid glTF texture %d", idx)
+    }
+    imgIdx := *l.doc.Textures[idx].Source
+    img := l.doc.Images[imgIdx]
+    if img.URI != "" && !strings.HasPrefix(img.URI, "data:") {
+        path, err := url.PathUnescape(img.URI)
+        if err != nil { return "", err }
+        return filepath.FromSlash(path), nil
+    }
+    ref := fmt.Sprintf("%simage%d", embeddedTexturePrefix, imgIdx)
+    if !l.opts.LoadTextures { return ref, nil }
+    if _, ok := l.model.Textures[ref]; ok { return ref, nil }
+    var data []byte
+    var err error
+    if img.BufferView != nil {
+        data, _, err = l.bufferViewData(*img.BufferView)
+    } else {
+        data, err = l.readURI(img.URI)
+    }
+    if err != nil { return "", err }
+    decoded, err := DecodeTexture(bytes.NewReader(data), "")
+    if err != nil {
+        l.warn("Can't decode embedded glTF image %d: %v", imgIdx, err)
+        return ref, nil
+    }
+    if l.model.Textures == nil {
+        l.model.Textures = make(map[string]image.Image)
+    }
+    l.model.Textures[ref] = decoded
+    return ref, nil
+}
+
+func (l *gltfLoader) loadScene() error {
+    var roots []int
+    switch {
+    case len(l.doc.Scenes) > 0:
+        scene := 0
+        if l.doc.Scene != nil { scene = *l.doc.Scene }
+        if scene < 0 || scene >= len(l.doc.Scenes) {
+            return fmt.Errorf("Invalid glTF scene %d", scene)
+        }
+        roots = l.doc.Scenes[scene].Nodes
+    default:
+        // No scenes: treat every node that isn't a child as a root
+        isChild := make(map[int]bool)
+        for _, node := range l.doc.Nodes {
+            for _, c := range node.Children { isChild[c] = true }
+        }
+        for i := range l.doc.Nodes {
+            if !isChild[i] { roots = append(roots, i) }
+        }
+    }
+    visited := make(map[int]bool)
+    for _, root := range roots {
+        if err := l.loadNode(root, identityMat4, visited); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (l *gltfLoader) loadNode(idx int, parent mat4,
+    visited map[int]bool) error {
+    if idx < 0 || idx >= len(l.doc.Nodes) {
+        return fmt.Errorf("Invalid glTF node %d", idx)
+    }
+    if visited[idx] { return fmt.Errorf("glTF node %d visited twice", idx) }
+    visited[idx] = true
+    node := l.doc.Nodes[idx]
+    world := parent.mul(nodeMatrix(node))
+    if node.Mesh != nil {
+        if *node.Mesh < 0 || *node.Mesh >= len(l.doc.Meshes) {
+            return fmt.Errorf("Invalid glTF mesh %d", *node.Mesh)
+        }
+        gmesh := l.doc.Meshes[*node.Mesh]
+        name := node.Name
+        if name == "" { name = gmesh.Name }
+        if name == "" { name = fmt.Sprintf("node%d", idx) }
+        for p, prim := range gmesh.Primitives {
+            primName := name
+            if len(gmesh.Primitives) > 1 {
+                primName = fmt.Sprintf("%s_%d", name, p)
+            }
+            if err := l.loadPrimitive(primName, prim, world); err != nil {
+                return fmt.Errorf("glTF mesh %s: %v", name, err)
+            }
+        }
+    }
+    for _, child := range node.Children {
+        if err := l.loadNode(child, world, visited); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func nodeMatrix(node *gltfNode) mat4 {
+    if len(node.Matrix) == 16 {
+        var m mat4
+        copy(m[:], node.Matrix)
+        return m
+    }
+    t, r, s := [3]float64{}, [4]float64{0, 0, 0, 1}, [3]float64{1, 1, 1}
+    copy(t[:], node.Translation)
+    copy(r[:], node.Rotation)
+    copy(s[:], node.Scale)
+    return trsMat4(t, r, s)
+}
+
+func (l *gltfLoader) loadPrimitive(name string, prim *gltfPrimitive,
+    world mat4) error {
+    mode := gltfTriangles
+    if prim.Mode != nil { mode = *prim.Mode }
+    if mode < 4 || mode > 6 {
+        l.warn("Primitive %s skipped: points and lines aren't supported",
+            name)
+        return nil
+    }
+    for ext := range prim.Extensions {
+        l.warn("Unsupported glTF extension ignored in %s: %s", name, ext)
+    }
+    posIdx, ok := prim.Attributes["POSITION"]
+    if !ok { return fmt.Errorf("Primitive %s has no positions", name) }
+    positions, size, err := l.readAccessor(posIdx)
+    if err != nil { return err }
+    if size != 3 { return fmt.Errorf("Invalid POSITION accessor") }
+    count := len(positions) / 3
+    readAttr := func(key string, expected ...int) ([]float32, int, error) {
+        idx, ok := prim.Attributes[key]
+        if !ok { return nil, 0, nil }
+        values, size, err := l.readAccessor(idx)
+        if err != nil { return nil, 0, err }
+        for _, e := range expected {
+            if size == e && len(values) == count*size {
+                return values, size, nil
+            }
+        }
+        return nil, 0, fmt.Errorf("Invalid %s accessor", key)
+    }
+    normals, _, err := readAttr("NORMAL", 3)
+    if err != nil { return err }
+    texCoords, _, err := readAttr("TEXCOORD_0", 2)
+    if err != nil { return err }
+    colors, colorSize, err := readAttr("COLOR_0", 3, 4)
+    if err != nil { return err }
+
+    var indices []uint32
+    if prim.Indices != nil {
+        indices, err = l.readIndices(*prim.Indices)
+        if err != nil { return err }
+        for _, v := range indices {
+            if int(v) >= count { return fmt.Errorf("Index out of range") }
+        }
+    } else {
+        indices = make([]uint32, count)
+        for i := range indices { indices[i] = uint32(i) }
+    }
+    indices = triangulateGLTF(indices, mode)
+    if world.determinant3() < 0 {
+        for i := 0; i + 2 < len(indices); i += 3 {
+            indices[i+1], indices[i+2] = indices[i+2], indices[i+1]
+        }
+    }
+
+    mesh := l.mesh
+    first := uint32(len(mesh.Vertices) / 3)
+    identity := world.isIdentity()
+    normalMat := world.normalMatrix()
+    for v := 0; v < count; v++ {
+        p := [3]float32{positions[v*3], positions[v*3+1], positions[v*3+2]}
+        if !identity { p = world.transformPoint(p) }
+        mesh.Vertices = append(mesh.Vertices, p[:]...)
+        n := [3]float32{}
+        if normals != nil {
+            n = [3]float32{normals[v*3], normals[v*3+1], normals[v*3+2]}
+            if !identity { n = transformNormal(normalMat, n) }
+        }
+        mesh.Normals = append(mesh.Normals, n[:]...)
+        uv := [2]float32{}
+        if texCoords != nil {
+            uv = [2]float32{texCoords[v*2], 1 - texCoords[v*2+1]}
+        }
+        mesh.TextureCoords = append(mesh.TextureCoords, uv[:]...)
+        c := [4]float32{1, 1, 1, 1}
+        if colors != nil { copy(c[:], colors[v*colorSize:(v+1)*colorSize]) }
+        mesh.Colors = append(mesh.Colors, c[:]...)
+    }
+    if normals == nil { l.missingNormals = true }
+    if texCoords == nil { l.missingTexCoords = true }
+    if colors != nil { l.hasColors = true }
+
+    mo := &MeshObject{Name: name, VertexOffset: int32(len(mesh.VertexIndex)),
+        VertexCount: int32(len(indices))}
+    if prim.Material != nil {
+        if *prim.Material < 0 || *prim.Material >= len(l.materialNames) {
+            return fmt.Errorf("Invalid material %d", *prim.Material)
+        }
+        mo.MaterialRef = l.materialNames[*prim.Material]
+    }
+    mo.Smooth = normals != nil
+    for _, idx := range indices {
+        mesh.VertexIndex = append(mesh.VertexIndex, first + idx)
+    }
+    mesh.Objects = append(mesh.Objects, mo)
+    return nil
+}
+
+// triangulateGLTF converts triangle strips and fans to triangle lists.
+func triangulateGLTF(indices []uint32, mode int) []uint32 {
+    switch mode {
+    case 5:
+        result := make([]uint32, 0, len(indices)*3)
+        for i := 0; i + 2 < len(indices); i++ {
+            if i % 2 == 0 {
+                result = append(result, indices[i], indices[i+1], indices[i+2])
+            } else {
+                result = append(result, indices[i+1], indices[i], indices[i+2])
+            }
+        }
+        return result
+    case 6:
+        result := make([]uint32, 0, len(indices)*3)
+        for i := 1; i + 1 < len(indices); i++ {
+            result = append(result, indices[0], indices[i], indices[i+1])
+        }
+        return result
+    }
+    return indices[:len(indices) / 3 * 3]
+}
@@ -0,0 +1,422 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "image"
+    "image/color"
+    "image/png"
+    "math"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestWriteGLTF(t *testing.T) {
+    for _, index := range []bool{false, true} {
+        t.Logf("Testing: glTF Export (indexed: %t)", index)
+        mesh, materials, err := LoadOBJ("test-meshes/cubes.obj", index)
+        if err != nil { t.Error(err); return }
+        var buf bytes.Buffer
+        if err = WriteGLTF(&buf, mesh, materials, nil); err != nil {
+            t.Error(err)
+            return
+        }
+        doc := new(gltfDocument)
+        if err = json.Unmarshal(buf.Bytes(), doc); err != nil {
+            t.Error(err)
+            return
+        }
+        prefix := "data:application/octet-stream;base64,"
+        if len(doc.Buffers) != 1 ||
+            !strings.HasPrefix(doc.Buffers[0].URI, prefix) {
+            t.Error("Buffer not embedded")
+            return
+        }
+        bin, err := base64.StdEncoding.DecodeString(
+            doc.Buffers[0].URI[len(prefix):])
+        if err != nil { t.Error(err); return }
+        if err = validateGLTF(doc, bin); err != nil { t.Error(err); return }
+        if len(doc.Meshes) != 2 || doc.Meshes[0].Name != "redCube" ||
+            len(doc.Materials) != 2 {
+            t.Error("Unexpected meshes or materials")
+            return
+        }
+        red := doc.Materials[*doc.Meshes[0].Primitives[0].Material]
+        if red.Name != "redCube" ||
+            red.PBR.BaseColorFactor[0] != float64(float32(0.64)) {
+            t.Errorf("Unexpected material %v", red)
+        }
+        minX := float32(math.Inf(1))
+        for i := 0; i < len(mesh.Vertices); i += 3 {
+            if index || i < 36*3 {
+                minX = float32(math.Min(float64(minX),
+                    float64(mesh.Vertices[i])))
+            }
+        }
+        pos := doc.Accessors[doc.Meshes[0].Primitives[0].Attributes["POSITION"]]
+        if pos.Min[0] != float64(minX) || pos.Max[0] < pos.Min[0] {
+            t.Errorf("Unexpected bounds %v %v", pos.Min, pos.Max)
+        }
+    }
+}
+
+func TestWriteGLB(t *testing.T) {
+    t.Log("Testing: GLB Export (Embedded Texture)")
+    dir := t.TempDir()
+    img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+    img.Set(0, 0, color.NRGBA{255, 0, 0, 255})
+    f, err := os.Create(filepath.Join(dir, "bricks.diffuse.jpg.png"))
+    if err != nil { t.Fatal(err) }
+    png.Encode(f, img)
+    f.Close()
+    mesh, err := LoadOBJFrom(strings.NewReader(texplaneOBJ), true)
+    if err != nil { t.Error(err); return }
+    materials := map[string]*Material{
+        "Material": &Material{Name: "Material", Folder: dir,
+            Kd: []float32{1, 1, 1}, KdMap: "bricks.diffuse.jpg.png"},
+    }
+    var buf bytes.Buffer
+    err = WriteGLB(&buf, &mesh.TriangleMesh, materials,
+        &GLTFWriteOptions{EmbedTextures: true})
+    if err != nil { t.Error(err); return }
+    data := buf.Bytes()
+    le := binary.LittleEndian
+    if len(data) < 20 || le.Uint32(data) != glbMagic ||
+        le.Uint32(data[4:]) != 2 || int(le.Uint32(data[8:])) != len(data) {
+        t.Error("Invalid GLB header")
+        return
+    }
+    jsonLen := int(le.Uint32(data[12:]))
+    if jsonLen % 4 != 0 || le.Uint32(data[16:]) != glbChunkJSON {
+        t.Error("Invalid JSON chunk")
+        return
+    }
+    binStart := 20 + jsonLen
+    binLen := int(le.Uint32(data[binStart:]))
+    if le.Uint32(data[binStart+4:]) != glbChunkBIN ||
+        binStart + 8 + binLen != len(data) {
+        t.Error("Invalid BIN chunk")
+        return
+    }
+    doc := new(gltfDocument)
+    if err = json.Unmarshal(data[20:binStart], doc); err != nil {
+        t.Error(err)
+        return
+    }
+    if err = validateGLTF(doc, data[binStart+8:]); err != nil {
+        t.Error(err)
+        return
+    }
+    if len(doc.Images) != 1 || doc.Images[0].BufferView == nil ||
+        doc.Images[0].MimeType != "image/png" {
+        t.Error("Texture not embedded")
+        return
+    }
+    view := doc.BufferViews[*doc.Images[0].BufferView]
+    embedded, err := png.Decode(bytes.NewReader(
+        data[binStart+8+view.ByteOffset:][:view.ByteLength]))
+    if err != nil || embedded.Bounds().Dx() != 2 {
+        t.Error("Embedded texture can't be decoded")
+    }
+    // Texture coordinates are flipped vertically
+    tex := doc.Accessors[doc.Meshes[0].Primitives[0].Attributes["TEXCOORD_0"]]
+    off := doc.BufferViews[*tex.BufferView].ByteOffset
+    v := le.Uint32(data[binStart+8+off+4:])
+    if mesh.TextureCoords[1] != 1 - math.Float32frombits(v) {
+        t.Error("Texture coordinates not flipped")
+    }
+}
+
+// validateGLTF performs structural validation of a glTF document
+func validateGLTF(doc *gltfDocument, bin []byte) error {
+    if doc.Asset.Version != "2.0" { return fmt.Errorf("Invalid version") }
+    if len(doc.Buffers) != 1 || doc.Buffers[0].ByteLength > len(bin) {
+        return fmt.Errorf("Invalid buffer")
+    }
+    for i, view := range doc.BufferViews {
+        if view.Buffer != 0 || view.ByteOffset < 0 || view.ByteLength <= 0 ||
+            view.ByteOffset + view.ByteLength > doc.Buffers[0].ByteLength {
+            return fmt.Errorf("Buffer view %d out of range", i)
+        }
+    }
+    for i, acc := range doc.Accessors {
+        if acc.BufferView == nil || *acc.BufferView >= len(doc.BufferViews) {
+            return fmt.Errorf("Accessor %d: invalid buffer view", i)
+        }
+        view := doc.BufferViews[*acc.BufferView]
+        size := gltfTypeSizes[acc.Type] * gltfComponentSizes[acc.ComponentType]
+        if size == 0 || acc.Count <= 0 ||
+            acc.ByteOffset + acc.Count*size > view.ByteLength {
+            return fmt.Errorf("Accessor %d out of range", i)
+        }
+        if (view.ByteOffset + acc.ByteOffset) %
+            gltfComponentSizes[acc.ComponentType] != 0 {
+            return fmt.Errorf("Accessor %d misaligned", i)
+        }
+    }
+    for _, scene := range doc.Scenes {
+        for _, n := range scene.Nodes {
+            if n >= len(doc.Nodes) { return fmt.Errorf("Invalid node") }
+        }
+    }
+    for _, node := range doc.Nodes {
+        if node.Mesh != nil && *node.Mesh >= len(doc.Meshes) {
+            return fmt.Errorf("Invalid mesh reference")
+        }
+    }
+    for _, mesh := range doc.Meshes {
+        for _, prim := range mesh.Primitives {
+            posIdx, ok := prim.Attributes["POSITION"]
+            if !ok { return fmt.Errorf("Primitive without POSITION") }
+            pos := doc.Accessors[posIdx]
+            if len(pos.Min) != 3 || len(pos.Max) != 3 {
+                return fmt.Errorf("POSITION without bounds")
+            }
+            for name, idx := range prim.Attributes {
+                if idx >= len(doc.Accessors) ||
+                    doc.Accessors[idx].Count != pos.Count {
+                    return fmt.Errorf("Invalid attribute %s", name)
+                }
+            }
+            if prim.Material != nil && *prim.Material >= len(doc.Materials) {
+                return fmt.Errorf("Invalid material reference")
+            }
+            if prim.Indices == nil {
+                if pos.Count % 3 != 0 {
+                    return fmt.Errorf("Incomplete triangles")
+                }
+                continue
+            }
+            acc := doc.Accessors[*prim.Indices]
+            view := doc.BufferViews[*acc.BufferView]
+            data := bin[view.ByteOffset+acc.ByteOffset:]
+            for i := 0; i < acc.Count; i++ {
+                var v int
+                if acc.ComponentType == gltfUnsignedShort {
+                    v = int(binary.LittleEndian.Uint16(data[i*2:]))
+                } else {
+                    v = int(binary.LittleEndian.Uint32(data[i*4:]))
+                }
+                if v >= pos.Count {
+                    return fmt.Errorf("Index %d out of range", v)
+                }
+            }
+        }
+    }
+    for _, mat := range doc.Materials {
+        if mat.PBR != nil && mat.PBR.BaseColorTexture != nil &&
+            mat.PBR.BaseColorTexture.Index >= len(doc.Textures) {
+            return fmt.Errorf("Invalid texture reference")
+        }
+    }
+    for _, tex := range doc.Textures {
+        if tex.Source == nil || *tex.Source >= len(doc.Images) {
+            return fmt.Errorf("Invalid image reference")
+        }
+    }
+    return nil
+}
+
+func TestLoadGLTF(t *testing.T) {
+    mesh, materials, err := LoadOBJ("test-meshes/cubes.obj", true)
+    if err != nil { t.Error(err); return }
+    for _, glb := range []bool{false, true} {
+        t.Logf("Testing: glTF Import (GLB: %t)", glb)
+        var buf bytes.Buffer
+        if glb {
+            err = WriteGLB(&buf, mesh, materials, nil)
+        } else {
+            err = WriteGLTF(&buf, mesh, materials, nil)
+        }
+        if err != nil { t.Error(err); return }
+        model, err := LoadGLTFFrom(&buf, "", &LoadOptions{Index: true})
+        if err != nil { t.Error(err); return }
+        if len(model.Warnings) > 0 { t.Error(model.Warnings) }
+        loaded := model.Mesh
+        if len(loaded.Objects) != 2 || loaded.Objects[0].Name != "redCube" ||
+            loaded.Objects[0].MaterialRef != "redCube" {
+            t.Errorf("Unexpected objects %v", loaded.Objects)
+            return
+        }
+        if loaded.cornerCount() != mesh.cornerCount() {
+            t.Errorf("Expected %d corners, got %d", mesh.cornerCount(),
+                loaded.cornerCount())
+            return
+        }
+        for c := 0; c < mesh.cornerCount(); c++ {
+            a := mesh.position(mesh.vertexIndex(c))
+            b := loaded.position(loaded.vertexIndex(c))
+            if a != b {
+                t.Errorf("Corner %d: expected %v, got %v", c, a, b)
+                return
+            }
+        }
+        red := model.Materials["redCube"]
+        if red == nil || red.Kd[0] != materials["redCube"].Kd[0] ||
+            math.Abs(float64(red.Ns - materials["redCube"].Ns)) > 0.01 {
+            t.Errorf("Unexpected material %v", red)
+        }
+    }
+}
+
+func TestLoadGLTFNodes(t *testing.T) {
+    t.Log("Testing: glTF Import (Node Transforms)")
+    le := binary.LittleEndian
+    values := []float32{0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 2, 0, 0, 2}
+    bin := make([]byte, len(values)*4)
+    for i, v := range values {
+        le.PutUint32(bin[i*4:], math.Float32bits(v))
+    }
+    doc := fmt.Sprintf(`{
+        "asset": {"version": "2.0"},
+        "extensionsUsed": ["KHR_materials_emissive_strength"],
+        "scene": 0,
+        "scenes": [{"nodes": [0]}],
+        "nodes": [
+            {"name": "parent", "translation": [10, 0, 0], "children": [1]},
+            {"name": "child", "mesh": 0, "scale": [-1, 2, 1]}
+        ],
+        "meshes": [{"primitives": [{"attributes": {"POSITION": 0, "NORMAL": 1}}]}],
+        "accessors": [
+            {"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"},
+            {"bufferView": 0, "byteOffset": 36, "componentType": 5126,
+                "count": 3, "type": "VEC3"}
+        ],
+        "bufferViews": [{"buffer": 0, "byteLength": 72, "byteStride": 12}],
+        "buffers": [{"byteLength": 72,
+            "uri": "data:application/octet-stream;base64,%s"}]
+    }`, base64.StdEncoding.EncodeToString(bin))
+    model, err := LoadGLTFFrom(strings.NewReader(doc), "", nil)
+    if err != nil { t.Error(err); return }
+    if len(model.Warnings) != 1 {
+        t.Errorf("Expected extension warning, got %v", model.Warnings)
+    }
+    mesh := model.Mesh
+    if len(mesh.Objects) != 1 || mesh.Objects[0].Name != "child" ||
+        !mesh.Objects[0].Smooth {
+        t.Errorf("Unexpected objects %v", mesh.Objects)
+        return
+    }
+    // The mirroring scale flips the winding: (0,0,0), (0,1,0), (1,0,0)
+    // become (10,0,0), (10,2,0), (9,0,0).
+    expected := []float32{10, 0, 0, 10, 2, 0, 9, 0, 0}
+    for i, v := range expected {
+        if mesh.Vertices[i] != v {
+            t.Errorf("Expected vertices %v, got %v", expected, mesh.Vertices)
+            return
+        }
+    }
+    // Normals use the inverse transpose and stay normalised
+    if mesh.Normals[0] != 0 || mesh.Normals[2] != 1 {
+        t.Errorf("Unexpected normal %v", mesh.Normals[:3])
+    }
+    if mesh.Colors != nil || mesh.TextureCoords != nil {
+        t.Error("Absent attributes not dropped")
+    }
+    _, err = LoadGLTFFrom(strings.NewReader(`{"asset": {"version": "2.0"},
+        "extensionsRequired": ["KHR_draco_mesh_compression"]}`), "", nil)
+    if err == nil { t.Error("Required extension not rejected") }
+}
+
+func TestLoadGLBTexture(t *testing.T) {
+    t.Log("Testing: GLB Import (Embedded Texture)")
+    img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+    img.Set(0, 0, color.NRGBA{255, 0, 0, 255})
+    dir := t.TempDir()
+    f, err := os.Create(filepath.Join(dir, "tex.png"))
+    if err != nil { t.Fatal(err) }
+    png.Encode(f, img)
+    f.Close()
+    mesh, err := LoadOBJFrom(strings.NewReader(texplaneOBJ), true)
+    if err != nil { t.Error(err); return }
+    materials := map[string]*Material{
+        "Material": &Material{Name: "Material", Folder: dir,
+            Kd: []float32{1, 1, 1}, KdMap: "tex.png"},
+    }
+    var buf bytes.Buffer
+    err = WriteGLB(&buf, &mesh.TriangleMesh, materials,
+        &GLTFWriteOptions{EmbedTextures: true})
+    if err != nil { t.Error(err); return }
+    model, err := LoadGLTFFrom(bytes.NewReader(buf.Bytes()), "",
+        &LoadOptions{LoadTextures: true})
+    if err != nil { t.Error(err); return }
+    if len(model.Warnings) > 0 { t.Error(model.Warnings) }
+    ref := model.Materials["Material"].KdMap
+    tex := model.Textures[ref]
+    if !isEmbeddedTexture(ref) || tex == nil || tex.Bounds().Dx() != 2 {
+        t.Errorf("Embedded texture %q not loaded", ref)
+        return
+    }
+    if r, _, _, _ := tex.At(0, 0).RGBA(); r != 0xffff {
+        t.Error("Unexpected texture content")
+    }
+    // Texture coordinates are flipped back
+    for i, v := range model.Mesh.TextureCoords {
+        if v != mesh.TextureCoords[mesh.VertexIndex[i/2]*2 + uint32(i%2)] {
+            t.Error("Texture coordinates differ")
+            return
+        }
+    }
+
+    t.Log("Testing: GLB Export (Embedded Texture)")
+    for _, embed := range []bool{false, true} {
+        buf.Reset()
+        err = WriteGLB(&buf, model.Mesh, model.Materials,
+            &GLTFWriteOptions{EmbedTextures: embed,
+                Textures: model.Textures})
+        if err != nil { t.Error(err); return }
+        reloaded, err := LoadGLTFFrom(bytes.NewReader(buf.Bytes()), "",
+            &LoadOptions{LoadTextures: true})
+        if err != nil { t.Error(err); return }
+        tex := reloaded.Textures[reloaded.Materials["Material"].KdMap]
+        if tex == nil || tex.Bounds().Dx() != 2 {
+            t.Error("Embedded texture not written")
+        }
+    }
+    // Without the decoded image the texture is left out
+    var out bytes.Buffer
+    err = WriteGLTF(&out, model.Mesh, model.Materials,
+        &GLTFWriteOptions{EmbedTextures: true})
+    if err != nil { t.Error(err); return }
+    if strings.Contains(out.String(), "embedded:") ||
+        strings.Contains(out.String(), `"images"`) {
+        t.Error("Unexpected embedded texture reference")
+    }
+}
+
+func TestGLTFAccessorChecks(t *testing.T) {
+    t.Log("Testing: glTF Accessor Validation")
+    bin := make([]byte, 8)
+    binary.LittleEndian.PutUint32(bin, 1 << 24 + 1)
+    l := &gltfLoader{doc: &gltfDocument{
+        BufferViews: []*gltfBufferView{&gltfBufferView{ByteLength: 8},
+            &gltfBufferView{ByteOffset: -4, ByteLength: 8}},
+    }, buffers: [][]byte{bin}}
+    accessor := func(view, offset, count int) *gltfAccessor {
+        return &gltfAccessor{BufferView: intPtr(view), ByteOffset: offset,
+            ComponentType: gltfUnsignedInt, Count: count, Type: "SCALAR"}
+    }
+    l.doc.Accessors = []*gltfAccessor{accessor(0, 0, 2)}
+    indices, err := l.readIndices(0)
+    if err != nil || len(indices) != 2 || indices[0] != 1 << 24 + 1 {
+        t.Errorf("Unexpected indices %v, %v", indices, err)
+    }
+    for _, acc := range []*gltfAccessor{accessor(0, 0, -1),
+        accessor(0, -4, 1), accessor(0, 4, 2), accessor(1, 0, 1),
+        accessor(0, 0, math.MaxInt32)} {
+        l.doc.Accessors[0] = acc
+        if _, _, err = l.readAccessor(0); err == nil {
+            t.Errorf("Invalid accessor %v not rejected", *acc)
+        }
+    }
+    l.doc.Accessors[0] = accessor(0, 0, 2)
+    l.doc.Accessors[0].ComponentType = gltfFloat
+    if _, err = l.readIndices(0); err == nil {
+        t.Error("Float index accessor not rejected")
+    }
+}
@@ -0,0 +1,324 @@
+package go3dm
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "image"
+    "image/png"
+    "io"
+    "math"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// GLTFWriteOptions controls the output of WriteGLTF and WriteGLB.
+type GLTFWriteOptions struct {
+    // Embed texture images instead of referencing the texture files
+    EmbedTextures bool
+    // Directory referenced texture URIs are made relative to, usually the
+    // directory the glTF file is written to
+    TextureDir string
+    // If set, WriteGLTF writes the binary buffer to BufferWriter and
+    // references it as BufferURI instead of embedding it as a data URI
+    BufferWriter io.Writer
+    BufferURI string
+    // Decoded textures by reference, usually Model.Textures. Embedded
+    // textures have no file and are always embedded, encoded as PNG from
+    // these. Embedded textures missing here are left out.
+    Textures map[string]image.Image
+}
+
+// WriteGLTF writes mesh and the materials it references as a glTF 2.0
+// JSON document. Each mesh object becomes a mesh with a single primitive
+// and a node in the default scene. Phong materials are approximated with
+// pbrMetallicRoughness. A nil opts is equivalent to the zero
+// GLTFWriteOptions.
+func WriteGLTF(writer io.Writer, mesh *TriangleMesh,
+    materials map[string]*Material, opts *GLTFWriteOptions) error {
+    if opts == nil { opts = &GLTFWriteOptions{} }
+    doc, bin, err := buildGLTF(mesh, materials, opts, false)
+    if err != nil { return err }
+    buffer := doc.Buffers[0]
+    if opts.BufferWriter != nil {
+        if opts.BufferURI == "" {
+            return fmt.Errorf("BufferURI required with BufferWriter")
+        }
+        if _, err = opts.BufferWriter.Write(bin); err != nil { return err }
+        buffer.URI = opts.BufferURI
+    } else {
+        buffer.URI = "data:application/octet-stream;base64," +
+            base64.StdEncoding.EncodeToString(bin)
+    }
+    enc := json.NewEncoder(writer)
+    enc.SetIndent("", "  ")
+    return enc.Encode(doc)
+}
+
+// WriteGLB writes mesh and its materials as a binary glTF 2.0 file. See
+// WriteGLTF. Embedded textures are stored in the binary chunk.
+func WriteGLB(writer io.Writer, mesh *TriangleMesh,
+    materials map[string]*Material, opts *GLTFWriteOptions) error {
+    if opts == nil { opts = &GLTFWriteOptions{} }
+    doc, bin, err := buildGLTF(mesh, materials, opts, true)
+    if err != nil { return err }
+    jsonData, err := json.Marshal(doc)
+    if err != nil { return err }
+    for len(jsonData) % 4 != 0 { jsonData = append(jsonData, ' ') }
+    for len(bin) % 4 != 0 { bin = append(bin, 0) }
+    w := bufio.NewWriter(writer)
+    le := binary.LittleEndian
+    total := 12 + 8 + len(jsonData) + 8 + len(bin)
+    binary.Write(w, le, []uint32{glbMagic, 2, uint32(total)})
+    binary.Write(w, le, []uint32{uint32(len(jsonData)), glbChunkJSON})
+    w.Write(jsonData)
+    binary.Write(w, le, []uint32{uint32(len(bin)), glbChunkBIN})
+    w.Write(bin)
+    return w.Flush()
+}
+
+// gltfBuilder accumulates the binary buffer of a glTF document.
+type gltfBuilder struct {
+    doc *gltfDocument
+    bin bytes.Buffer
+}
+
+func (b *gltfBuilder) addBufferView(data []byte, target int) int {
+    for b.bin.Len() % 4 != 0 { b.bin.WriteByte(0) }
+    view := &gltfBufferView{Buffer: 0, ByteOffset: b.bin.Len(),
+        ByteLength: len(data), Target: target}
+    b.bin.Write(data)
+    b.doc.BufferViews = append(b.doc.BufferViews, view)
+    return len(b.doc.BufferViews) - 1
+}
+
+// addFloatAccessor adds an accessor for vectors of size components.
+func (b *gltfBuilder) addFloatAccessor(values []float32, size int,
+    withBounds bool) int {
+    data := make([]byte, len(values)*4)
+    for i, v := range values {
+        binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(v))
+    }
+    types := []string{"", "SCALAR", "VEC2", "VEC3", "VEC4"}
+    acc := &gltfAccessor{
+        BufferView: intPtr(b.addBufferView(data, gltfArrayBuffer)),
+        ComponentType: gltfFloat,
+        Count: len(values) / size,
+        Type: types[size],
+    }
+    if withBounds && acc.Count > 0 {
+        acc.Min = make([]float64, size)
+        acc.Max = make([]float64, size)
+        for c := 0; c < size; c++ {
+            acc.Min[c], acc.Max[c] = math.Inf(1), math.Inf(-1)
+        }
+        for i, v := range values {
+            c := i % size
+            acc.Min[c] = math.Min(acc.Min[c], float64(v))
+            acc.Max[c] = math.Max(acc.Max[c], float64(v))
+        }
+    }
+    b.doc.Accessors = append(b.doc.Accessors, acc)
+    return len(b.doc.Accessors) - 1
+}
+
+func (b *gltfBuilder) addIndexAccessor(indices []uint32,
+    vertexCount int) int {
+    var data []byte
+    componentType := gltfUnsignedInt
+    if vertexCount <= 65535 {
+        componentType = gltfUnsignedShort
+        data = make([]byte, len(indices)*2)
+        for i, v := range indices {
+            binary.LittleEndian.PutUint16(data[i*2:], uint16(v))
+        }
+    } else {
+        data = make([]byte, len(indices)*4)
+        for i, v := range indices {
+            binary.LittleEndian.PutUint32(data[i*4:], v)
+        }
+    }
+    acc := &gltfAccessor{
+        BufferView: intPtr(b.addBufferView(data, gltfElementArrayBuffer)),
+        ComponentType: componentType,
+        Count: len(indices),
+        Type: "SCALAR",
+    }
+    b.doc.Accessors = append(b.doc.Accessors, acc)
+    return len(b.doc.Accessors) - 1
+}
+
+func buildGLTF(mesh *TriangleMesh, materials map[string]*Material,
+    opts *GLTFWriteOptions, glb bool) (*gltfDocument, []byte, error) {
+    doc := &gltfDocument{
+        Asset: gltfAsset{Version: "2.0", Generator: "go3dm"},
+        Scene: intPtr(0),
+        Scenes: []*gltfScene{&gltfScene{Nodes: []int{}}},
+    }
+    b := &gltfBuilder{doc: doc}
+    vertexCount := len(mesh.Vertices) / 3
+    hasNormals := len(mesh.Normals) >= vertexCount*3
+    hasTex := len(mesh.TextureCoords) >= vertexCount*2
+    hasColors := len(mesh.Colors) >= vertexCount*4
+    objects := mesh.objects()
+
+    // glTF texture coordinates have their origin at the top left
+    var flippedTex []float32
+    if hasTex {
+        flippedTex = make([]float32, vertexCount*2)
+        for i := 0; i < vertexCount; i++ {
+            flippedTex[i*2] = mesh.TextureCoords[i*2]
+            flippedTex[i*2+1] = 1 - mesh.TextureCoords[i*2+1]
+        }
+    }
+    // addAttributes adds the vertex attributes of the vertex range
+    // first..first+count
+    addAttributes := func(first, count int) map[string]int {
+        attrs := make(map[string]int)
+        attrs["POSITION"] = b.addFloatAccessor(
+            mesh.Vertices[first*3:(first+count)*3], 3, true)
+        if hasNormals {
+            attrs["NORMAL"] = b.addFloatAccessor(
+                mesh.Normals[first*3:(first+count)*3], 3, false)
+        }
+        if hasTex {
+            attrs["TEXCOORD_0"] = b.addFloatAccessor(
+                flippedTex[first*2:(first+count)*2], 2, false)
+        }
+        if hasColors {
+            attrs["COLOR_0"] = b.addFloatAccessor(
+                mesh.Colors[first*4:(first+count)*4], 4, false)
+        }
+        return attrs
+    }
+    // Indexed meshes share one set of vertex attributes between all
+    // primitives.
+    var shared map[string]int
+    if mesh.VertexIndex != nil { shared = addAttributes(0, vertexCount) }
+
+    materialIndex := make(map[string]int)
+    imageIndex := make(map[string]int)
+    for _, mo := range objects {
+        if mo.VertexOffset < 0 || mo.VertexCount == 0 { continue }
+        prim := &gltfPrimitive{}
+        start, count := int(mo.VertexOffset), int(mo.VertexCount)
+        if mesh.VertexIndex != nil {
+            prim.Attributes = shared
+            prim.Indices = intPtr(b.addIndexAccessor(
+                mesh.VertexIndex[start:start+count], vertexCount))
+        } else {
+            prim.Attributes = addAttributes(start, count)
+        }
+        if mat, ok := materials[mo.MaterialRef]; ok {
+            idx, ok := materialIndex[mat.Name]
+            if !ok {
+                gm, err := gltfMaterialFrom(b, mat, imageIndex, opts, glb)
+                if err != nil { return nil, nil, err }
+                doc.Materials = append(doc.Materials, gm)
+                idx = len(doc.Materials) - 1
+                materialIndex[mat.Name] = idx
+            }
+            prim.Material = intPtr(idx)
+        }
+        doc.Meshes = append(doc.Meshes, &gltfMesh{Name: mo.Name,
+            Primitives: []*gltfPrimitive{prim}})
+        doc.Nodes = append(doc.Nodes, &gltfNode{Name: mo.Name,
+            Mesh: intPtr(len(doc.Meshes) - 1)})
+        doc.Scenes[0].Nodes = append(doc.Scenes[0].Nodes,
+            len(doc.Nodes) - 1)
+    }
+    for b.bin.Len() % 4 != 0 { b.bin.WriteByte(0) }
+    doc.Buffers = []*gltfBuffer{&gltfBuffer{ByteLength: b.bin.Len()}}
+    return doc, b.bin.Bytes(), nil
+}
+
+// gltfMaterialFrom converts a Phong material. The diffuse colour and
+// dissolve become the base colour, the specular exponent is mapped to
+// roughness and the material is treated as a dielectric.
+func gltfMaterialFrom(b *gltfBuilder, mat *Material,
+    imageIndex map[string]int, opts *GLTFWriteOptions,
+    glb bool) (*gltfMaterial, error) {
+    gm := &gltfMaterial{Name: mat.Name, PBR: &gltfPBR{}}
+    color := []float64{1, 1, 1, 1}
+    if len(mat.Kd) >= 3 {
+        for i := 0; i < 3; i++ { color[i] = float64(mat.Kd[i]) }
+    }
+    if opacity, translucent := materialOpacity(mat); translucent {
+        color[3] = float64(opacity)
+        gm.AlphaMode = "BLEND"
+    }
+    gm.PBR.BaseColorFactor = color
+    gm.PBR.MetallicFactor = float64Ptr(0)
+    gm.PBR.RoughnessFactor = float64Ptr(float64(materialRoughness(mat)))
+    if mat.KdMap != "" && (!isEmbeddedTexture(mat.KdMap) ||
+        opts.Textures[mat.KdMap] != nil) {
+        imgIdx, ok := imageIndex[mat.KdMap]
+        if !ok {
+            img, err := gltfImageFrom(b, mat, opts, glb)
+            if err != nil { return nil, err }
+            b.doc.Images = append(b.doc.Images, img)
+            b.doc.Textures = append(b.doc.Textures,
+                &gltfTexture{Source: intPtr(len(b.doc.Images) - 1)})
+            imgIdx = len(b.doc.Textures) - 1
+            imageIndex[mat.KdMap] = imgIdx
+        }
+        gm.PBR.BaseColorTexture = &gltfTextureInfo{Index: imgIdx}
+    }
+    return gm, nil
+}
+
+func gltfImageFrom(b *gltfBuilder, mat *Material, opts *GLTFWriteOptions,
+    glb bool) (*gltfImage, error) {
+    path := mat.KdMap
+    img := &gltfImage{Name: filepath.Base(normaliseTexturePath(
+        strings.TrimPrefix(path, embeddedTexturePrefix)))}
+    var data []byte
+    switch {
+    case isEmbeddedTexture(path):
+        var buf bytes.Buffer
+        if err := png.Encode(&buf, opts.Textures[path]); err != nil {
+            return nil, err
+        }
+        data = buf.Bytes()
+        img.MimeType = "image/png"
+    case !opts.EmbedTextures:
+        img.URI = filepath.ToSlash(relativeTexturePath(mat, path,
+            opts.TextureDir))
+        return img, nil
+    default:
+        if !filepath.IsAbs(path) && mat.Folder != "" {
+            path = makeAbsPath(mat.Folder, normaliseTexturePath(path))
+        }
+        var err error
+        if data, err = os.ReadFile(path); err != nil { return nil, err }
+        switch strings.ToLower(filepath.Ext(path)) {
+        case ".png":
+            img.MimeType = "image/png"
+        case ".jpg", ".jpeg":
+            img.MimeType = "image/jpeg"
+        default:
+            // Other formats aren't supported by glTF, convert to PNG
+            decoded, err := DecodeTexture(bytes.NewReader(data),
+                filepath.Ext(path))
+            if err != nil {
+                return nil, fmt.Errorf("Can't decode texture %s: %v", path,
+                    err)
+            }
+            var buf bytes.Buffer
+            if err = png.Encode(&buf, decoded); err != nil { return nil, err }
+            data = buf.Bytes()
+            img.MimeType = "image/png"
+        }
+    }
+    if glb {
+        img.BufferView = intPtr(b.addBufferView(data, 0))
+    } else {
+        img.URI = "data:" + img.MimeType + ";base64," +
+            base64.StdEncoding.EncodeToString(data)
+    }
+    return img, nil
+}
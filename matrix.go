@@ -0,0 +1,93 @@
+package go3dm
+
+import (
+    "math"
+)
+
+// mat4 is a 4x4 transformation matrix in column-major order, as used by
+// glTF and OpenGL.
+type mat4 [16]float64
+
+var identityMat4 = mat4{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+
+func (a mat4) mul(b mat4) mat4 {
+    var m mat4
+    for col := 0; col < 4; col++ {
+        for row := 0; row < 4; row++ {
+            sum := 0.0
+            for k := 0; k < 4; k++ {
+                sum += a[k*4+row] * b[col*4+k]
+            }
+            m[col*4+row] = sum
+        }
+    }
+    return m
+}
+
+// trsMat4 builds a matrix from a translation, a unit quaternion rotation
+// (x, y, z, w) and a scale.
+func trsMat4(t [3]float64, r [4]float64, s [3]float64) mat4 {
+    x, y, z, w := r[0], r[1], r[2], r[3]
+    return mat4{
+        (1 - 2*(y*y + z*z)) * s[0], 2*(x*y + z*w) * s[0],
+        2*(x*z - y*w) * s[0], 0,
+        2*(x*y - z*w) * s[1], (1 - 2*(x*x + z*z)) * s[1],
+        2*(y*z + x*w) * s[1], 0,
+        2*(x*z + y*w) * s[2], 2*(y*z - x*w) * s[2],
+        (1 - 2*(x*x + y*y)) * s[2], 0,
+        t[0], t[1], t[2], 1,
+    }
+}
+
+func (m mat4) transformPoint(p [3]float32) [3]float32 {
+    x, y, z := float64(p[0]), float64(p[1]), float64(p[2])
+    return [3]float32{
+        float32(m[0]*x + m[4]*y + m[8]*z + m[12]),
+        float32(m[1]*x + m[5]*y + m[9]*z + m[13]),
+        float32(m[2]*x + m[6]*y + m[10]*z + m[14]),
+    }
+}
+
+// normalMatrix returns the inverse transpose of the upper 3x3 part of m,
+// in column-major order, for transforming normals.
+func (m mat4) normalMatrix() [9]float64 {
+    a := [9]float64{m[0], m[1], m[2], m[4], m[5], m[6], m[8], m[9], m[10]}
+    // The cofactor matrix divided by the determinant equals the inverse
+    // transpose. c is laid out column-major like a.
+    c := [9]float64{
+        a[4]*a[8] - a[5]*a[7], a[5]*a[6] - a[3]*a[8], a[3]*a[7] - a[4]*a[6],
+        a[2]*a[7] - a[1]*a[8], a[0]*a[8] - a[2]*a[6], a[1]*a[6] - a[0]*a[7],
+        a[1]*a[5] - a[2]*a[4], a[2]*a[3] - a[0]*a[5], a[0]*a[4] - a[1]*a[3],
+    }
+    det := a[0]*c[0] + a[1]*c[1] + a[2]*c[2]
+    if det == 0 { return [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1} }
+    return [9]float64{
+        c[0]/det, c[1]/det, c[2]/det,
+        c[3]/det, c[4]/det, c[5]/det,
+        c[6]/det, c[7]/det, c[8]/det,
+    }
+}
+
+func transformNormal(n [9]float64, v [3]float32) [3]float32 {
+    x, y, z := float64(v[0]), float64(v[1]), float64(v[2])
+    return normalize3([3]float64{
+        n[0]*x + n[3]*y + n[6]*z,
+        n[1]*x + n[4]*y + n[7]*z,
+        n[2]*x + n[5]*y + n[8]*z,
+    })
+}
+
+// determinant3 returns the determinant of the upper 3x3 part of m. A
+// negative determinant mirrors geometry, flipping triangle winding.
+func (m mat4) determinant3() float64 {
+    return m[0]*(m[5]*m[10] - m[6]*m[9]) -
+        m[4]*(m[1]*m[10] - m[2]*m[9]) +
+        m[8]*(m[1]*m[6] - m[2]*m[5])
+}
+
+func (m mat4) isIdentity() bool {
+    for i := range m {
+        if math.Abs(m[i] - identityMat4[i]) > 1e-12 { return false }
+    }
+    return true
+}
@@ -0,0 +1,179 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "math"
+    "path/filepath"
+)
+
+// Quake II MD2 models
+
+const (
+    md2Magic = "IDP2"
+    md2Version = 8
+    md2HeaderSize = 68
+)
+
+func init() {
+    RegisterFormat(&Format{Name: "md2", Extensions: []string{".md2"},
+        Sniff: func(header []byte) bool {
+            return bytes.HasPrefix(header, []byte(md2Magic))
+        },
+        Load: LoadMD2})
+}
+
+// LoadMD2 loads a Quake II MD2 model. See LoadMD2From.
+func LoadMD2(md2Path string, opts *LoadOptions) (*Model, error) {
+    f, err := openFile(md2Path)
+    if err != nil { return nil, err }
+    defer f.Close()
+    return LoadMD2From(f, filepath.Dir(md2Path), opts)
+}
+
+// LoadMD2From loads a Quake II MD2 model. The mesh holds the first
+// keyframe, all keyframes are stored in its MorphFrames. Vertex normals
+// are computed from each frame's geometry. The model is converted from
+// Quake's Z up, clockwise convention to Y up and counter-clockwise
+// triangles. Each skin becomes a material textured with the skin image,
+// the mesh uses the first one. Skin paths are relative to dir. A nil
+// opts is equivalent to the zero LoadOptions.
+func LoadMD2From(reader io.Reader, dir string,
+    opts *LoadOptions) (*Model, error) {
+    if opts == nil { opts = &LoadOptions{} }
+    data, err := io.ReadAll(reader)
+    if err != nil { return nil, err }
+    if len(data) < md2HeaderSize || string(data[:4]) != md2Magic {
+        return nil, fmt.Errorf("Not an MD2 file")
+    }
+    var h [17]int32
+    binary.Read(bytes.NewReader(data[:md2HeaderSize]), binary.LittleEndian,
+        &h)
+    if h[1] != md2Version {
+        return nil, fmt.Errorf("Unsupported MD2 version %d", h[1])
+    }
+    skinWidth, skinHeight := float32(h[2]), float32(h[3])
+    frameSize := int(h[4])
+    numSkins, numXYZ, numST := int(h[5]), int(h[6]), int(h[7])
+    numTris, numFrames := int(h[8]), int(h[10])
+    skins, ok1 := dataSection(data, int(h[11]), numSkins, 64)
+    st, ok2 := dataSection(data, int(h[12]), numST, 4)
+    tris, ok3 := dataSection(data, int(h[13]), numTris, 12)
+    frames, ok4 := dataSection(data, int(h[14]), numFrames, frameSize)
+    if !ok1 || !ok2 || !ok3 || !ok4 || numFrames == 0 || numXYZ < 0 ||
+        numST < 0 || numTris < 0 || frameSize < 40 + numXYZ*4 {
+        return nil, fmt.Errorf("Corrupt MD2 file")
+    }
+    if skinWidth <= 0 { skinWidth = 1 }
+    if skinHeight <= 0 { skinHeight = 1 }
+
+    // Triangles index positions and texture coordinates separately, each
+    // combination becomes a vertex
+    le := binary.LittleEndian
+    vertexMap := make(map[[2]uint16]uint32)
+    vertexXYZ := make([]int, 0, numXYZ)
+    texCoords := make([]float32, 0, numXYZ*2)
+    index := make([]uint32, 0, numTris*3)
+    xyzIndex := make([]uint32, 0, numTris*3)
+    for t := 0; t < numTris; t++ {
+        tri := tris[t*12:]
+        // Reverse the winding
+        for _, c := range [3]int{0, 2, 1} {
+            key := [2]uint16{le.Uint16(tri[c*2:]), le.Uint16(tri[6+c*2:])}
+            if int(key[0]) >= numXYZ || int(key[1]) >= numST {
+                return nil, fmt.Errorf("MD2 triangle %d out of range", t)
+            }
+            v, ok := vertexMap[key]
+            if !ok {
+                v = uint32(len(vertexXYZ))
+                vertexMap[key] = v
+                vertexXYZ = append(vertexXYZ, int(key[0]))
+                coords := st[int(key[1])*4:]
+                s := float32(int16(le.Uint16(coords)))
+                tc := float32(int16(le.Uint16(coords[2:])))
+                texCoords = append(texCoords, s / skinWidth,
+                    1 - tc / skinHeight)
+            }
+            index = append(index, v)
+            xyzIndex = append(xyzIndex, uint32(key[0]))
+        }
+    }
+
+    mesh := &TriangleMesh{TextureCoords: texCoords, VertexIndex: index}
+    for f := 0; f < numFrames; f++ {
+        frame := frames[f*frameSize:]
+        var scale, translate [3]float32
+        for i := 0; i < 3; i++ {
+            scale[i] = math.Float32frombits(le.Uint32(frame[i*4:]))
+            translate[i] = math.Float32frombits(le.Uint32(frame[12+i*4:]))
+        }
+        positions := make([]float32, numXYZ*3)
+        for v := 0; v < numXYZ; v++ {
+            packed := frame[40+v*4:]
+            var p [3]float32
+            for i := 0; i < 3; i++ {
+                p[i] = float32(packed[i]) * scale[i] + translate[i]
+            }
+            copy(positions[v*3:], zUpToYUp(p))
+        }
+        // Compute normals before splitting vertices at texture seams
+        xyzMesh := &TriangleMesh{Vertices: positions, VertexIndex: xyzIndex}
+        computeVertexNormals(xyzMesh)
+        morph := &MorphFrame{Name: cString(frame[24:40])}
+        morph.Vertices = make([]float32, len(vertexXYZ)*3)
+        morph.Normals = make([]float32, len(vertexXYZ)*3)
+        for v, xyz := range vertexXYZ {
+            copy(morph.Vertices[v*3:v*3+3], positions[xyz*3:])
+            copy(morph.Normals[v*3:v*3+3], xyzMesh.Normals[xyz*3:])
+        }
+        mesh.MorphFrames = append(mesh.MorphFrames, morph)
+    }
+    mesh.Vertices = append([]float32(nil), mesh.MorphFrames[0].Vertices...)
+    mesh.Normals = append([]float32(nil), mesh.MorphFrames[0].Normals...)
+
+    materials := make(map[string]*Material)
+    materialRef := ""
+    for i := 0; i < numSkins; i++ {
+        name := cString(skins[i*64:i*64+64])
+        if name == "" { continue }
+        materials[name] = skinMaterial(name, name, dir)
+        if materialRef == "" { materialRef = name }
+    }
+    mesh.Objects = []*MeshObject{
+        &MeshObject{"md2", 0, int32(len(index)), materialRef, true}}
+    if !opts.Index { unindex(mesh) }
+    return meshModel(mesh, materials, opts), nil
+}
+
+// dataSection returns count elements of the given size at offset in
+// data, or false if they are out of range.
+func dataSection(data []byte, offset, count, size int) ([]byte, bool) {
+    if offset < 0 || count < 0 || size < 0 || offset > len(data) ||
+        count > 0 && size > (len(data) - offset) / count {
+        return nil, false
+    }
+    return data[offset:offset+count*size], true
+}
+
+// cString returns the NUL terminated string in b.
+func cString(b []byte) string {
+    if i := bytes.IndexByte(b, 0); i >= 0 { b = b[:i] }
+    return string(b)
+}
+
+// zUpToYUp converts a Z up position, as used by id Software's formats
+// and CAD tools, to Y up.
+func zUpToYUp(p [3]float32) []float32 {
+    return []float32{p[0], p[2], -p[1]}
+}
+
+// skinMaterial creates a white material textured with texture, which is
+// relative to dir.
+func skinMaterial(name, texture, dir string) *Material {
+    mat := colorMaterial(name, [3]float32{1, 1, 1})
+    mat.KdMap = texture
+    mat.Folder = dir
+    return mat
+}
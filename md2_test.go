@@ -0,0 +1,91 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/binary"
+    "testing"
+)
+
+// md2TestData builds an MD2 file with two triangles sharing an edge and
+// two keyframes.
+func md2TestData() []byte {
+    le := binary.LittleEndian
+    var body bytes.Buffer
+    skin := make([]byte, 64)
+    copy(skin, "skins/base.pcx")
+    body.Write(skin)
+    ofsST := md2HeaderSize + body.Len()
+    // s, t in pixels of a 64x32 skin
+    binary.Write(&body, le, []int16{0, 0, 64, 0, 64, 32, 0, 32})
+    ofsTris := md2HeaderSize + body.Len()
+    binary.Write(&body, le, []uint16{0, 1, 2, 0, 1, 2})
+    binary.Write(&body, le, []uint16{0, 2, 3, 3, 2, 1})
+    ofsFrames := md2HeaderSize + body.Len()
+    frameSize := 40 + 4*4
+    for f := 0; f < 2; f++ {
+        binary.Write(&body, le, []float32{1, 1, 1, float32(f), 0, 0})
+        name := make([]byte, 16)
+        copy(name, []string{"stand01", "run01"}[f])
+        body.Write(name)
+        // x y z and normal index
+        body.Write([]byte{0, 0, 0, 0, 2, 0, 0, 0, 2, 2, 0, 0, 0, 2, 0, 0})
+    }
+    header := []int32{0, md2Version, 64, 32, int32(frameSize), 1, 4, 4, 2,
+        0, 2, md2HeaderSize, int32(ofsST), int32(ofsTris), int32(ofsFrames),
+        0, int32(md2HeaderSize + body.Len())}
+    var buf bytes.Buffer
+    binary.Write(&buf, le, header)
+    copy(buf.Bytes(), md2Magic)
+    buf.Write(body.Bytes())
+    return buf.Bytes()
+}
+
+func TestLoadMD2(t *testing.T) {
+    t.Log("Testing: MD2 Import")
+    model, err := LoadMD2From(bytes.NewReader(md2TestData()), "models",
+        &LoadOptions{Index: true})
+    if err != nil { t.Error(err); return }
+    mesh := model.Mesh
+    // Quake's x, y, z becomes x, z, -y, triangles are reversed. Position
+    // 0 is split as it's used with different texture coordinates.
+    vertices := []float32{0, 0, 0, 2, 0, -2, 2, 0, 0, 0, 0, 0, 0, 0, -2}
+    texCoords := []float32{0, 1, 1, 0, 1, 1, 0, 0, 1, 1}
+    checkMesh(t, mesh, vertices, texCoords, mesh.Normals,
+        []uint32{0, 1, 2, 3, 4, 1},
+        []*MeshObject{&MeshObject{"md2", 0, 6, "skins/base.pcx", true}})
+    // The triangles face down, both copies of position 0 share a normal
+    for v := 0; v < 5; v++ {
+        if mesh.Normals[v*3+1] != -1 {
+            t.Errorf("Unexpected normals: %v", mesh.Normals)
+            break
+        }
+    }
+    if len(mesh.MorphFrames) != 2 || mesh.MorphFrames[1].Name != "run01" ||
+        mesh.MorphFrames[1].Vertices[3] != 3 ||
+        mesh.MorphFrames[0].Vertices[3] != 2 {
+        t.Errorf("Unexpected morph frames: %v", mesh.MorphFrames)
+    }
+    mat := model.Materials["skins/base.pcx"]
+    if mat == nil || mat.KdMap != "skins/base.pcx" || mat.Folder != "models" {
+        t.Errorf("Unexpected materials: %v", model.Materials)
+    }
+
+    model, err = LoadMD2From(bytes.NewReader(md2TestData()), "", nil)
+    if err != nil { t.Error(err); return }
+    if len(model.Mesh.Vertices) != 18 ||
+        len(model.Mesh.MorphFrames[1].Vertices) != 18 ||
+        len(model.Mesh.MorphFrames[1].Normals) != 18 {
+        t.Error("Morph frames not unindexed")
+    }
+
+    data := md2TestData()
+    data[md2HeaderSize+64+16] = 9
+    if _, err = LoadMD2From(bytes.NewReader(data), "", nil); err == nil {
+        t.Error("Out of range triangle not detected")
+    }
+    data = md2TestData()
+    binary.LittleEndian.PutUint32(data[24:], 0xffffffff)
+    if _, err = LoadMD2From(bytes.NewReader(data), "", nil); err == nil {
+        t.Error("Negative vertex count not detected")
+    }
+}
@@ -0,0 +1,159 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "math"
+    "path/filepath"
+)
+
+// Quake III MD3 models
+
+const (
+    md3Magic = "IDP3"
+    md3Version = 15
+    md3HeaderSize = 108
+)
+
+func init() {
+    RegisterFormat(&Format{Name: "md3", Extensions: []string{".md3"},
+        Sniff: func(header []byte) bool {
+            return bytes.HasPrefix(header, []byte(md3Magic))
+        },
+        Load: LoadMD3})
+}
+
+// LoadMD3 loads a Quake III MD3 model. See LoadMD3From.
+func LoadMD3(md3Path string, opts *LoadOptions) (*Model, error) {
+    f, err := openFile(md3Path)
+    if err != nil { return nil, err }
+    defer f.Close()
+    return LoadMD3From(f, filepath.Dir(md3Path), opts)
+}
+
+// LoadMD3From loads a Quake III MD3 model. Each surface becomes a mesh
+// object using a material named after the surface's first shader, which
+// is textured with the shader name if it is an image path relative to
+// dir. The mesh holds the first keyframe, all keyframes are stored in its
+// MorphFrames. The model is converted to Y up and counter-clockwise
+// triangles. Tags are ignored. A nil opts is equivalent to the zero
+// LoadOptions.
+func LoadMD3From(reader io.Reader, dir string,
+    opts *LoadOptions) (*Model, error) {
+    if opts == nil { opts = &LoadOptions{} }
+    data, err := io.ReadAll(reader)
+    if err != nil { return nil, err }
+    if len(data) < md3HeaderSize || string(data[:4]) != md3Magic {
+        return nil, fmt.Errorf("Not an MD3 file")
+    }
+    le := binary.LittleEndian
+    i32 := func(b []byte, offset int) int {
+        return int(int32(le.Uint32(b[offset:])))
+    }
+    if version := i32(data, 4); version != md3Version {
+        return nil, fmt.Errorf("Unsupported MD3 version %d", version)
+    }
+    numFrames, numTags := i32(data, 76), i32(data, 80)
+    numSurfaces := i32(data, 84)
+    frames, ok := dataSection(data, i32(data, 92), numFrames, 56)
+    if !ok || numFrames == 0 || numSurfaces < 0 {
+        return nil, fmt.Errorf("Corrupt MD3 file")
+    }
+
+    model := &Model{Materials: make(map[string]*Material)}
+    if numTags > 0 {
+        model.Warnings = append(model.Warnings, "MD3 tags ignored")
+    }
+    mesh := &TriangleMesh{}
+    for f := 0; f < numFrames; f++ {
+        mesh.MorphFrames = append(mesh.MorphFrames,
+            &MorphFrame{Name: cString(frames[f*56+40:f*56+56])})
+    }
+    offset := i32(data, 100)
+    for s := 0; s < numSurfaces; s++ {
+        if offset < 0 || offset > len(data) - md3HeaderSize ||
+            string(data[offset:offset+4]) != md3Magic {
+            return nil, fmt.Errorf("Corrupt MD3 surface %d", s)
+        }
+        surface := data[offset:]
+        name := cString(surface[4:68])
+        numVerts, numTris := i32(surface, 80), i32(surface, 84)
+        if i32(surface, 72) != numFrames {
+            return nil, fmt.Errorf("MD3 surface %s has %d frames, " +
+                "expected %d", name, i32(surface, 72), numFrames)
+        }
+        tris, ok1 := dataSection(surface, i32(surface, 88), numTris, 12)
+        shaders, ok2 := dataSection(surface, i32(surface, 92),
+            i32(surface, 76), 68)
+        st, ok3 := dataSection(surface, i32(surface, 96), numVerts, 8)
+        xyzn, ok4 := dataSection(surface, i32(surface, 100),
+            numVerts*numFrames, 8)
+        end := i32(surface, 104)
+        if !ok1 || !ok2 || !ok3 || !ok4 || end <= 0 ||
+            end > len(surface) {
+            return nil, fmt.Errorf("Corrupt MD3 surface %s", name)
+        }
+        offset += end
+
+        base := uint32(len(mesh.Vertices) / 3)
+        materialRef := ""
+        if len(shaders) > 0 {
+            materialRef = cString(shaders[:64])
+            texture := ""
+            if filepath.Ext(materialRef) != "" { texture = materialRef }
+            if _, ok := model.Materials[materialRef]; !ok {
+                model.Materials[materialRef] = skinMaterial(materialRef,
+                    texture, dir)
+            }
+        }
+        mesh.Objects = append(mesh.Objects, &MeshObject{name,
+            int32(len(mesh.VertexIndex)), int32(numTris*3), materialRef,
+            true})
+        for t := 0; t < numTris; t++ {
+            // Reverse the winding
+            for _, c := range [3]int{0, 2, 1} {
+                v := i32(tris, t*12+c*4)
+                if v < 0 || v >= numVerts {
+                    return nil, fmt.Errorf("MD3 surface %s: triangle %d " +
+                        "out of range", name, t)
+                }
+                mesh.VertexIndex = append(mesh.VertexIndex,
+                    base + uint32(v))
+            }
+        }
+        for v := 0; v < numVerts; v++ {
+            s := math.Float32frombits(le.Uint32(st[v*8:]))
+            t := math.Float32frombits(le.Uint32(st[v*8+4:]))
+            mesh.TextureCoords = append(mesh.TextureCoords, s, 1 - t)
+        }
+        for f, frame := range mesh.MorphFrames {
+            for v := 0; v < numVerts; v++ {
+                packed := xyzn[(f*numVerts+v)*8:]
+                var p [3]float32
+                for i := 0; i < 3; i++ {
+                    p[i] = float32(int16(le.Uint16(packed[i*2:]))) / 64
+                }
+                frame.Vertices = append(frame.Vertices, zUpToYUp(p)...)
+                frame.Normals = append(frame.Normals,
+                    zUpToYUp(md3Normal(packed[6], packed[7]))...)
+            }
+        }
+    }
+    mesh.Vertices = append([]float32(nil), mesh.MorphFrames[0].Vertices...)
+    mesh.Normals = append([]float32(nil), mesh.MorphFrames[0].Normals...)
+    if !opts.Index { unindex(mesh) }
+    model.Mesh = mesh
+    processTextures(model, opts)
+    return model, nil
+}
+
+// md3Normal decodes a normal packed as spherical coordinates, the polar
+// angle in the first byte and the azimuth in the second.
+func md3Normal(polar, azimuth byte) [3]float32 {
+    b := float64(polar) * 2 * math.Pi / 256
+    a := float64(azimuth) * 2 * math.Pi / 256
+    return [3]float32{float32(math.Cos(a) * math.Sin(b)),
+        float32(math.Sin(a) * math.Sin(b)), float32(math.Cos(b))}
+}
@@ -0,0 +1,82 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/binary"
+    "strings"
+    "testing"
+)
+
+// md3TestData builds an MD3 file with a single triangle surface and two
+// keyframes.
+func md3TestData() []byte {
+    le := binary.LittleEndian
+    var surface bytes.Buffer
+    name := make([]byte, 64)
+    copy(name, "body")
+    surface.WriteString(md3Magic)
+    surface.Write(name)
+    // flags, frames, shaders, vertices, triangles and offsets
+    binary.Write(&surface, le, []int32{0, 2, 1, 3, 1, 108, 120, 188, 212,
+        212 + 2*3*8})
+    binary.Write(&surface, le, []int32{0, 1, 2})
+    shader := make([]byte, 68)
+    copy(shader, "models/body.tga")
+    surface.Write(shader)
+    binary.Write(&surface, le, []float32{0, 0, 1, 0, 1, 1})
+    for f := 0; f < 2; f++ {
+        x := int16(64 * (f + 1))
+        // x y z in 1/64 units, normal pointing up in Quake's Z up space
+        binary.Write(&surface, le, []int16{0, 0, 0})
+        surface.Write([]byte{0, 0})
+        binary.Write(&surface, le, []int16{x, 0, 0})
+        surface.Write([]byte{0, 0})
+        binary.Write(&surface, le, []int16{x, x, 0})
+        surface.Write([]byte{0, 0})
+    }
+
+    var buf bytes.Buffer
+    buf.WriteString(md3Magic)
+    binary.Write(&buf, le, int32(md3Version))
+    buf.Write(make([]byte, 64))
+    // flags, frames, tags, surfaces, skins and offsets
+    ofsSurfaces := md3HeaderSize + 2*56
+    binary.Write(&buf, le, []int32{0, 2, 1, 1, 0, md3HeaderSize, 0,
+        int32(ofsSurfaces), int32(ofsSurfaces + surface.Len())})
+    for _, frameName := range []string{"idle", "walk"} {
+        buf.Write(make([]byte, 40))
+        name := make([]byte, 16)
+        copy(name, frameName)
+        buf.Write(name)
+    }
+    buf.Write(surface.Bytes())
+    return buf.Bytes()
+}
+
+func TestLoadMD3(t *testing.T) {
+    t.Log("Testing: MD3 Import")
+    model, err := LoadMD3From(bytes.NewReader(md3TestData()), "",
+        &LoadOptions{Index: true})
+    if err != nil { t.Error(err); return }
+    mesh := model.Mesh
+    checkMesh(t, mesh, []float32{0, 0, 0, 1, 0, 0, 1, 0, -1},
+        []float32{0, 1, 1, 1, 1, 0}, []float32{0, 1, 0, 0, 1, 0, 0, 1, 0},
+        []uint32{0, 2, 1},
+        []*MeshObject{&MeshObject{"body", 0, 3, "models/body.tga", true}})
+    if len(mesh.MorphFrames) != 2 || mesh.MorphFrames[1].Name != "walk" ||
+        mesh.MorphFrames[1].Vertices[8] != -2 {
+        t.Errorf("Unexpected morph frames: %v", mesh.MorphFrames)
+    }
+    if mat := model.Materials["models/body.tga"];
+        mat == nil || mat.KdMap != "models/body.tga" {
+        t.Errorf("Unexpected materials: %v", model.Materials)
+    }
+    if len(model.Warnings) != 1 ||
+        !strings.Contains(model.Warnings[0], "tags") {
+        t.Errorf("Unexpected warnings: %v", model.Warnings)
+    }
+
+    if n := md3Normal(64, 0); n[0] < 0.999 || n[2] > 1e-6 {
+        t.Errorf("Unexpected decoded normal: %v", n)
+    }
+}
@@ -0,0 +1,353 @@
+package go3dm
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "math"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// id Tech 4 MD5 meshes
+
+func init() {
+    RegisterFormat(&Format{Name: "md5mesh", Extensions: []string{".md5mesh"},
+        Sniff: func(header []byte) bool {
+            return firstToken(header) == "MD5Version"
+        },
+        Load: LoadMD5Mesh})
+}
+
+// LoadMD5Mesh loads an MD5 mesh file. See LoadMD5MeshFrom.
+func LoadMD5Mesh(md5Path string, opts *LoadOptions) (*Model, error) {
+    f, err := openFile(md5Path)
+    if err != nil { return nil, err }
+    defer f.Close()
+    return LoadMD5MeshFrom(f, filepath.Dir(md5Path), opts)
+}
+
+type md5Weight struct {
+    joint int
+    bias float32
+    position [3]float32
+}
+
+type md5Vertex struct {
+    texCoord [2]float32
+    start, count int
+}
+
+// LoadMD5MeshFrom loads an MD5 mesh (version 10) in its bind pose. The
+// skeleton is stored in Model.Joints and each vertex's four most
+// influential joints and their weights in the JointsAttribute and
+// WeightsAttribute vertex attributes. Each mesh becomes a mesh object
+// using a material named after its shader, which is textured with the
+// shader name if it is an image path relative to dir. Normals are
+// computed from the geometry. The model is converted to Y up and
+// counter-clockwise triangles. A nil opts is equivalent to the zero
+// LoadOptions.
+func LoadMD5MeshFrom(reader io.Reader, dir string,
+    opts *LoadOptions) (*Model, error) {
+    if opts == nil { opts = &LoadOptions{} }
+    p, err := newMD5Parser(reader)
+    if err != nil { return nil, err }
+    model := &Model{Mesh: &TriangleMesh{},
+        Materials: make(map[string]*Material)}
+    mesh := model.Mesh
+    joints := &VertexAttribute{Name: JointsAttribute, Size: 4}
+    weights := &VertexAttribute{Name: WeightsAttribute, Size: 4}
+    truncated := false
+    for !p.done() && p.err == nil {
+        switch keyword := p.next(); keyword {
+        case "MD5Version":
+            if version := p.integer(); version != 10 && p.err == nil {
+                return nil, fmt.Errorf("Unsupported MD5 version %d",
+                    version)
+            }
+        case "commandline":
+            p.next()
+        case "numJoints", "numMeshes":
+            p.integer()
+        case "joints":
+            p.expect("{")
+            for p.err == nil && p.peek() != "}" {
+                joint := &Joint{Name: p.next(), Parent: p.integer()}
+                position := p.vector(3)
+                q := p.vector(3)
+                // The real part is implied, negative by convention
+                w := 1 - q[0]*q[0] - q[1]*q[1] - q[2]*q[2]
+                if w < 0 {
+                    w = 0
+                } else {
+                    w = -float32(math.Sqrt(float64(w)))
+                }
+                copy(joint.Position[:], zUpToYUp([3]float32{position[0],
+                    position[1], position[2]}))
+                joint.Orientation = [4]float32{q[0], q[2], -q[1], w}
+                if joint.Parent < -1 ||
+                    joint.Parent >= len(model.Joints) {
+                    return nil, fmt.Errorf("MD5 joint %s: invalid parent %d",
+                        joint.Name, joint.Parent)
+                }
+                model.Joints = append(model.Joints, joint)
+            }
+            p.expect("}")
+        case "mesh":
+            t, err := p.mesh(model, joints, weights, dir)
+            if err != nil { return nil, err }
+            truncated = truncated || t
+        default:
+            if p.err == nil {
+                return nil, fmt.Errorf("MD5 line %d: unexpected %q",
+                    p.line, keyword)
+            }
+        }
+    }
+    if p.err != nil { return nil, p.err }
+    if truncated {
+        model.Warnings = append(model.Warnings,
+            "MD5 vertex weights limited to four joints")
+    }
+    if len(mesh.Vertices) > 0 {
+        mesh.Attributes = []*VertexAttribute{joints, weights}
+        computeWeldedNormals(mesh)
+    }
+    if !opts.Index { unindex(mesh) }
+    processTextures(model, opts)
+    return model, nil
+}
+
+// mesh parses a mesh block, appending it to model. It reports whether
+// vertex weights had to be dropped.
+func (p *md5Parser) mesh(model *Model, joints, weights *VertexAttribute,
+    dir string) (bool, error) {
+    p.expect("{")
+    shader := ""
+    vertices := make([]md5Vertex, 0)
+    triangles := make([][3]int, 0)
+    meshWeights := make([]md5Weight, 0)
+    for p.err == nil && p.peek() != "}" {
+        switch keyword := p.next(); keyword {
+        case "shader":
+            shader = p.next()
+        case "numverts", "numtris", "numweights":
+            p.integer()
+        case "vert":
+            p.integer()
+            tc := p.vector(2)
+            v := md5Vertex{texCoord: [2]float32{tc[0], tc[1]}}
+            v.start, v.count = p.integer(), p.integer()
+            vertices = append(vertices, v)
+        case "tri":
+            p.integer()
+            triangles = append(triangles,
+                [3]int{p.integer(), p.integer(), p.integer()})
+        case "weight":
+            p.integer()
+            w := md5Weight{joint: p.integer(), bias: p.float()}
+            copy(w.position[:], p.vector(3))
+            meshWeights = append(meshWeights, w)
+        default:
+            if p.err == nil {
+                return false, fmt.Errorf("MD5 line %d: unexpected %q",
+                    p.line, keyword)
+            }
+        }
+    }
+    p.expect("}")
+    if p.err != nil { return false, p.err }
+
+    mesh := model.Mesh
+    if shader != "" {
+        if _, ok := model.Materials[shader]; !ok {
+            texture := ""
+            if filepath.Ext(shader) != "" { texture = shader }
+            model.Materials[shader] = skinMaterial(shader, texture, dir)
+        }
+    }
+    name := fmt.Sprintf("mesh%d", len(mesh.Objects))
+    mesh.Objects = append(mesh.Objects, &MeshObject{name,
+        int32(len(mesh.VertexIndex)), int32(len(triangles)*3), shader, true})
+    base := uint32(len(mesh.Vertices) / 3)
+    for t, tri := range triangles {
+        // Reverse the winding
+        for _, v := range [3]int{tri[0], tri[2], tri[1]} {
+            if v < 0 || v >= len(vertices) {
+                return false, fmt.Errorf("MD5 mesh %s: triangle %d out of " +
+                    "range", name, t)
+            }
+            mesh.VertexIndex = append(mesh.VertexIndex, base + uint32(v))
+        }
+    }
+    truncated := false
+    for i, v := range vertices {
+        if v.start < 0 || v.count < 0 ||
+            v.start > len(meshWeights) ||
+            v.count > len(meshWeights) - v.start {
+            return false, fmt.Errorf("MD5 mesh %s: vertex %d weights out " +
+                "of range", name, i)
+        }
+        vertexWeights := meshWeights[v.start:v.start+v.count]
+        var position [3]float32
+        for _, w := range vertexWeights {
+            if w.joint < 0 || w.joint >= len(model.Joints) {
+                return false, fmt.Errorf("MD5 mesh %s: invalid joint %d",
+                    name, w.joint)
+            }
+            joint := model.Joints[w.joint]
+            // Joints were converted to Y up, so convert the offset, too
+            var offset [3]float32
+            copy(offset[:], zUpToYUp(w.position))
+            var t [3]float64
+            var q [4]float64
+            for c := 0; c < 3; c++ { t[c] = float64(joint.Position[c]) }
+            for c := 0; c < 4; c++ { q[c] = float64(joint.Orientation[c]) }
+            moved := trsMat4(t, q, [3]float64{1, 1, 1}).transformPoint(
+                offset)
+            for c := 0; c < 3; c++ { position[c] += moved[c] * w.bias }
+        }
+        mesh.Vertices = append(mesh.Vertices, position[:]...)
+        mesh.TextureCoords = append(mesh.TextureCoords, v.texCoord[0],
+            1 - v.texCoord[1])
+
+        // Sum the weights per joint, keeping the four largest
+        influences := make([]md5Weight, 0, len(vertexWeights))
+        for _, w := range vertexWeights {
+            merged := false
+            for j := range influences {
+                if influences[j].joint == w.joint {
+                    influences[j].bias += w.bias
+                    merged = true
+                }
+            }
+            if !merged { influences = append(influences, w) }
+        }
+        sort.SliceStable(influences, func(i, j int) bool {
+            return influences[i].bias > influences[j].bias
+        })
+        if len(influences) > 4 {
+            influences = influences[:4]
+            truncated = true
+        }
+        var sum float32
+        for _, w := range influences { sum += w.bias }
+        for c := 0; c < 4; c++ {
+            var joint, weight float32
+            if c < len(influences) && sum > 0 {
+                joint = float32(influences[c].joint)
+                weight = influences[c].bias / sum
+            }
+            joints.Values = append(joints.Values, joint)
+            weights.Values = append(weights.Values, weight)
+        }
+    }
+    return truncated, nil
+}
+
+// md5Parser splits MD5 files into tokens: words, quoted strings and
+// brackets. Comments start with "//". Errors are recorded in err, after
+// which zero values are returned.
+type md5Parser struct {
+    tokens []string
+    lines []int
+    pos int
+    line int
+    err error
+}
+
+func newMD5Parser(reader io.Reader) (*md5Parser, error) {
+    p := &md5Parser{}
+    scanner := bufio.NewScanner(reader)
+    scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+    for lineNo := 1; scanner.Scan(); lineNo++ {
+        line := scanner.Text()
+        for len(line) > 0 {
+            switch c := line[0]; {
+            case c == ' ' || c == '\t' || c == '\r':
+                line = line[1:]
+                continue
+            case strings.HasPrefix(line, "//"):
+                line = ""
+                continue
+            case c == '"':
+                end := strings.IndexByte(line[1:], '"')
+                if end < 0 {
+                    return nil, fmt.Errorf("MD5 line %d: unterminated string",
+                        lineNo)
+                }
+                p.tokens = append(p.tokens, line[1:end+1])
+                line = line[end+2:]
+            case strings.IndexByte("{}()", c) >= 0:
+                p.tokens = append(p.tokens, line[:1])
+                line = line[1:]
+            default:
+                end := strings.IndexAny(line, " \t\r\"{}()")
+                if end < 0 { end = len(line) }
+                p.tokens = append(p.tokens, line[:end])
+                line = line[end:]
+            }
+            p.lines = append(p.lines, lineNo)
+        }
+    }
+    if err := scanner.Err(); err != nil { return nil, err }
+    return p, nil
+}
+
+func (p *md5Parser) done() bool {
+    return p.pos >= len(p.tokens)
+}
+
+func (p *md5Parser) peek() string {
+    if p.err != nil || p.done() { return "" }
+    return p.tokens[p.pos]
+}
+
+func (p *md5Parser) next() string {
+    if p.err != nil { return "" }
+    if p.done() {
+        p.err = fmt.Errorf("Unexpected end of MD5 file")
+        return ""
+    }
+    p.line = p.lines[p.pos]
+    p.pos++
+    return p.tokens[p.pos-1]
+}
+
+func (p *md5Parser) expect(token string) {
+    if t := p.next(); t != token && p.err == nil {
+        p.err = fmt.Errorf("MD5 line %d: expected %q, got %q", p.line, token,
+            t)
+    }
+}
+
+func (p *md5Parser) integer() int {
+    t := p.next()
+    if p.err != nil { return 0 }
+    v, err := strconv.Atoi(t)
+    if err != nil {
+        p.err = fmt.Errorf("MD5 line %d: invalid integer %q", p.line, t)
+    }
+    return v
+}
+
+func (p *md5Parser) float() float32 {
+    t := p.next()
+    if p.err != nil { return 0 }
+    v, err := strconv.ParseFloat(t, 32)
+    if err != nil {
+        p.err = fmt.Errorf("MD5 line %d: invalid number %q", p.line, t)
+    }
+    return float32(v)
+}
+
+// vector parses n numbers in parentheses.
+func (p *md5Parser) vector(n int) []float32 {
+    v := make([]float32, n)
+    p.expect("(")
+    for i := range v { v[i] = p.float() }
+    p.expect(")")
+    return v
+}
@@ -0,0 +1,106 @@
+package go3dm
+
+import (
+    "math"
+    "strings"
+    "testing"
+)
+
+const md5TestMesh = `MD5Version 10
+commandline "exported for testing"
+
+numJoints 5
+numMeshes 1
+
+joints {
+	"origin"	-1 ( 0 0 0 ) ( 0 0 0 )		//
+	"head"	0 ( 0 0 2 ) ( 0 0 0.70710677 )		// origin
+	"a"	0 ( 0 0 0 ) ( 0 0 0 )		// origin
+	"b"	0 ( 0 0 0 ) ( 0 0 0 )		// origin
+	"c"	0 ( 0 0 0 ) ( 0 0 0 )		// origin
+}
+
+mesh {
+	// meshes: body
+	shader "textures/body.tga"
+
+	numverts 3
+	vert 0 ( 0 0 ) 0 1
+	vert 1 ( 1 0 ) 1 1
+	vert 2 ( 0 1 ) 2 6
+
+	numtris 1
+	tri 0 0 1 2
+
+	numweights 8
+	weight 0 0 1 ( 0 0 0 )
+	weight 1 1 1 ( 1 0 0 )
+	weight 2 0 0.3 ( 1 0 0 )
+	weight 3 1 0.1 ( 0 0 0 )
+	weight 4 2 0.2 ( 1 0 0 )
+	weight 5 3 0.2 ( 1 0 0 )
+	weight 6 4 0.1 ( 1 0 0 )
+	weight 7 0 0.1 ( 1 0 0 )
+}
+`
+
+func checkFloats(t *testing.T, what string, values, expected []float32) {
+    if len(values) != len(expected) {
+        t.Errorf("%s: expected %v, got %v", what, expected, values)
+        return
+    }
+    for i := range values {
+        if math.Abs(float64(values[i] - expected[i])) > 1e-5 {
+            t.Errorf("%s: expected %v, got %v", what, expected, values)
+            return
+        }
+    }
+}
+
+func TestLoadMD5Mesh(t *testing.T) {
+    t.Log("Testing: MD5 Mesh Import")
+    model, err := LoadMD5MeshFrom(strings.NewReader(md5TestMesh), "",
+        &LoadOptions{Index: true})
+    if err != nil { t.Error(err); return }
+    mesh := model.Mesh
+    if len(model.Joints) != 5 || model.Joints[1].Name != "head" ||
+        model.Joints[1].Parent != 0 || model.Joints[0].Parent != -1 {
+        t.Errorf("Unexpected joints: %v", model.Joints)
+        return
+    }
+    // Quake's x, y, z becomes x, z, -y, also for quaternions
+    head := model.Joints[1]
+    checkFloats(t, "Joint position", head.Position[:], []float32{0, 2, 0})
+    checkFloats(t, "Joint orientation", head.Orientation[:],
+        []float32{0, 0.70710677, 0, -0.70710677})
+    // Vertex 1 is offset by 1 along the head's x axis, rotated -90
+    // degrees about Quake's z axis
+    checkFloats(t, "Vertices", mesh.Vertices,
+        []float32{0, 0, 0, 0, 2, 1, 0.9, 0.2, 0})
+    checkMesh(t, mesh, mesh.Vertices, []float32{0, 1, 1, 1, 0, 0},
+        mesh.Normals, []uint32{0, 2, 1},
+        []*MeshObject{&MeshObject{"mesh0", 0, 3, "textures/body.tga", true}})
+    if mat := model.Materials["textures/body.tga"];
+        mat == nil || mat.KdMap != "textures/body.tga" {
+        t.Errorf("Unexpected materials: %v", model.Materials)
+    }
+
+    joints := mesh.Attribute(JointsAttribute)
+    weights := mesh.Attribute(WeightsAttribute)
+    if joints == nil || weights == nil { t.Error("Missing weights"); return }
+    checkFloats(t, "Joints", joints.Values,
+        []float32{0, 0, 0, 0, 1, 0, 0, 0, 0, 2, 3, 1})
+    checkFloats(t, "Weights", weights.Values,
+        []float32{1, 0, 0, 0, 1, 0, 0, 0, 0.4/0.9, 0.2/0.9, 0.2/0.9, 0.1/0.9})
+    if len(model.Warnings) != 1 {
+        t.Errorf("Unexpected warnings: %v", model.Warnings)
+    }
+
+    bad := strings.Replace(md5TestMesh, "weight 7 0", "weight 7 5", 1)
+    _, err = LoadMD5MeshFrom(strings.NewReader(bad), "", nil)
+    if err == nil { t.Error("Invalid joint not detected") }
+    bad = strings.Replace(md5TestMesh, "vert 1 ( 1 0 ) 1 1",
+        "vert 1 ( 1 0 ) 1 9223372036854775807", 1)
+    _, err = LoadMD5MeshFrom(strings.NewReader(bad), "", nil)
+    if err == nil { t.Error("Overflowing weight range not detected") }
+}
@@ -74,7 +74,8 @@ func main() {
     if pkg == "" {
         flag.Usage()
         fmt.Fprintln(os.Stderr,
-            "Please specify a package name.\n")
+            "Please specify a package name.")
+        fmt.Fprintln(os.Stderr, "")
         return
     }
     if _, err := os.Stat(pkg); os.IsNotExist(err) {
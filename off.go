@@ -0,0 +1,290 @@
+package go3dm
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+)
+
+func init() {
+    RegisterFormat(&Format{Name: "off", Extensions: []string{".off"},
+        Sniff: func(header []byte) bool {
+            keyword := firstToken(header)
+            i := strings.Index(keyword, "OFF")
+            if i < 0 { return false }
+            prefix := strings.TrimPrefix(keyword[:i], "ST")
+            prefix = strings.TrimPrefix(prefix, "C")
+            return strings.TrimPrefix(prefix, "N") == ""
+        },
+        Load: func(path string, opts *LoadOptions) (*Model, error) {
+            mesh, materials, err := LoadOFF(path, opts.Index)
+            if err != nil { return nil, err }
+            return meshModel(mesh, materials, opts), nil
+        },
+        Save: func(path string, mesh *TriangleMesh,
+            materials map[string]*Material, opts *SaveOptions) error {
+            return writeFile(path, func(w io.Writer) error {
+                return WriteOFF(w, mesh, materials)
+            })
+        },
+    })
+}
+
+// LoadOFF loads an OFF, COFF, NOFF or STOFF file. See LoadOFFFrom.
+func LoadOFF(offPath string, index bool) (*TriangleMesh,
+    map[string]*Material, error) {
+    offFile, err := openFile(offPath)
+    if err != nil { return nil, nil, err }
+    defer offFile.Close()
+    return LoadOFFFrom(offFile, index)
+}
+
+// LoadOFFFrom loads ASCII Object File Format data. The header keyword's
+// ST, C and N prefixes select per-vertex texture coordinates, colours and
+// normals, which are mapped to the corresponding TriangleMesh fields.
+// Polygon faces are triangulated as fans. Faces with their own colour are
+// grouped into one mesh object per colour run, with a material per
+// colour. Colours are accepted both as 0..1 floats and 0..255 integers.
+// If index is false, the geometry is expanded to one vertex per triangle
+// corner.
+func LoadOFFFrom(reader io.Reader, index bool) (*TriangleMesh,
+    map[string]*Material, error) {
+    scanner := bufio.NewScanner(reader)
+    scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+    lineNo := 0
+    // nextLine returns the tokens of the next non-empty line, without
+    // comments
+    nextLine := func() ([]string, error) {
+        for scanner.Scan() {
+            lineNo++
+            line := scanner.Text()
+            if i := strings.IndexByte(line, '#'); i >= 0 { line = line[:i] }
+            if tokens := strings.Fields(line); len(tokens) > 0 {
+                return tokens, nil
+            }
+        }
+        if err := scanner.Err(); err != nil { return nil, err }
+        return nil, io.ErrUnexpectedEOF
+    }
+    tokens, err := nextLine()
+    if err != nil { return nil, nil, fmt.Errorf("Not an OFF file") }
+    var hasTexCoords, hasColors, hasNormals bool
+    keyword := tokens[0]
+    if i := strings.Index(keyword, "OFF"); i >= 0 {
+        prefix := keyword[:i]
+        hasTexCoords = strings.HasPrefix(prefix, "ST")
+        prefix = strings.TrimPrefix(prefix, "ST")
+        hasColors = strings.HasPrefix(prefix, "C")
+        prefix = strings.TrimPrefix(prefix, "C")
+        hasNormals = strings.HasPrefix(prefix, "N")
+        prefix = strings.TrimPrefix(prefix, "N")
+        if prefix != "" {
+            return nil, nil, fmt.Errorf("Unsupported OFF variant %s",
+                keyword)
+        }
+        if len(tokens) > 1 && tokens[1] == "BINARY" {
+            return nil, nil, fmt.Errorf("Binary OFF isn't supported")
+        }
+        // Some datasets (e.g. ModelNet) omit the line break after "OFF"
+        tokens = tokens[1:]
+        if rest := keyword[i+3:]; rest != "" {
+            tokens = append([]string{rest}, tokens...)
+        }
+        if len(tokens) == 0 {
+            if tokens, err = nextLine(); err != nil {
+                return nil, nil, fmt.Errorf("OFF: missing element counts")
+            }
+        }
+    }
+    if len(tokens) < 2 {
+        return nil, nil, fmt.Errorf("OFF: invalid element counts")
+    }
+    vertexCount, err1 := strconv.Atoi(tokens[0])
+    faceCount, err2 := strconv.Atoi(tokens[1])
+    if err1 != nil || err2 != nil || vertexCount <= 0 || faceCount < 0 {
+        return nil, nil, fmt.Errorf("OFF: invalid element counts")
+    }
+
+    // The counts aren't used for preallocation, as the data may not hold
+    // as many elements
+    mesh := &TriangleMesh{
+        Vertices: make([]float32, 0),
+        Objects: make([]*MeshObject, 0),
+    }
+    if hasNormals { mesh.Normals = make([]float32, 0) }
+    if hasColors { mesh.Colors = make([]float32, 0) }
+    if hasTexCoords { mesh.TextureCoords = make([]float32, 0) }
+    values := make([]float32, 0, 12)
+    for v := 0; v < vertexCount; v++ {
+        if tokens, err = nextLine(); err != nil {
+            return nil, nil, fmt.Errorf("OFF: missing vertices")
+        }
+        values = values[:0]
+        for _, token := range tokens {
+            f, err := strconv.ParseFloat(token, 32)
+            if err != nil {
+                return nil, nil, fmt.Errorf("OFF line %d: %v", lineNo, err)
+            }
+            values = append(values, float32(f))
+        }
+        expected := 3
+        if hasNormals { expected += 3 }
+        if hasTexCoords { expected += 2 }
+        colorSize := len(values) - expected
+        if len(values) < expected || hasColors &&
+            (colorSize < 3 || colorSize > 4) {
+            return nil, nil, fmt.Errorf("OFF line %d: invalid vertex", lineNo)
+        }
+        mesh.Vertices = append(mesh.Vertices, values[:3]...)
+        values = values[3:]
+        if hasNormals {
+            mesh.Normals = append(mesh.Normals, values[:3]...)
+            values = values[3:]
+        }
+        if hasColors {
+            rgba := offColor(tokens[len(tokens)-len(values):][:colorSize],
+                values[:colorSize])
+            mesh.Colors = append(mesh.Colors, rgba[:]...)
+            values = values[colorSize:]
+        }
+        if hasTexCoords {
+            mesh.TextureCoords = append(mesh.TextureCoords, values[:2]...)
+        }
+    }
+
+    materials := make(map[string]*Material)
+    mesh.VertexIndex = make([]uint32, 0)
+    var mo *MeshObject
+    for f := 0; f < faceCount; f++ {
+        if tokens, err = nextLine(); err != nil {
+            return nil, nil, fmt.Errorf("OFF: missing faces")
+        }
+        n, err := strconv.Atoi(tokens[0])
+        if err != nil || n < 0 || len(tokens) < n + 1 {
+            return nil, nil, fmt.Errorf("OFF line %d: invalid face", lineNo)
+        }
+        polygon := make([]uint32, n)
+        for i := range polygon {
+            idx, err := strconv.Atoi(tokens[i+1])
+            if err != nil || idx < 0 || idx >= vertexCount {
+                return nil, nil, fmt.Errorf("OFF line %d: invalid vertex "+
+                    "index %s", lineNo, tokens[i+1])
+            }
+            polygon[i] = uint32(idx)
+        }
+        // The optional face colour is either a colour map index, which
+        // is ignored, or RGB(A) values
+        materialRef := ""
+        if colorTokens := tokens[n+1:]; len(colorTokens) >= 3 {
+            colorValues := make([]float32, len(colorTokens))
+            for i, token := range colorTokens {
+                c, err := strconv.ParseFloat(token, 32)
+                if err != nil {
+                    return nil, nil, fmt.Errorf("OFF line %d: %v", lineNo,
+                        err)
+                }
+                colorValues[i] = float32(c)
+            }
+            rgba := offColor(colorTokens, colorValues)
+            rgb := [3]float32{rgba[0], rgba[1], rgba[2]}
+            materialRef = colorMaterialName(rgb)
+            if _, ok := materials[materialRef]; !ok {
+                materials[materialRef] = colorMaterial(materialRef, rgb)
+            }
+        }
+        if n < 3 { continue }
+        if mo == nil || mo.MaterialRef != materialRef {
+            mo = &MeshObject{"off", int32(len(mesh.VertexIndex)), 0,
+                materialRef, false}
+            mesh.Objects = append(mesh.Objects, mo)
+        }
+        for i := 1; i + 1 < n; i++ {
+            mesh.VertexIndex = append(mesh.VertexIndex,
+                polygon[0], polygon[i], polygon[i+1])
+        }
+        mo.VertexCount = int32(len(mesh.VertexIndex)) - mo.VertexOffset
+    }
+    if mesh.Normals != nil {
+        for _, mo := range mesh.Objects { mo.Smooth = true }
+    }
+    if len(mesh.VertexIndex) == 0 {
+        mesh.VertexIndex = nil
+        mesh.Points = true
+        return mesh, materials, nil
+    }
+    if !index { unindex(mesh) }
+    return mesh, materials, nil
+}
+
+// offColor converts 3 or 4 colour components to RGBA. Integer components
+// greater than 1 are interpreted as 0..255 values.
+func offColor(tokens []string, values []float32) [4]float32 {
+    rgba := [4]float32{0, 0, 0, 1}
+    copy(rgba[:], values)
+    integers := true
+    large := false
+    for i, token := range tokens {
+        if strings.ContainsAny(token, ".eE") { integers = false }
+        if values[i] > 1 { large = true }
+    }
+    if integers && large {
+        for i := range values { rgba[i] = values[i] / 255 }
+    }
+    return rgba
+}
+
+// WriteOFF writes mesh as an ASCII OFF file. The header keyword is
+// prefixed with ST, C and N if the mesh has texture coordinates, colours
+// and normals. If materials is not nil, faces of mesh objects whose
+// material is known are coloured with the material's diffuse colour.
+// Unindexed meshes are written with one vertex per triangle corner.
+func WriteOFF(writer io.Writer, mesh *TriangleMesh,
+    materials map[string]*Material) error {
+    vertexCount := len(mesh.Vertices) / 3
+    hasNormals := len(mesh.Normals) >= vertexCount*3
+    hasColors := len(mesh.Colors) >= vertexCount*4
+    hasTexCoords := len(mesh.TextureCoords) >= vertexCount*2
+    objects := mesh.objects()
+    faceCount := 0
+    for _, mo := range objects {
+        if mo.VertexOffset >= 0 { faceCount += int(mo.VertexCount / 3) }
+    }
+    w := bufio.NewWriter(writer)
+    keyword := "OFF"
+    if hasNormals { keyword = "N" + keyword }
+    if hasColors { keyword = "C" + keyword }
+    if hasTexCoords { keyword = "ST" + keyword }
+    fmt.Fprintf(w, "%s\n# written by go3dm\n%d %d 0\n", keyword,
+        vertexCount, faceCount)
+    writeValues := func(values []float32) {
+        for _, v := range values {
+            w.WriteByte(' ')
+            w.WriteString(formatF32(v, -1))
+        }
+    }
+    for v := 0; v < vertexCount; v++ {
+        w.WriteString(formatF32(mesh.Vertices[v*3], -1))
+        writeValues(mesh.Vertices[v*3+1:v*3+3])
+        if hasNormals { writeValues(mesh.Normals[v*3:v*3+3]) }
+        if hasColors { writeValues(mesh.Colors[v*4:v*4+4]) }
+        if hasTexCoords { writeValues(mesh.TextureCoords[v*2:v*2+2]) }
+        w.WriteByte('\n')
+    }
+    for _, mo := range objects {
+        var faceColor []float32
+        if mat, ok := materials[mo.MaterialRef]; ok && len(mat.Kd) >= 3 {
+            faceColor = mat.Kd[:3]
+        }
+        start := int(mo.VertexOffset)
+        for i := start; mo.VertexOffset >= 0 &&
+            i + 2 < start + int(mo.VertexCount); i += 3 {
+            fmt.Fprintf(w, "3 %d %d %d", mesh.vertexIndex(i),
+                mesh.vertexIndex(i+1), mesh.vertexIndex(i+2))
+            writeValues(faceColor)
+            w.WriteByte('\n')
+        }
+    }
+    return w.Flush()
+}
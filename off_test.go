@@ -0,0 +1,99 @@
+package go3dm
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+const coloredOFF = `COFF
+# a quad and a coloured triangle
+5 2 0
+0 0 0  255 0 0 255
+1 0 0  0 255 0 255
+1 1 0  0 0 255 255
+0 1 0  255 255 255 128
+2 2 0  0.5 0.5 0.5 1.0
+4 0 1 2 3
+3 1 4 2  1.0 0.0 0.0
+`
+
+func TestLoadOFF(t *testing.T) {
+    t.Log("Testing: COFF Quad")
+    mesh, materials, err := LoadOFFFrom(strings.NewReader(coloredOFF), true)
+    if err != nil { t.Error(err); return }
+    checkMesh(t, mesh,
+        []float32{0, 0, 0,  1, 0, 0,  1, 1, 0,  0, 1, 0,  2, 2, 0},
+        nil, nil,
+        []uint32{0, 1, 2,  0, 2, 3,  1, 4, 2},
+        []*MeshObject{
+            &MeshObject{"off", 0, 6, "", false},
+            &MeshObject{"off", 6, 3, "color_ff0000", false},
+        })
+    if len(mesh.Colors) != 20 || mesh.Colors[5] != 1 ||
+        mesh.Colors[15] != float32(128) / 255 || mesh.Colors[16] != 0.5 {
+        t.Errorf("Unexpected colours %v", mesh.Colors)
+    }
+    if len(materials) != 1 || materials["color_ff0000"].Kd[0] != 1 {
+        t.Errorf("Unexpected materials %v", materials)
+    }
+
+    t.Log("Testing: NOFF without line break after keyword")
+    noff := "NOFF3 1 0\n0 0 0 0 0 1\n1 0 0 0 0 1\n0 1 0 0 0 1\n3 0 1 2\n"
+    mesh, _, err = LoadOFFFrom(strings.NewReader(noff), false)
+    if err != nil { t.Error(err); return }
+    if len(mesh.Normals) != 9 || mesh.Normals[2] != 1 ||
+        mesh.VertexIndex != nil || !mesh.Objects[0].Smooth {
+        t.Error("Unexpected NOFF mesh")
+    }
+
+    _, _, err = LoadOFFFrom(strings.NewReader("OFF\n3 1 0\n0 0 0\n" +
+        "1 0 0\n0 1 0\n3 0 1 3\n"), true)
+    if err == nil { t.Error("Invalid index not rejected") }
+
+    _, _, err = LoadOFFFrom(strings.NewReader("OFF\n1099511627776 " +
+        "1099511627776 0\n0 0 0\n"), true)
+    if err == nil { t.Error("Excessive element counts not rejected") }
+}
+
+func TestOFFRoundTrip(t *testing.T) {
+    t.Log("Testing: OFF Round Trip")
+    source, materials, err := LoadOFFFrom(strings.NewReader(coloredOFF),
+        true)
+    if err != nil { t.Error(err); return }
+    var buf bytes.Buffer
+    if err = WriteOFF(&buf, source, materials); err != nil {
+        t.Error(err)
+        return
+    }
+    if !strings.HasPrefix(buf.String(), "COFF\n") {
+        t.Errorf("Unexpected header in %q", buf.String())
+    }
+    mesh, loadedMaterials, err := LoadOFFFrom(&buf, true)
+    if err != nil { t.Error(err); return }
+    checkMesh(t, mesh, source.Vertices, nil, nil, source.VertexIndex,
+        source.Objects)
+    for i, c := range source.Colors {
+        if mesh.Colors[i] != c {
+            t.Errorf("Colour %d: expected %f, got %f", i, c, mesh.Colors[i])
+            return
+        }
+    }
+    if _, ok := loadedMaterials["color_ff0000"]; !ok {
+        t.Error("Face colour not written")
+    }
+
+    t.Log("Testing: STNOFF Export")
+    obj, err := LoadOBJFrom(strings.NewReader(texplaneOBJ), true)
+    if err != nil { t.Error(err); return }
+    buf.Reset()
+    if err = WriteOFF(&buf, &obj.TriangleMesh, nil); err != nil {
+        t.Error(err)
+        return
+    }
+    mesh, _, err = LoadOFFFrom(&buf, true)
+    if err != nil { t.Error(err); return }
+    checkMesh(t, mesh, obj.Vertices, obj.TextureCoords, obj.Normals,
+        obj.VertexIndex, []*MeshObject{
+            &MeshObject{"off", 0, int32(len(obj.VertexIndex)), "", true}})
+}
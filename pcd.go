@@ -0,0 +1,372 @@
+package go3dm
+
+import (
+    "bufio"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// Point Cloud Library PCD point clouds
+
+func init() {
+    RegisterFormat(&Format{Name: "pcd", Extensions: []string{".pcd"},
+        Sniff: func(header []byte) bool {
+            text := string(header)
+            return strings.HasPrefix(text, "# .PCD") ||
+                firstToken(header) == "VERSION" &&
+                strings.Contains(text, "\nFIELDS")
+        },
+        Load: func(path string, opts *LoadOptions) (*Model, error) {
+            mesh, err := LoadPCD(path)
+            if err != nil { return nil, err }
+            return meshModel(mesh, nil, opts), nil
+        },
+    })
+}
+
+type pcdField struct {
+    name string
+    size int
+    // I, U or F
+    valueType byte
+    count int
+}
+
+// LoadPCD loads a PCD point cloud. See LoadPCDFrom.
+func LoadPCD(pcdPath string) (*TriangleMesh, error) {
+    pcdFile, err := openFile(pcdPath)
+    if err != nil { return nil, err }
+    defer pcdFile.Close()
+    return LoadPCDFrom(pcdFile)
+}
+
+// LoadPCDFrom loads a Point Cloud Library PCD file (version 0.7 and
+// earlier) with ascii, binary or binary_compressed data. The x, y, z,
+// normal_x, normal_y, normal_z and packed rgb or rgba fields are mapped
+// to the corresponding TriangleMesh fields, intensity to the
+// IntensityAttribute vertex attribute and any other field to a vertex
+// attribute of the same name. Points with NaN coordinates, which mark
+// invalid points of organized clouds, are dropped. The result is a point
+// cloud, see TriangleMesh.Points.
+func LoadPCDFrom(reader io.Reader) (*TriangleMesh, error) {
+    r := bufio.NewReader(reader)
+    fields := make([]*pcdField, 0)
+    points, width, height := -1, 0, 1
+    dataFormat := ""
+    for lineNo := 1; dataFormat == ""; lineNo++ {
+        line, readErr := r.ReadString('\n')
+        if readErr != nil && (readErr != io.EOF || line == "") {
+            return nil, fmt.Errorf("PCD: missing DATA line")
+        }
+        if i := strings.IndexByte(line, '#'); i >= 0 { line = line[:i] }
+        tokens := strings.Fields(line)
+        if len(tokens) == 0 { continue }
+        invalid := fmt.Errorf("PCD line %d: invalid %s", lineNo, tokens[0])
+        values := tokens[1:]
+        var err error
+        // setInts parses values into the same field property
+        setInts := func(set func(f *pcdField, v int)) error {
+            if len(values) != len(fields) { return invalid }
+            for i, token := range values {
+                v, err := strconv.Atoi(token)
+                if err != nil || v <= 0 || v > math.MaxInt32 {
+                    return invalid
+                }
+                set(fields[i], v)
+            }
+            return nil
+        }
+        switch tokens[0] {
+        case "VERSION", "VIEWPOINT":
+        case "FIELDS", "COLUMNS":
+            for _, name := range values {
+                fields = append(fields, &pcdField{name: name, size: 4,
+                    valueType: 'F', count: 1})
+            }
+        case "SIZE":
+            err = setInts(func(f *pcdField, v int) { f.size = v })
+        case "COUNT":
+            err = setInts(func(f *pcdField, v int) { f.count = v })
+        case "TYPE":
+            if len(values) != len(fields) { return nil, invalid }
+            for i, t := range values {
+                if t != "I" && t != "U" && t != "F" { return nil, invalid }
+                fields[i].valueType = t[0]
+            }
+        case "WIDTH", "HEIGHT", "POINTS":
+            if len(values) != 1 { return nil, invalid }
+            v, err := strconv.Atoi(values[0])
+            if err != nil || v < 0 || v > math.MaxInt32 {
+                return nil, invalid
+            }
+            switch tokens[0] {
+            case "WIDTH": width = v
+            case "HEIGHT": height = v
+            default: points = v
+            }
+        case "DATA":
+            if len(values) != 1 { return nil, invalid }
+            dataFormat = values[0]
+        default:
+            return nil, fmt.Errorf("PCD line %d: unknown keyword %s",
+                lineNo, tokens[0])
+        }
+        if err != nil { return nil, err }
+    }
+    if points < 0 {
+        if uint64(width) * uint64(height) > math.MaxInt32 {
+            return nil, fmt.Errorf("PCD: too many points")
+        }
+        points = width * height
+    }
+    if len(fields) == 0 { return nil, fmt.Errorf("PCD has no fields") }
+    recordSize := 0
+    for _, f := range fields {
+        size := f.size
+        validSize := size == 1 || size == 2 || size == 4 || size == 8
+        if f.valueType == 'F' { validSize = size == 4 || size == 8 }
+        if !validSize {
+            return nil, fmt.Errorf("PCD field %s: unsupported size %d",
+                f.name, size)
+        }
+        recordSize += f.size * f.count
+        if recordSize > math.MaxInt32 {
+            return nil, fmt.Errorf("PCD: records too large")
+        }
+    }
+
+    // component returns component c of field f of point p
+    var component func(p, f, c int) float64
+    switch dataFormat {
+    case "ascii":
+        values, err := readPCDASCII(r, fields, points)
+        if err != nil { return nil, err }
+        offsets := make([]int, len(fields))
+        columns := 0
+        for i, f := range fields {
+            offsets[i] = columns
+            columns += f.count
+        }
+        component = func(p, f, c int) float64 {
+            return values[p*columns+offsets[f]+c]
+        }
+    case "binary", "binary_compressed":
+        data, err := io.ReadAll(r)
+        if err != nil { return nil, err }
+        if dataFormat == "binary_compressed" {
+            if len(data) < 8 {
+                return nil, fmt.Errorf("PCD: missing compressed data")
+            }
+            compressed := binary.LittleEndian.Uint32(data)
+            size := binary.LittleEndian.Uint32(data[4:])
+            if uint64(compressed) > uint64(len(data) - 8) ||
+                uint64(size) != uint64(recordSize) * uint64(points) {
+                return nil, fmt.Errorf("Corrupt PCD compressed data")
+            }
+            data, err = lzfDecompress(data[8:8+compressed], int(size))
+            if err != nil { return nil, err }
+        }
+        if uint64(points) > uint64(len(data)) / uint64(recordSize) {
+            return nil, fmt.Errorf("PCD: missing point data")
+        }
+        // Compressed data is stored field by field, binary data point by
+        // point
+        offsets := pcdOffsets(fields, 1)
+        compressed := dataFormat == "binary_compressed"
+        if compressed { offsets = pcdOffsets(fields, points) }
+        component = func(p, f, c int) float64 {
+            field := fields[f]
+            offset := p * recordSize + offsets[f] + c * field.size
+            if compressed {
+                offset = offsets[f] + (p * field.count + c) * field.size
+            }
+            return pcdValue(data[offset:offset+field.size], field)
+        }
+    default:
+        return nil, fmt.Errorf("Unsupported PCD data format %s", dataFormat)
+    }
+    return pcdMesh(fields, points, component)
+}
+
+// pcdOffsets returns the byte offset of each field's values when they
+// are stored for the given number of points at a time.
+func pcdOffsets(fields []*pcdField, points int) []int {
+    offsets := make([]int, len(fields))
+    offset := 0
+    for i, f := range fields {
+        offsets[i] = offset
+        offset += f.size * f.count * points
+    }
+    return offsets
+}
+
+// pcdValue decodes a little-endian binary value. The bits of packed
+// colour fields are returned as an integer.
+func pcdValue(b []byte, field *pcdField) float64 {
+    le := binary.LittleEndian
+    switch {
+    case field.valueType == 'F' && field.size == 4:
+        bits := le.Uint32(b)
+        if field.name == "rgb" || field.name == "rgba" {
+            return float64(bits)
+        }
+        return float64(math.Float32frombits(bits))
+    case field.valueType == 'F':
+        return math.Float64frombits(le.Uint64(b))
+    }
+    var u uint64
+    switch field.size {
+    case 1: u = uint64(b[0])
+    case 2: u = uint64(le.Uint16(b))
+    case 4: u = uint64(le.Uint32(b))
+    default: u = le.Uint64(b)
+    }
+    if field.valueType == 'U' { return float64(u) }
+    // Sign extend
+    shift := uint(64 - field.size * 8)
+    return float64(int64(u << shift) >> shift)
+}
+
+// readPCDASCII reads the values of points ascii records.
+func readPCDASCII(r *bufio.Reader, fields []*pcdField,
+    points int) ([]float64, error) {
+    columns := 0
+    for _, f := range fields { columns += f.count }
+    // Value types by column
+    packed := make([]bool, 0, columns)
+    for _, f := range fields {
+        for c := 0; c < f.count; c++ {
+            packed = append(packed, f.valueType == 'F' &&
+                (f.name == "rgb" || f.name == "rgba"))
+        }
+    }
+    values := make([]float64, 0)
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+    for p := 0; p < points; {
+        if !scanner.Scan() {
+            if err := scanner.Err(); err != nil { return nil, err }
+            return nil, fmt.Errorf("PCD: expected %d points, got %d",
+                points, p)
+        }
+        tokens := strings.Fields(scanner.Text())
+        if len(tokens) == 0 { continue }
+        if len(tokens) != columns {
+            return nil, fmt.Errorf("PCD point %d: expected %d values, " +
+                "got %d", p, columns, len(tokens))
+        }
+        for i, token := range tokens {
+            v, err := strconv.ParseFloat(token, 64)
+            if err != nil {
+                return nil, fmt.Errorf("PCD point %d: %v", p, err)
+            }
+            if packed[i] { v = float64(math.Float32bits(float32(v))) }
+            values = append(values, v)
+        }
+        p++
+    }
+    return values, nil
+}
+
+// pcdMesh builds a point cloud from the values of fields.
+func pcdMesh(fields []*pcdField, points int,
+    component func(p, f, c int) float64) (*TriangleMesh, error) {
+    find := func(name string) int {
+        for i, f := range fields {
+            if f.name == name { return i }
+        }
+        return -1
+    }
+    position := [3]int{find("x"), find("y"), find("z")}
+    if position[0] < 0 || position[1] < 0 || position[2] < 0 {
+        return nil, fmt.Errorf("PCD has no x, y and z fields")
+    }
+    normal := [3]int{find("normal_x"), find("normal_y"), find("normal_z")}
+    hasNormals := normal[0] >= 0 && normal[1] >= 0 && normal[2] >= 0
+    color, alpha := find("rgb"), false
+    if color < 0 { color, alpha = find("rgba"), true }
+
+    mesh := &TriangleMesh{Vertices: make([]float32, 0),
+        Objects: make([]*MeshObject, 0), Points: true}
+    if hasNormals { mesh.Normals = make([]float32, 0) }
+    if color >= 0 { mesh.Colors = make([]float32, 0) }
+    attrFields := make([]int, 0)
+    for i, f := range fields {
+        switch f.name {
+        case "x", "y", "z", "normal_x", "normal_y", "normal_z", "rgb",
+            "rgba", "_":
+            continue
+        }
+        name := f.name
+        if name == "intensity" { name = IntensityAttribute }
+        mesh.Attributes = append(mesh.Attributes, &VertexAttribute{
+            Name: name, Size: f.count, Values: make([]float32, 0)})
+        attrFields = append(attrFields, i)
+    }
+    value := func(p, f int) float32 { return float32(component(p, f, 0)) }
+    for p := 0; p < points; p++ {
+        x, y, z := value(p, position[0]), value(p, position[1]),
+            value(p, position[2])
+        if math.IsNaN(float64(x)) || math.IsNaN(float64(y)) ||
+            math.IsNaN(float64(z)) {
+            continue
+        }
+        mesh.Vertices = append(mesh.Vertices, x, y, z)
+        if hasNormals {
+            mesh.Normals = append(mesh.Normals, value(p, normal[0]),
+                value(p, normal[1]), value(p, normal[2]))
+        }
+        if color >= 0 {
+            bits := uint32(component(p, color, 0))
+            a := float32(1)
+            if alpha { a = float32(bits >> 24) / 255 }
+            mesh.Colors = append(mesh.Colors,
+                float32(bits >> 16 & 255) / 255,
+                float32(bits >> 8 & 255) / 255, float32(bits & 255) / 255, a)
+        }
+        for i, f := range attrFields {
+            attr := mesh.Attributes[i]
+            for c := 0; c < fields[f].count; c++ {
+                attr.Values = append(attr.Values, float32(component(p, f, c)))
+            }
+        }
+    }
+    if len(mesh.Vertices) == 0 { return nil, fmt.Errorf("PCD has no points") }
+    return mesh, nil
+}
+
+// lzfDecompress decompresses LZF data to size bytes.
+func lzfDecompress(in []byte, size int) ([]byte, error) {
+    corrupt := fmt.Errorf("Corrupt LZF data")
+    out := make([]byte, 0, len(in))
+    for i := 0; i < len(in); {
+        ctrl := int(in[i])
+        i++
+        if ctrl < 32 {
+            // Literal run
+            n := ctrl + 1
+            if i + n > len(in) { return nil, corrupt }
+            out = append(out, in[i:i+n]...)
+            i += n
+            continue
+        }
+        // Back reference
+        n := ctrl >> 5
+        if n == 7 {
+            if i >= len(in) { return nil, corrupt }
+            n += int(in[i])
+            i++
+        }
+        if i >= len(in) { return nil, corrupt }
+        ref := len(out) - ((ctrl & 31) << 8) - int(in[i]) - 1
+        i++
+        if ref < 0 { return nil, corrupt }
+        for k := 0; k < n + 2; k++ { out = append(out, out[ref+k]) }
+    }
+    if len(out) != size { return nil, corrupt }
+    return out, nil
+}
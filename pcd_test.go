@@ -0,0 +1,122 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "math"
+    "strings"
+    "testing"
+)
+
+const pcdHeader = `# .PCD v0.7 - Point Cloud Data file format
+VERSION 0.7
+FIELDS x y z rgb intensity
+SIZE 4 4 4 4 2
+TYPE F F F F U
+COUNT 1 1 1 1 1
+WIDTH 3
+HEIGHT 1
+VIEWPOINT 0 0 0 1 0 0 0
+POINTS 3
+DATA %s
+`
+
+// pcdTestPoints holds three points, the second one invalid
+var pcdTestPoints = [][5]float32{
+    {1, 2, 3, math.Float32frombits(0xff8000), 10},
+    {float32(math.NaN()), 0, 0, 0, 0},
+    {4, 5, 6, math.Float32frombits(0x0000ff), 20},
+}
+
+func checkPCDMesh(t *testing.T, mesh *TriangleMesh) {
+    checkFloats(t, "Vertices", mesh.Vertices, []float32{1, 2, 3, 4, 5, 6})
+    checkFloats(t, "Colors", mesh.Colors,
+        []float32{1, float32(128) / 255, 0, 1, 0, 0, 1, 1})
+    if attr := mesh.Attribute(IntensityAttribute); attr == nil {
+        t.Error("Missing intensity attribute")
+    } else {
+        checkFloats(t, "Intensity", attr.Values, []float32{10, 20})
+    }
+    if !mesh.Points { t.Error("Point cloud not detected") }
+}
+
+// writePCDValue writes the binary value of field f of point p.
+func writePCDValue(buf *bytes.Buffer, p, f int) {
+    v := pcdTestPoints[p][f]
+    if f == 4 {
+        binary.Write(buf, binary.LittleEndian, uint16(v))
+    } else {
+        binary.Write(buf, binary.LittleEndian, v)
+    }
+}
+
+func TestLoadPCD(t *testing.T) {
+    t.Log("Testing: ASCII PCD")
+    var ascii strings.Builder
+    fmt.Fprintf(&ascii, pcdHeader, "ascii")
+    for _, p := range pcdTestPoints {
+        fmt.Fprintf(&ascii, "%v %v %v %v %v\n", p[0], p[1], p[2], p[3], p[4])
+    }
+    mesh, err := LoadPCDFrom(strings.NewReader(ascii.String()))
+    if err != nil { t.Error(err); return }
+    checkPCDMesh(t, mesh)
+
+    t.Log("Testing: Binary PCD")
+    var buf bytes.Buffer
+    fmt.Fprintf(&buf, pcdHeader, "binary")
+    for p := range pcdTestPoints {
+        for f := 0; f < 5; f++ { writePCDValue(&buf, p, f) }
+    }
+    mesh, err = LoadPCDFrom(&buf)
+    if err != nil { t.Error(err); return }
+    checkPCDMesh(t, mesh)
+
+    t.Log("Testing: Compressed binary PCD")
+    var data bytes.Buffer
+    for f := 0; f < 5; f++ {
+        for p := range pcdTestPoints { writePCDValue(&data, p, f) }
+    }
+    // Literal runs of up to 32 bytes
+    var compressed bytes.Buffer
+    for rest := data.Bytes(); len(rest) > 0; {
+        n := len(rest)
+        if n > 32 { n = 32 }
+        compressed.WriteByte(byte(n - 1))
+        compressed.Write(rest[:n])
+        rest = rest[n:]
+    }
+    buf.Reset()
+    fmt.Fprintf(&buf, pcdHeader, "binary_compressed")
+    binary.Write(&buf, binary.LittleEndian,
+        []uint32{uint32(compressed.Len()), uint32(data.Len())})
+    buf.Write(compressed.Bytes())
+    mesh, err = LoadPCDFrom(&buf)
+    if err != nil { t.Error(err); return }
+    checkPCDMesh(t, mesh)
+
+    // Counts beyond the data are rejected without allocating for them
+    for _, header := range []string{
+        strings.Replace(pcdHeader, "POINTS 3", "POINTS 4611686018427387904",
+            1),
+        strings.Replace(pcdHeader, "POINTS 3", "POINTS 2000000000", 1),
+        strings.Replace(strings.Replace(pcdHeader, "POINTS 3\n", "", 1),
+            "WIDTH 3", "WIDTH 4294967296", 1),
+        strings.Replace(strings.Replace(pcdHeader, "POINTS 3\n", "", 1),
+            "HEIGHT 1", "HEIGHT 1000000", 1),
+    } {
+        for _, format := range []string{"ascii", "binary"} {
+            text := fmt.Sprintf(header, format) + "1 2 3 4 5\n"
+            _, err = LoadPCDFrom(strings.NewReader(text))
+            if err == nil {
+                t.Errorf("Too many %s points not rejected", format)
+            }
+        }
+    }
+
+    // A literal run followed by a back reference
+    out, err := lzfDecompress([]byte{1, 'a', 'b', 2 << 5, 1}, 6)
+    if err != nil || string(out) != "ababab" {
+        t.Errorf("Unexpected LZF output %q, %v", out, err)
+    }
+}
@@ -0,0 +1,492 @@
+package go3dm
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// PLYFormat is the encoding of a PLY file.
+type PLYFormat int
+
+const (
+    PLYASCII PLYFormat = iota
+    PLYBinaryLittleEndian
+    PLYBinaryBigEndian
+)
+
+var plyFormatNames = []string{
+    "ascii", "binary_little_endian", "binary_big_endian",
+}
+
+var plyTypeSizes = map[string]int{
+    "char": 1, "int8": 1, "uchar": 1, "uint8": 1,
+    "short": 2, "int16": 2, "ushort": 2, "uint16": 2,
+    "int": 4, "int32": 4, "uint": 4, "uint32": 4,
+    "float": 4, "float32": 4, "double": 8, "float64": 8,
+}
+
+type plyProperty struct {
+    name string
+    valueType string
+    // Type of the item count for list properties, empty otherwise
+    countType string
+}
+
+type plyElement struct {
+    name string
+    count int
+    properties []*plyProperty
+}
+
+type plyHeader struct {
+    format PLYFormat
+    elements []*plyElement
+}
+
+func init() {
+    RegisterFormat(&Format{Name: "ply", Extensions: []string{".ply"},
+        Sniff: func(header []byte) bool {
+            return bytes.HasPrefix(header, []byte("ply\n")) ||
+                bytes.HasPrefix(header, []byte("ply\r\n"))
+        },
+        Load: func(path string, opts *LoadOptions) (*Model, error) {
+            mesh, err := LoadPLY(path, opts.Index)
+            if err != nil { return nil, err }
+            return meshModel(mesh, nil, opts), nil
+        },
+        Save: func(path string, mesh *TriangleMesh,
+            materials map[string]*Material, opts *SaveOptions) error {
+            format := PLYASCII
+            if opts.Binary { format = PLYBinaryLittleEndian }
+            return writeFile(path, func(w io.Writer) error {
+                return WritePLY(w, mesh, format)
+            })
+        },
+    })
+}
+
+// LoadPLY loads a PLY file. See LoadPLYFrom.
+func LoadPLY(plyPath string, index bool) (*TriangleMesh, error) {
+    plyFile, err := openFile(plyPath)
+    if err != nil { return nil, err }
+    defer plyFile.Close()
+    return LoadPLYFrom(plyFile, index)
+}
+
+// LoadPLYFrom loads ASCII and binary PLY data. Vertex positions, normals
+// (nx, ny, nz), texture coordinates (s, t or u, v) and colours (red,
+// green, blue, alpha) are mapped to the corresponding TriangleMesh
+// fields, any other scalar vertex property is stored as a named vertex
+// attribute. Polygon faces are triangulated as fans. If index is false,
+// the indexed PLY geometry is expanded to one vertex per triangle corner.
+func LoadPLYFrom(reader io.Reader, index bool) (*TriangleMesh, error) {
+    r := bufio.NewReader(reader)
+    header, err := readPLYHeader(r)
+    if err != nil { return nil, err }
+    var values plyValueReader
+    switch header.format {
+    case PLYASCII:
+        values = &plyASCIIReader{r: r}
+    case PLYBinaryLittleEndian:
+        values = &plyBinaryReader{r, binary.LittleEndian, make([]byte, 8)}
+    default:
+        values = &plyBinaryReader{r, binary.BigEndian, make([]byte, 8)}
+    }
+    mesh := &TriangleMesh{}
+    vertexCount := 0
+    for _, elem := range header.elements {
+        switch elem.name {
+        case "vertex":
+            vertexCount = elem.count
+            err = readPLYVertices(values, elem, mesh)
+        case "face":
+            err = readPLYFaces(values, elem, mesh)
+        default:
+            err = skipPLYElement(values, elem)
+        }
+        if err != nil {
+            return nil, fmt.Errorf("PLY %s element: %v", elem.name, err)
+        }
+    }
+    if vertexCount == 0 { return nil, fmt.Errorf("PLY has no vertices") }
+    for _, v := range mesh.VertexIndex {
+        if int(v) >= vertexCount {
+            return nil, fmt.Errorf("PLY face index %d out of range", v)
+        }
+    }
+    mesh.Objects = make([]*MeshObject, 0, 1)
+    if mesh.VertexIndex == nil {
+        mesh.Points = true
+        return mesh, nil
+    }
+    mesh.Objects = append(mesh.Objects,
+        &MeshObject{"ply", 0, int32(len(mesh.VertexIndex)), "", false})
+    if !index { unindex(mesh) }
+    return mesh, nil
+}
+
+func readPLYHeader(r *bufio.Reader) (*plyHeader, error) {
+    line, err := r.ReadString('\n')
+    if err != nil || strings.TrimSpace(line) != "ply" {
+        return nil, fmt.Errorf("Not a PLY file")
+    }
+    header := &plyHeader{}
+    var elem *plyElement
+    formatSeen := false
+    for {
+        line, err = r.ReadString('\n')
+        if err != nil { return nil, fmt.Errorf("PLY header: %v", err) }
+        tokens := strings.Fields(line)
+        if len(tokens) == 0 { continue }
+        switch tokens[0] {
+        case "format":
+            if len(tokens) != 3 {
+                return nil, fmt.Errorf("PLY header: invalid format")
+            }
+            formatSeen = false
+            for i, name := range plyFormatNames {
+                if tokens[1] == name {
+                    header.format = PLYFormat(i)
+                    formatSeen = true
+                }
+            }
+            if !formatSeen {
+                return nil, fmt.Errorf("PLY header: unknown format %s",
+                    tokens[1])
+            }
+        case "element":
+            if len(tokens) != 3 {
+                return nil, fmt.Errorf("PLY header: invalid element")
+            }
+            count, err := strconv.Atoi(tokens[2])
+            if err != nil || count < 0 {
+                return nil, fmt.Errorf("PLY header: invalid element count")
+            }
+            elem = &plyElement{name: tokens[1], count: count}
+            header.elements = append(header.elements, elem)
+        case "property":
+            if elem == nil {
+                return nil, fmt.Errorf("PLY header: property outside element")
+            }
+            prop := &plyProperty{}
+            if len(tokens) == 5 && tokens[1] == "list" {
+                prop.countType, prop.valueType, prop.name =
+                    tokens[2], tokens[3], tokens[4]
+                if _, ok := plyTypeSizes[prop.countType]; !ok {
+                    return nil, fmt.Errorf("PLY header: unknown type %s",
+                        prop.countType)
+                }
+            } else if len(tokens) == 3 {
+                prop.valueType, prop.name = tokens[1], tokens[2]
+            } else {
+                return nil, fmt.Errorf("PLY header: invalid property")
+            }
+            if _, ok := plyTypeSizes[prop.valueType]; !ok {
+                return nil, fmt.Errorf("PLY header: unknown type %s",
+                    prop.valueType)
+            }
+            elem.properties = append(elem.properties, prop)
+        case "end_header":
+            if !formatSeen {
+                return nil, fmt.Errorf("PLY header: missing format")
+            }
+            return header, nil
+        }
+    }
+}
+
+// plyValueReader reads single property values regardless of encoding.
+type plyValueReader interface {
+    read(valueType string) (float64, error)
+    endElement() error
+}
+
+type plyASCIIReader struct {
+    r *bufio.Reader
+    tokens []string
+}
+
+func (ar *plyASCIIReader) read(valueType string) (float64, error) {
+    for len(ar.tokens) == 0 {
+        line, err := ar.r.ReadString('\n')
+        ar.tokens = strings.Fields(line)
+        if len(ar.tokens) == 0 && err != nil {
+            return 0, io.ErrUnexpectedEOF
+        }
+    }
+    token := ar.tokens[0]
+    ar.tokens = ar.tokens[1:]
+    return strconv.ParseFloat(token, 64)
+}
+
+func (ar *plyASCIIReader) endElement() error {
+    // Each element occupies one line
+    if len(ar.tokens) != 0 { return fmt.Errorf("Too many values") }
+    return nil
+}
+
+type plyBinaryReader struct {
+    r *bufio.Reader
+    order binary.ByteOrder
+    buf []byte
+}
+
+func (br *plyBinaryReader) read(valueType string) (float64, error) {
+    size := plyTypeSizes[valueType]
+    b := br.buf[:size]
+    if _, err := io.ReadFull(br.r, b); err != nil { return 0, err }
+    switch valueType {
+    case "char", "int8": return float64(int8(b[0])), nil
+    case "uchar", "uint8": return float64(b[0]), nil
+    case "short", "int16": return float64(int16(br.order.Uint16(b))), nil
+    case "ushort", "uint16": return float64(br.order.Uint16(b)), nil
+    case "int", "int32": return float64(int32(br.order.Uint32(b))), nil
+    case "uint", "uint32": return float64(br.order.Uint32(b)), nil
+    case "float", "float32":
+        return float64(math.Float32frombits(br.order.Uint32(b))), nil
+    }
+    return math.Float64frombits(br.order.Uint64(b)), nil
+}
+
+func (br *plyBinaryReader) endElement() error { return nil }
+
+func readPLYVertices(values plyValueReader, elem *plyElement,
+    mesh *TriangleMesh) error {
+    // Map each property to a destination slice and component
+    type target struct {
+        values *[]float32
+        size int
+        component int
+        scale float64
+    }
+    n := elem.count
+    targets := make([]*target, len(elem.properties))
+    // The destination slices grow by one vertex at a time, so a header
+    // claiming more vertices than the file holds doesn't allocate them
+    grown := make([]*target, 0)
+    isGrown := make(map[*[]float32]bool)
+    var positions, normals, texCoords, colors []float32
+    hasAlpha := false
+    colorScale := func(prop *plyProperty) float64 {
+        if strings.HasPrefix(prop.valueType, "float") ||
+            prop.valueType == "double" { return 1 }
+        return 1 / (math.Exp2(float64(8*plyTypeSizes[prop.valueType])) - 1)
+    }
+    for i, prop := range elem.properties {
+        if prop.countType != "" { continue }
+        t := &target{scale: 1}
+        switch prop.name {
+        case "x", "y", "z":
+            t.values, t.size = &positions, 3
+            t.component = int(prop.name[0] - 'x')
+        case "nx", "ny", "nz":
+            t.values, t.size = &normals, 3
+            t.component = int(prop.name[1] - 'x')
+        case "s", "u", "texture_u", "texture_s":
+            t.values, t.size, t.component = &texCoords, 2, 0
+        case "t", "v", "texture_v", "texture_t":
+            t.values, t.size, t.component = &texCoords, 2, 1
+        case "red", "green", "blue", "alpha",
+            "diffuse_red", "diffuse_green", "diffuse_blue":
+            t.values, t.size, t.scale = &colors, 4, colorScale(prop)
+            switch strings.TrimPrefix(prop.name, "diffuse_") {
+            case "green": t.component = 1
+            case "blue": t.component = 2
+            case "alpha":
+                t.component = 3
+                hasAlpha = true
+            }
+        default:
+            attr := &VertexAttribute{prop.name, 1, nil}
+            mesh.Attributes = append(mesh.Attributes, attr)
+            t.values, t.size = &attr.Values, 1
+        }
+        if !isGrown[t.values] {
+            isGrown[t.values] = true
+            grown = append(grown, t)
+        }
+        targets[i] = t
+    }
+    var zeros [4]float32
+    for v := 0; v < n; v++ {
+        for _, t := range grown {
+            *t.values = append(*t.values, zeros[:t.size]...)
+        }
+        for i, prop := range elem.properties {
+            if prop.countType != "" {
+                if err := skipPLYList(values, prop); err != nil { return err }
+                continue
+            }
+            val, err := values.read(prop.valueType)
+            if err != nil { return err }
+            t := targets[i]
+            (*t.values)[v*t.size + t.component] = float32(val * t.scale)
+        }
+        if err := values.endElement(); err != nil { return err }
+    }
+    if colors != nil && !hasAlpha {
+        for v := 0; v < n; v++ { colors[v*4+3] = 1 }
+    }
+    if positions == nil { positions = make([]float32, n*3) }
+    mesh.Vertices, mesh.Normals = positions, normals
+    mesh.TextureCoords, mesh.Colors = texCoords, colors
+    return nil
+}
+
+func readPLYFaces(values plyValueReader, elem *plyElement,
+    mesh *TriangleMesh) error {
+    indices := make([]uint32, 0)
+    polygon := make([]uint32, 0, 4)
+    for f := 0; f < elem.count; f++ {
+        for _, prop := range elem.properties {
+            isIndexList := prop.countType != "" &&
+                (prop.name == "vertex_indices" || prop.name == "vertex_index")
+            if !isIndexList {
+                if prop.countType != "" {
+                    if err := skipPLYList(values, prop); err != nil {
+                        return err
+                    }
+                } else if _, err := values.read(prop.valueType); err != nil {
+                    return err
+                }
+                continue
+            }
+            count, err := values.read(prop.countType)
+            if err != nil { return err }
+            polygon = polygon[:0]
+            for i := 0; i < int(count); i++ {
+                idx, err := values.read(prop.valueType)
+                if err != nil { return err }
+                if idx < 0 { return fmt.Errorf("Negative vertex index") }
+                polygon = append(polygon, uint32(idx))
+            }
+            for i := 1; i + 1 < len(polygon); i++ {
+                indices = append(indices,
+                    polygon[0], polygon[i], polygon[i+1])
+            }
+        }
+        if err := values.endElement(); err != nil { return err }
+    }
+    mesh.VertexIndex = indices
+    return nil
+}
+
+func skipPLYList(values plyValueReader, prop *plyProperty) error {
+    count, err := values.read(prop.countType)
+    if err != nil { return err }
+    for i := 0; i < int(count); i++ {
+        if _, err = values.read(prop.valueType); err != nil { return err }
+    }
+    return nil
+}
+
+func skipPLYElement(values plyValueReader, elem *plyElement) error {
+    for i := 0; i < elem.count; i++ {
+        for _, prop := range elem.properties {
+            var err error
+            if prop.countType != "" {
+                err = skipPLYList(values, prop)
+            } else {
+                _, err = values.read(prop.valueType)
+            }
+            if err != nil { return err }
+        }
+        if err := values.endElement(); err != nil { return err }
+    }
+    return nil
+}
+
+// WritePLY writes mesh as a PLY file in the given format. Normals,
+// texture coordinates (s, t), colours and vertex attributes are written
+// if present, colours as uchar properties.
+func WritePLY(writer io.Writer, mesh *TriangleMesh, format PLYFormat) error {
+    if format < PLYASCII || format > PLYBinaryBigEndian {
+        return fmt.Errorf("Unknown PLY format %d", format)
+    }
+    vertexCount := len(mesh.Vertices) / 3
+    faceCount := mesh.cornerCount() / 3
+    w := bufio.NewWriter(writer)
+    fmt.Fprintf(w, "ply\nformat %s 1.0\ncomment written by go3dm\n",
+        plyFormatNames[format])
+    fmt.Fprintf(w, "element vertex %d\n", vertexCount)
+    // Property columns as slices of values with their stride
+    type column struct {
+        values []float32
+        size int
+        component int
+    }
+    columns := make([]column, 0)
+    addColumns := func(values []float32, size int, names ...string) {
+        if len(values) < vertexCount*size { return }
+        for i, name := range names {
+            fmt.Fprintf(w, "property float %s\n", name)
+            columns = append(columns, column{values, size, i})
+        }
+    }
+    addColumns(mesh.Vertices, 3, "x", "y", "z")
+    addColumns(mesh.Normals, 3, "nx", "ny", "nz")
+    addColumns(mesh.TextureCoords, 2, "s", "t")
+    for _, attr := range mesh.Attributes {
+        names := []string{attr.Name}
+        if attr.Size > 1 {
+            names = make([]string, attr.Size)
+            for i := range names {
+                names[i] = fmt.Sprintf("%s_%d", attr.Name, i)
+            }
+        }
+        addColumns(attr.Values, attr.Size, names...)
+    }
+    hasColors := len(mesh.Colors) >= vertexCount*4 && vertexCount > 0
+    if hasColors {
+        fmt.Fprintf(w, "property uchar red\nproperty uchar green\n" +
+            "property uchar blue\nproperty uchar alpha\n")
+    }
+    fmt.Fprintf(w, "element face %d\n", faceCount)
+    fmt.Fprintf(w, "property list uchar int vertex_indices\nend_header\n")
+
+    var order binary.ByteOrder = binary.LittleEndian
+    if format == PLYBinaryBigEndian { order = binary.BigEndian }
+    buf := make([]byte, 4)
+    for v := 0; v < vertexCount; v++ {
+        for i, col := range columns {
+            val := col.values[v*col.size + col.component]
+            if format == PLYASCII {
+                if i > 0 { w.WriteByte(' ') }
+                w.WriteString(formatF32(val, -1))
+            } else {
+                order.PutUint32(buf, math.Float32bits(val))
+                w.Write(buf)
+            }
+        }
+        if hasColors {
+            for c := 0; c < 4; c++ {
+                b := unitToByte(mesh.Colors[v*4+c])
+                if format == PLYASCII {
+                    fmt.Fprintf(w, " %d", b)
+                } else {
+                    w.WriteByte(b)
+                }
+            }
+        }
+        if format == PLYASCII { w.WriteByte('\n') }
+    }
+    for f := 0; f < faceCount; f++ {
+        if format == PLYASCII {
+            fmt.Fprintf(w, "3 %d %d %d\n", mesh.vertexIndex(f*3),
+                mesh.vertexIndex(f*3+1), mesh.vertexIndex(f*3+2))
+            continue
+        }
+        w.WriteByte(3)
+        for c := 0; c < 3; c++ {
+            order.PutUint32(buf, mesh.vertexIndex(f*3+c))
+            w.Write(buf)
+        }
+    }
+    return w.Flush()
+}
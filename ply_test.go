@@ -0,0 +1,104 @@
+package go3dm
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+const quadPLY = `ply
+format ascii 1.0
+comment a quad with colours and a confidence value
+element vertex 4
+property float x
+property float y
+property float z
+property uchar red
+property uchar green
+property uchar blue
+property float confidence
+element face 1
+property list uchar int vertex_indices
+element edge 1
+property int vertex1
+property int vertex2
+end_header
+0 0 0 255 0 0 0.5
+1 0 0 0 255 0 0.25
+1 1 0 0 0 255 1
+0 1 0 255 255 255 0
+4 0 1 2 3
+0 2
+`
+
+func TestLoadPLYQuad(t *testing.T) {
+    t.Log("Testing: PLY Quad (ASCII)")
+    mesh, err := LoadPLYFrom(strings.NewReader(quadPLY), true)
+    if err != nil { t.Error(err); return }
+    checkMesh(t, mesh,
+        []float32{0, 0, 0,  1, 0, 0,  1, 1, 0,  0, 1, 0},
+        nil, nil,
+        []uint32{0, 1, 2,  0, 2, 3},
+        []*MeshObject{&MeshObject{"ply", 0, 6, "", false}})
+    if len(mesh.Colors) != 16 || mesh.Colors[4] != 0 ||
+        mesh.Colors[5] != 1 || mesh.Colors[15] != 1 {
+        t.Errorf("Unexpected colours %v", mesh.Colors)
+    }
+    confidence := mesh.Attribute("confidence")
+    if confidence == nil || confidence.Values[1] != 0.25 {
+        t.Error("Missing confidence attribute")
+    }
+    flat, err := LoadPLYFrom(strings.NewReader(quadPLY), false)
+    if err != nil { t.Error(err); return }
+    if len(flat.Vertices) != 18 || flat.VertexIndex != nil ||
+        len(flat.Attribute("confidence").Values) != 6 {
+        t.Error("Mesh not expanded")
+    }
+
+    huge := strings.Replace(quadPLY, "vertex 4", "vertex 1099511627776", 1)
+    if _, err = LoadPLYFrom(strings.NewReader(huge), true); err == nil {
+        t.Error("Excessive vertex count not rejected")
+    }
+    huge = strings.Replace(quadPLY, "face 1", "face 1099511627776", 1)
+    if _, err = LoadPLYFrom(strings.NewReader(huge), true); err == nil {
+        t.Error("Excessive face count not rejected")
+    }
+}
+
+func TestPLYRoundTrip(t *testing.T) {
+    source, err := LoadOBJFrom(strings.NewReader(texplaneOBJ), true)
+    if err != nil { t.Error(err); return }
+    mesh := &source.TriangleMesh
+    vertexCount := len(mesh.Vertices) / 3
+    mesh.Colors = make([]float32, vertexCount*4)
+    quality := &VertexAttribute{"quality", 1, make([]float32, vertexCount)}
+    for i := 0; i < vertexCount; i++ {
+        mesh.Colors[i*4], mesh.Colors[i*4+3] = 1, 1
+        quality.Values[i] = float32(i) / 2
+    }
+    mesh.Attributes = []*VertexAttribute{quality}
+    for _, format := range []PLYFormat{PLYASCII, PLYBinaryLittleEndian,
+        PLYBinaryBigEndian} {
+        t.Log("Testing: PLY Round Trip " + plyFormatNames[format])
+        var buf bytes.Buffer
+        if err = WritePLY(&buf, mesh, format); err != nil {
+            t.Error(err)
+            return
+        }
+        reloaded, err := LoadPLYFrom(&buf, true)
+        if err != nil { t.Error(err); return }
+        checkMesh(t, reloaded, mesh.Vertices, mesh.TextureCoords,
+            mesh.Normals, mesh.VertexIndex,
+            []*MeshObject{&MeshObject{"ply", 0, 6, "", false}})
+        for i, c := range reloaded.Colors {
+            if c != mesh.Colors[i] {
+                t.Errorf("Unexpected colour at %d", i)
+                break
+            }
+        }
+        attr := reloaded.Attribute("quality")
+        if attr == nil || attr.Values[3] != 1.5 {
+            t.Error("Attribute not preserved")
+        }
+    }
+}
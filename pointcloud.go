@@ -0,0 +1,177 @@
+package go3dm
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// ASCII point clouds: XYZ and Leica PTS
+
+func init() {
+    RegisterFormat(&Format{Name: "xyz", Extensions: []string{".xyz"},
+        Load: func(path string, opts *LoadOptions) (*Model, error) {
+            mesh, err := LoadXYZ(path)
+            if err != nil { return nil, err }
+            return meshModel(mesh, nil, opts), nil
+        },
+    })
+    RegisterFormat(&Format{Name: "pts", Extensions: []string{".pts"},
+        Load: func(path string, opts *LoadOptions) (*Model, error) {
+            mesh, err := LoadPTS(path)
+            if err != nil { return nil, err }
+            return meshModel(mesh, nil, opts), nil
+        },
+    })
+}
+
+// LoadXYZ loads an XYZ point cloud. See LoadXYZFrom.
+func LoadXYZ(xyzPath string) (*TriangleMesh, error) {
+    xyzFile, err := openFile(xyzPath)
+    if err != nil { return nil, err }
+    defer xyzFile.Close()
+    return LoadXYZFrom(xyzFile)
+}
+
+// LoadXYZFrom loads an ASCII point cloud with one point per line, its
+// values separated by whitespace, commas or semicolons. The number of
+// values per point selects the layout:
+//
+//     3  x y z
+//     4  x y z intensity
+//     6  x y z nx ny nz, or x y z r g b
+//     7  x y z intensity r g b
+//     9  x y z nx ny nz r g b, or x y z r g b nx ny nz
+//
+// Triples are taken as normals if they are unit vectors for all points,
+// colours otherwise. Colours are accepted both as 0..1 floats and 0..255
+// integers. Intensities are stored in the IntensityAttribute vertex
+// attribute. Lines starting with '#' or "//" are comments. The result is
+// a point cloud, see TriangleMesh.Points.
+func LoadXYZFrom(reader io.Reader) (*TriangleMesh, error) {
+    return loadPointsText(reader, "XYZ", false)
+}
+
+// LoadPTS loads a Leica PTS point cloud. See LoadPTSFrom.
+func LoadPTS(ptsPath string) (*TriangleMesh, error) {
+    ptsFile, err := openFile(ptsPath)
+    if err != nil { return nil, err }
+    defer ptsFile.Close()
+    return LoadPTSFrom(ptsFile)
+}
+
+// LoadPTSFrom loads a Leica PTS point cloud: one or more scans, each a
+// line with its point count followed by points of 3 (x y z), 4 (x y z
+// intensity), 6 (x y z r g b) or 7 (x y z intensity r g b) values. The
+// scans are merged. Colours are 0..255 integers, intensities are stored
+// unscaled in the IntensityAttribute vertex attribute. The result is a
+// point cloud, see TriangleMesh.Points.
+func LoadPTSFrom(reader io.Reader) (*TriangleMesh, error) {
+    return loadPointsText(reader, "PTS", true)
+}
+
+func loadPointsText(reader io.Reader, format string,
+    pts bool) (*TriangleMesh, error) {
+    scanner := bufio.NewScanner(reader)
+    scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+    separator := func(r rune) bool {
+        return r == ' ' || r == '\t' || r == ',' || r == ';' || r == '\r'
+    }
+    columns := 0
+    values := make([]float32, 0)
+    for lineNo := 1; scanner.Scan(); lineNo++ {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || line[0] == '#' || strings.HasPrefix(line, "//") {
+            continue
+        }
+        tokens := strings.FieldsFunc(line, separator)
+        // PTS scans start with their point count
+        if pts && len(tokens) == 1 { continue }
+        if columns == 0 {
+            columns = len(tokens)
+            if columns != 3 && columns != 4 && columns != 6 &&
+                columns != 7 && (columns != 9 || pts) {
+                return nil, fmt.Errorf("%s line %d: unsupported layout " +
+                    "with %d values per point", format, lineNo, columns)
+            }
+        }
+        if len(tokens) != columns {
+            return nil, fmt.Errorf("%s line %d: expected %d values, got %d",
+                format, lineNo, columns, len(tokens))
+        }
+        for _, token := range tokens {
+            v, err := strconv.ParseFloat(token, 32)
+            if err != nil {
+                return nil, fmt.Errorf("%s line %d: %v", format, lineNo, err)
+            }
+            values = append(values, float32(v))
+        }
+    }
+    if err := scanner.Err(); err != nil { return nil, err }
+    if columns == 0 { return nil, fmt.Errorf("%s has no points", format) }
+
+    count := len(values) / columns
+    column := func(start, size int) []float32 {
+        result := make([]float32, 0, count*size)
+        for p := 0; p < count; p++ {
+            result = append(result,
+                values[p*columns+start:p*columns+start+size]...)
+        }
+        return result
+    }
+    mesh := &TriangleMesh{Vertices: column(0, 3),
+        Objects: make([]*MeshObject, 0), Points: true}
+    var triples []int
+    switch columns {
+    case 4:
+        mesh.Attributes = []*VertexAttribute{&VertexAttribute{
+            Name: IntensityAttribute, Size: 1, Values: column(3, 1)}}
+    case 6:
+        triples = []int{3}
+    case 7:
+        mesh.Attributes = []*VertexAttribute{&VertexAttribute{
+            Name: IntensityAttribute, Size: 1, Values: column(3, 1)}}
+        triples = []int{4}
+    case 9:
+        triples = []int{3, 6}
+    }
+    for i, start := range triples {
+        triple := column(start, 3)
+        // Of two triples, one holds normals and the other colours
+        isNormal := !pts && (i == 0 && unitVectors(triple) ||
+            i == 1 && mesh.Normals == nil)
+        if isNormal {
+            mesh.Normals = triple
+        } else {
+            mesh.Colors = pointColors(triple)
+        }
+    }
+    return mesh, nil
+}
+
+// unitVectors reports whether values are all unit length 3D vectors.
+func unitVectors(values []float32) bool {
+    for i := 0; i + 2 < len(values); i += 3 {
+        x, y, z := values[i], values[i+1], values[i+2]
+        if math.Abs(float64(x*x + y*y + z*z) - 1) > 0.02 { return false }
+    }
+    return true
+}
+
+// pointColors converts RGB triples to RGBA colours. If any component is
+// greater than 1, they are interpreted as 0..255 values.
+func pointColors(rgb []float32) []float32 {
+    scale := float32(1)
+    for _, v := range rgb {
+        if v > 1 { scale = 255 }
+    }
+    colors := make([]float32, 0, len(rgb) / 3 * 4)
+    for i := 0; i + 2 < len(rgb); i += 3 {
+        colors = append(colors, rgb[i] / scale, rgb[i+1] / scale,
+            rgb[i+2] / scale, 1)
+    }
+    return colors
+}
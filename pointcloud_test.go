@@ -0,0 +1,89 @@
+package go3dm
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+func TestLoadXYZ(t *testing.T) {
+    t.Log("Testing: XYZ Point Cloud")
+    xyz := "// X Y Z R G B Nx Ny Nz\n" +
+        "0 0 0 255 0 0 0 0 1\n" +
+        "1,2,3,0,255,0,0,1,0\n"
+    mesh, err := LoadXYZFrom(strings.NewReader(xyz))
+    if err != nil { t.Error(err); return }
+    checkMesh(t, mesh, []float32{0, 0, 0, 1, 2, 3}, nil,
+        []float32{0, 0, 1, 0, 1, 0}, nil, []*MeshObject{})
+    checkFloats(t, "Colors", mesh.Colors, []float32{1, 0, 0, 1, 0, 1, 0, 1})
+    if !mesh.Points { t.Error("Point cloud not detected") }
+
+    // Normals first, floating point colours
+    mesh, err = LoadXYZFrom(strings.NewReader("0 0 0 0 1 0 0.5 0.5 0.5\n"))
+    if err != nil { t.Error(err); return }
+    checkFloats(t, "Normals", mesh.Normals, []float32{0, 1, 0})
+    checkFloats(t, "Colors", mesh.Colors, []float32{0.5, 0.5, 0.5, 1})
+
+    mesh, err = LoadXYZFrom(strings.NewReader("0 0 0 7\n1 1 1 9\n"))
+    if err != nil { t.Error(err); return }
+    if attr := mesh.Attribute(IntensityAttribute);
+        attr == nil || attr.Values[1] != 9 {
+        t.Errorf("Unexpected attributes %v", mesh.Attributes)
+    }
+
+    _, err = LoadXYZFrom(strings.NewReader("0 0 0\n1 1\n"))
+    if err == nil { t.Error("Inconsistent values not rejected") }
+}
+
+func TestLoadPTS(t *testing.T) {
+    t.Log("Testing: PTS Point Cloud")
+    pts := "2\n0 0 0 -100 255 255 255\n1 0 0 200 0 0 255\n" +
+        "1\n0 1 0 0 0 0 0\n"
+    mesh, err := LoadPTSFrom(strings.NewReader(pts))
+    if err != nil { t.Error(err); return }
+    checkFloats(t, "Vertices", mesh.Vertices,
+        []float32{0, 0, 0, 1, 0, 0, 0, 1, 0})
+    checkFloats(t, "Colors", mesh.Colors,
+        []float32{1, 1, 1, 1, 0, 0, 1, 1, 0, 0, 0, 1})
+    checkFloats(t, "Intensity", mesh.Attribute(IntensityAttribute).Values,
+        []float32{-100, 200, 0})
+    if mesh.Normals != nil { t.Error("Unexpected normals") }
+
+    // Writers of mesh formats write no faces
+    var buf bytes.Buffer
+    if err = WritePLY(&buf, mesh, PLYASCII); err != nil {
+        t.Error(err)
+        return
+    }
+    if !strings.Contains(buf.String(), "element face 0\n") {
+        t.Errorf("Unexpected PLY faces in %s", buf.String())
+    }
+}
+
+func TestTriangleSoupNotPointCloud(t *testing.T) {
+    t.Log("Testing: Unindexed Mesh without Objects")
+    mesh := &TriangleMesh{Vertices: []float32{0, 0, 0, 1, 0, 0, 0, 1, 0}}
+    var buf bytes.Buffer
+    if err := WriteSTL(&buf, mesh, &STLWriteOptions{Binary: true});
+        err != nil {
+        t.Error(err)
+        return
+    }
+    if buf.Len() != 84 + 50 {
+        t.Errorf("Expected one STL triangle, got %d bytes", buf.Len())
+    }
+    buf.Reset()
+    if err := WriteOFF(&buf, mesh, nil); err != nil { t.Error(err); return }
+    if !strings.Contains(buf.String(), "\n3 1 0\n") ||
+        !strings.HasSuffix(buf.String(), "\n3 0 1 2\n") {
+        t.Errorf("Expected one OFF face in %s", buf.String())
+    }
+
+    // The flag survives the binary format
+    mesh.Points = true
+    buf.Reset()
+    if err := WriteBinary(&buf, mesh, nil); err != nil { t.Error(err); return }
+    loaded, _, err := DecodeBinary(buf.Bytes())
+    if err != nil { t.Error(err); return }
+    if !loaded.Points { t.Error("Point cloud flag not restored") }
+}
@@ -0,0 +1,166 @@
+package go3dm
+
+import (
+    "fmt"
+    "image"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+)
+
+// sniffLength is the number of bytes passed to Format.Sniff.
+const sniffLength = 512
+
+// Format describes a model format for Load and Save. Formats register
+// themselves with RegisterFormat, usually from an init function.
+type Format struct {
+    // Short name used by SaveOptions.Format, e.g. "obj"
+    Name string
+    // File extensions including the dot, e.g. ".obj"
+    Extensions []string
+    // Sniff reports whether a file starting with header is in this
+    // format. nil if the format can't be recognised by its content.
+    Sniff func(header []byte) bool
+    // Load loads a model from a file. nil for write-only formats.
+    Load func(path string, opts *LoadOptions) (*Model, error)
+    // Save writes a mesh and its materials to a file, together with any
+    // side files such as material libraries. nil for read-only formats.
+    Save func(path string, mesh *TriangleMesh,
+        materials map[string]*Material, opts *SaveOptions) error
+}
+
+// SaveOptions controls the output of Save. Options that don't apply to
+// the chosen format are ignored.
+type SaveOptions struct {
+    // Name of the format to write, chosen by extension if empty
+    Format string
+    // Write the binary variant of formats that have one (STL, PLY)
+    Binary bool
+    // Embed textures in the file (glTF)
+    EmbedTextures bool
+    // Decoded textures, usually Model.Textures, from which embedded
+    // textures are written (glTF)
+    Textures map[string]image.Image
+}
+
+var formats = struct {
+    sync.RWMutex
+    list []*Format
+}{}
+
+// RegisterFormat registers a model format for Load and Save. Formats
+// registered later take precedence for the same extension or name.
+func RegisterFormat(format *Format) {
+    formats.Lock()
+    defer formats.Unlock()
+    formats.list = append([]*Format{format}, formats.list...)
+}
+
+// Formats returns the registered formats.
+func Formats() []*Format {
+    formats.RLock()
+    defer formats.RUnlock()
+    return append([]*Format(nil), formats.list...)
+}
+
+func findFormat(match func(*Format) bool) *Format {
+    for _, format := range Formats() {
+        if match(format) { return format }
+    }
+    return nil
+}
+
+func (f *Format) hasExtension(ext string) bool {
+    for _, e := range f.Extensions {
+        if strings.EqualFold(e, ext) { return true }
+    }
+    return false
+}
+
+// Load loads a model, choosing the format by extension. If the file's
+// content doesn't match the format of its extension, or the extension is
+// unknown, the format is sniffed from the content instead. Compressed
+// files are recognised by their content, the compression extension (e.g.
+// ".gz") is ignored. A nil opts is equivalent to the zero LoadOptions.
+func Load(path string, opts *LoadOptions) (*Model, error) {
+    if opts == nil { opts = &LoadOptions{} }
+    f, err := openFile(path)
+    if err != nil { return nil, err }
+    header := make([]byte, sniffLength)
+    n, err := io.ReadFull(f, header)
+    f.Close()
+    if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+        return nil, err
+    }
+    header = header[:n]
+    ext := filepath.Ext(trimCompressionExt(path))
+    format := findFormat(func(f *Format) bool {
+        return f.Load != nil && f.hasExtension(ext)
+    })
+    if format == nil || format.Sniff != nil && !format.Sniff(header) {
+        sniffed := findFormat(func(f *Format) bool {
+            return f.Load != nil && f.Sniff != nil && f.Sniff(header)
+        })
+        if sniffed != nil { format = sniffed }
+    }
+    if format == nil {
+        return nil, fmt.Errorf("Unknown model format: %s", path)
+    }
+    return format.Load(path, opts)
+}
+
+// Save writes mesh and materials to path in the format given by
+// opts.Format or, if empty, the path's extension. A nil opts is
+// equivalent to the zero SaveOptions.
+func Save(path string, mesh *TriangleMesh, materials map[string]*Material,
+    opts *SaveOptions) error {
+    if opts == nil { opts = &SaveOptions{} }
+    ext := filepath.Ext(path)
+    format := findFormat(func(f *Format) bool {
+        if f.Save == nil { return false }
+        if opts.Format != "" { return strings.EqualFold(f.Name, opts.Format) }
+        return f.hasExtension(ext)
+    })
+    if format == nil {
+        if opts.Format != "" {
+            return fmt.Errorf("Unknown model format: %s", opts.Format)
+        }
+        return fmt.Errorf("Unknown model format: %s", path)
+    }
+    return format.Save(path, mesh, materials, opts)
+}
+
+// meshModel wraps a loaded mesh in a Model, processing textures
+// according to opts.
+func meshModel(mesh *TriangleMesh, materials map[string]*Material,
+    opts *LoadOptions) *Model {
+    if materials == nil { materials = make(map[string]*Material) }
+    model := &Model{Mesh: mesh, Materials: materials}
+    processTextures(model, opts)
+    return model
+}
+
+// writeFile creates path and writes it with write.
+func writeFile(path string, write func(w io.Writer) error) error {
+    f, err := os.Create(path)
+    if err != nil { return err }
+    if err = write(f); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
+
+// firstToken returns the first whitespace separated token of header that
+// isn't part of a comment starting with '#'.
+func firstToken(header []byte) string {
+    for _, line := range strings.Split(string(header), "\n") {
+        if i := strings.IndexByte(line, '#'); i >= 0 { line = line[:i] }
+        if tokens := strings.Fields(line); len(tokens) > 0 {
+            return tokens[0]
+        }
+    }
+    return ""
+}
@@ -0,0 +1,61 @@
+package go3dm
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+    mesh, materials, err := LoadOBJ("test-meshes/cubes.obj", true)
+    if err != nil { t.Error(err); return }
+    dir := t.TempDir()
+    for _, name := range []string{"cubes.obj", "cubes.stl", "cubes.ply",
+        "cubes.off", "cubes.gltf", "cubes.glb", "cubes.3mf", "cubes.g3dm"} {
+        t.Logf("Testing: Save and Load %s", name)
+        path := filepath.Join(dir, name)
+        if err = Save(path, mesh, materials, nil); err != nil {
+            t.Error(err)
+            continue
+        }
+        model, err := Load(path, &LoadOptions{Index: true})
+        if err != nil { t.Error(err); continue }
+        if model.Mesh.cornerCount() != mesh.cornerCount() {
+            t.Errorf("Expected %d corners, got %d", mesh.cornerCount(),
+                model.Mesh.cornerCount())
+        }
+        if name == "cubes.obj" || name == "cubes.gltf" ||
+            name == "cubes.g3dm" {
+            if len(model.Materials) != len(materials) {
+                t.Errorf("Expected %d materials, got %d", len(materials),
+                    len(model.Materials))
+            }
+        }
+    }
+    if _, err = os.Stat(filepath.Join(dir, "cubes.mtl")); err != nil {
+        t.Error("MTL file not written")
+    }
+
+    t.Log("Testing: Format Sniffing")
+    // Binary PLY with a misleading extension
+    path := filepath.Join(dir, "cubes.obj.bak")
+    err = Save(path, mesh, nil, &SaveOptions{Format: "ply", Binary: true})
+    if err != nil { t.Error(err); return }
+    model, err := Load(path, nil)
+    if err != nil { t.Error(err); return }
+    if model.Mesh.VertexIndex != nil ||
+        len(model.Mesh.Vertices) != mesh.cornerCount()*3 {
+        t.Error("Sniffed PLY not loaded")
+    }
+    if err = os.Rename(path, filepath.Join(dir, "wrong.off")); err != nil {
+        t.Fatal(err)
+    }
+    if _, err = Load(filepath.Join(dir, "wrong.off"), nil); err != nil {
+        t.Errorf("Content not preferred over extension: %v", err)
+    }
+
+    if err = Save(filepath.Join(dir, "cubes.xyz1"), mesh, nil, nil);
+        err == nil {
+        t.Error("Unknown extension not rejected")
+    }
+}
@@ -0,0 +1,327 @@
+package go3dm
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "math"
+    "strconv"
+    "strings"
+)
+
+const stlHeaderSize = 80
+const stlTriangleSize = 50
+
+func init() {
+    RegisterFormat(&Format{Name: "stl", Extensions: []string{".stl"},
+        Sniff: func(header []byte) bool {
+            return bytes.HasPrefix(bytes.TrimSpace(header), []byte("solid"))
+        },
+        Load: func(path string, opts *LoadOptions) (*Model, error) {
+            mesh, materials, err := LoadSTL(path, opts.Index)
+            if err != nil { return nil, err }
+            return meshModel(mesh, materials, opts), nil
+        },
+        Save: func(path string, mesh *TriangleMesh,
+            materials map[string]*Material, opts *SaveOptions) error {
+            return writeFile(path, func(w io.Writer) error {
+                return WriteSTL(w, mesh, &STLWriteOptions{
+                    Binary: opts.Binary, Materials: materials})
+            })
+        },
+    })
+}
+
+// LoadSTL loads an ASCII or binary STL file. See LoadSTLFrom.
+func LoadSTL(stlPath string, index bool) (*TriangleMesh,
+    map[string]*Material, error) {
+    stlFile, err := openFile(stlPath)
+    if err != nil { return nil, nil, err }
+    defer stlFile.Close()
+    return LoadSTLFrom(stlFile, index)
+}
+
+// LoadSTLFrom loads STL data, detecting whether it is ASCII or binary.
+// Each solid of an ASCII file becomes a mesh object. Binary files
+// carrying per-face colours (VisCAM/SolidView or Materialise Magics
+// convention) are split into one mesh object per colour run, with a
+// material per colour. If index is true, vertices with identical
+// positions are welded into an indexed mesh and, as facet normals can't
+// be shared, smooth vertex normals are computed from the faces.
+func LoadSTLFrom(reader io.Reader, index bool) (*TriangleMesh,
+    map[string]*Material, error) {
+    data, err := io.ReadAll(reader)
+    if err != nil { return nil, nil, err }
+    if isBinarySTL(data) { return parseBinarySTL(data, index) }
+    if bytes.HasPrefix(bytes.TrimSpace(data), []byte("solid")) {
+        mesh, err := parseASCIISTL(data, index)
+        return mesh, make(map[string]*Material), err
+    }
+    return nil, nil, fmt.Errorf("Not an STL file")
+}
+
+func isBinarySTL(data []byte) bool {
+    if len(data) < stlHeaderSize + 4 { return false }
+    count := binary.LittleEndian.Uint32(data[stlHeaderSize:])
+    return uint64(len(data)) ==
+        uint64(stlHeaderSize + 4) + uint64(count) * stlTriangleSize
+}
+
+func parseASCIISTL(data []byte, index bool) (*TriangleMesh, error) {
+    builder := newMeshBuilder(index, !index, false)
+    scanner := bufio.NewScanner(bytes.NewReader(data))
+    var normal [3]float32
+    var corners [3][3]float32
+    corner := 0
+    lineNo := 0
+    for scanner.Scan() {
+        lineNo++
+        tokens := strings.Fields(scanner.Text())
+        if len(tokens) == 0 { continue }
+        var err error
+        switch tokens[0] {
+        case "solid":
+            name := strings.Join(tokens[1:], " ")
+            if name == "" { name = "stl" }
+            builder.beginObject(name, "", false)
+        case "facet":
+            if len(tokens) != 5 || tokens[1] != "normal" {
+                return nil, fmt.Errorf("STL parse error at line %d", lineNo)
+            }
+            normal, err = parseVec3(tokens[2:])
+            corner = 0
+        case "vertex":
+            if len(tokens) != 4 || corner > 2 {
+                return nil, fmt.Errorf("STL parse error at line %d", lineNo)
+            }
+            corners[corner], err = parseVec3(tokens[1:])
+            corner++
+        case "endfacet":
+            if corner != 3 {
+                return nil, fmt.Errorf(
+                    "STL facet without 3 vertices at line %d", lineNo)
+            }
+            if normal == [3]float32{} {
+                normal = faceNormal(corners[0], corners[1], corners[2])
+            }
+            builder.addTriangle(corners, normal)
+        }
+        if err != nil {
+            return nil, fmt.Errorf("STL parse error at line %d: %v",
+                lineNo, err)
+        }
+    }
+    if err := scanner.Err(); err != nil { return nil, err }
+    return stlMesh(builder), nil
+}
+
+func parseVec3(tokens []string) ([3]float32, error) {
+    var v [3]float32
+    for i := 0; i < 3; i++ {
+        f, err := strconv.ParseFloat(tokens[i], 32)
+        if err != nil { return v, err }
+        v[i] = float32(f)
+    }
+    return v, nil
+}
+
+func parseBinarySTL(data []byte, index bool) (*TriangleMesh,
+    map[string]*Material, error) {
+    le := binary.LittleEndian
+    header := data[:stlHeaderSize]
+    count := int(le.Uint32(data[stlHeaderSize:]))
+    // Materialise Magics stores a default colour in the header and
+    // clears bit 15 for faces with their own colour.
+    magics := false
+    var defaultColor [3]float32
+    if i := bytes.Index(header, []byte("COLOR=")); i >= 0 &&
+        i + 10 <= stlHeaderSize {
+        magics = true
+        for c := 0; c < 3; c++ {
+            defaultColor[c] = float32(header[i+6+c]) / 255
+        }
+    }
+    builder := newMeshBuilder(index, !index, false)
+    materials := make(map[string]*Material)
+    curMaterial := "-"
+    offset := stlHeaderSize + 4
+    readVec := func(p int) [3]float32 {
+        return [3]float32{
+            math.Float32frombits(le.Uint32(data[p:])),
+            math.Float32frombits(le.Uint32(data[p+4:])),
+            math.Float32frombits(le.Uint32(data[p+8:])),
+        }
+    }
+    for t := 0; t < count; t++ {
+        normal := readVec(offset)
+        var corners [3][3]float32
+        for c := 0; c < 3; c++ {
+            corners[c] = readVec(offset + 12 + c*12)
+        }
+        attr := le.Uint16(data[offset+48:])
+        offset += stlTriangleSize
+
+        materialRef := ""
+        var rgb [3]float32
+        hasColor := false
+        if magics {
+            hasColor = true
+            rgb = defaultColor
+            if attr & 0x8000 == 0 {
+                rgb = [3]float32{unpack5(attr), unpack5(attr >> 5),
+                    unpack5(attr >> 10)}
+            }
+        } else if attr & 0x8000 != 0 {
+            hasColor = true
+            rgb = [3]float32{unpack5(attr >> 10), unpack5(attr >> 5),
+                unpack5(attr)}
+        }
+        if hasColor {
+            materialRef = colorMaterialName(rgb)
+            if _, ok := materials[materialRef]; !ok {
+                materials[materialRef] = colorMaterial(materialRef, rgb)
+            }
+        }
+        if materialRef != curMaterial {
+            builder.beginObject("stl", materialRef, false)
+            curMaterial = materialRef
+        }
+        if normal == [3]float32{} {
+            normal = faceNormal(corners[0], corners[1], corners[2])
+        }
+        builder.addTriangle(corners, normal)
+    }
+    return stlMesh(builder), materials, nil
+}
+
+func stlMesh(builder *meshBuilder) *TriangleMesh {
+    mesh := builder.mesh()
+    if builder.index && mesh.Vertices != nil {
+        computeVertexNormals(mesh)
+        for _, mo := range mesh.Objects { mo.Smooth = true }
+    }
+    return mesh
+}
+
+func unpack5(v uint16) float32 {
+    return float32(v & 0x1f) / 31
+}
+
+func pack5(v float32) uint16 {
+    if v <= 0 { return 0 }
+    if v >= 1 { return 31 }
+    return uint16(v * 31 + 0.5)
+}
+
+// colorMaterialName names materials created for formats that only carry
+// colours, e.g. "color_ff8000".
+func colorMaterialName(rgb [3]float32) string {
+    return fmt.Sprintf("color_%02x%02x%02x", unitToByte(rgb[0]),
+        unitToByte(rgb[1]), unitToByte(rgb[2]))
+}
+
+func colorMaterial(name string, rgb [3]float32) *Material {
+    return &Material{
+        Name: name,
+        Ka: []float32{0, 0, 0},
+        Kd: []float32{rgb[0], rgb[1], rgb[2]},
+        Ks: []float32{0, 0, 0},
+        Tr: 1,
+    }
+}
+
+// STLWriteOptions controls the output of WriteSTL.
+type STLWriteOptions struct {
+    // Write binary instead of ASCII STL
+    Binary bool
+    // Materials used to colour faces of binary STL files using the
+    // VisCAM/SolidView attribute convention
+    Materials map[string]*Material
+    // Compute facet normals from the vertices instead of averaging the
+    // mesh's vertex normals
+    ComputeNormals bool
+}
+
+// WriteSTL writes mesh in STL format. ASCII files contain one solid per
+// mesh object. A nil opts is equivalent to the zero STLWriteOptions.
+func WriteSTL(writer io.Writer, mesh *TriangleMesh,
+    opts *STLWriteOptions) error {
+    if opts == nil { opts = &STLWriteOptions{} }
+    objects := mesh.objects()
+    w := bufio.NewWriter(writer)
+    if opts.Binary {
+        header := make([]byte, stlHeaderSize)
+        copy(header, "Binary STL written by go3dm")
+        w.Write(header)
+        count := uint32(0)
+        for _, mo := range objects {
+            if mo.VertexOffset >= 0 { count += uint32(mo.VertexCount / 3) }
+        }
+        binary.Write(w, binary.LittleEndian, count)
+    }
+    buf := make([]byte, stlTriangleSize)
+    le := binary.LittleEndian
+    for _, mo := range objects {
+        attr := uint16(0)
+        if mat, ok := opts.Materials[mo.MaterialRef]; ok && len(mat.Kd) >= 3 {
+            attr = 0x8000 | pack5(mat.Kd[0]) << 10 |
+                pack5(mat.Kd[1]) << 5 | pack5(mat.Kd[2])
+        }
+        if !opts.Binary { fmt.Fprintf(w, "solid %s\n", mo.Name) }
+        start := int(mo.VertexOffset)
+        for i := start; mo.VertexOffset >= 0 &&
+            i + 2 < start + int(mo.VertexCount); i += 3 {
+            var corners [3][3]float32
+            for c := 0; c < 3; c++ {
+                corners[c] = mesh.position(mesh.vertexIndex(i+c))
+            }
+            normal := stlFacetNormal(mesh, i, corners, opts.ComputeNormals)
+            if opts.Binary {
+                vecs := append([][3]float32{normal}, corners[:]...)
+                for v, vec := range vecs {
+                    for c := 0; c < 3; c++ {
+                        le.PutUint32(buf[v*12+c*4:],
+                            math.Float32bits(vec[c]))
+                    }
+                }
+                le.PutUint16(buf[48:], attr)
+                w.Write(buf)
+                continue
+            }
+            fmt.Fprintf(w, "  facet normal %s\n    outer loop\n",
+                formatVec3(normal))
+            for _, corner := range corners {
+                fmt.Fprintf(w, "      vertex %s\n", formatVec3(corner))
+            }
+            fmt.Fprintf(w, "    endloop\n  endfacet\n")
+        }
+        if !opts.Binary { fmt.Fprintf(w, "endsolid %s\n", mo.Name) }
+    }
+    return w.Flush()
+}
+
+func stlFacetNormal(mesh *TriangleMesh, i int, corners [3][3]float32,
+    compute bool) [3]float32 {
+    if !compute && len(mesh.Normals) == len(mesh.Vertices) {
+        var sum [3]float64
+        for c := 0; c < 3; c++ {
+            v := mesh.vertexIndex(i+c)
+            for j := 0; j < 3; j++ {
+                sum[j] += float64(mesh.Normals[v*3+uint32(j)])
+            }
+        }
+        if n := normalize3(sum); n != [3]float32{} { return n }
+    }
+    return faceNormal(corners[0], corners[1], corners[2])
+}
+
+func formatVec3(v [3]float32) string {
+    return formatSTLFloat(v[0]) + " " + formatSTLFloat(v[1]) + " " +
+        formatSTLFloat(v[2])
+}
+
+func formatSTLFloat(v float32) string {
+    return strconv.FormatFloat(float64(v), 'e', -1, 32)
+}
@@ -0,0 +1,95 @@
+package go3dm
+
+import (
+    "bytes"
+    "math"
+    "strings"
+    "testing"
+)
+
+func TestSTLRoundTripASCII(t *testing.T) {
+    t.Log("Testing: STL Round Trip (ASCII)")
+    mesh, err := LoadOBJFrom(strings.NewReader(cubesOBJ), false)
+    if err != nil { t.Error(err); return }
+    var buf bytes.Buffer
+    if err = WriteSTL(&buf, &mesh.TriangleMesh, nil); err != nil {
+        t.Error(err)
+        return
+    }
+    if !strings.HasPrefix(buf.String(), "solid redCube\n") {
+        t.Error("Unexpected ASCII STL output")
+    }
+    reloaded, materials, err := LoadSTLFrom(&buf, false)
+    if err != nil { t.Error(err); return }
+    if len(materials) != 0 { t.Error("Unexpected materials") }
+    checkMesh(t, reloaded, cubesVertices, nil, nil, nil,
+        []*MeshObject{
+            &MeshObject{"redCube", 0, 36, "", false},
+            &MeshObject{"blueCube", 36, 36, "", false},
+        })
+    // The blue cube is flat shaded, so facet normals match the OBJ normals
+    for i := 36*3; i < len(reloaded.Normals); i++ {
+        if d := reloaded.Normals[i] - cubesNormals[i]; d > 1e-6 || d < -1e-6 {
+            t.Errorf("Unexpected normal at %d", i)
+            return
+        }
+    }
+}
+
+func TestSTLRoundTripBinary(t *testing.T) {
+    t.Log("Testing: STL Round Trip (Binary, Colours)")
+    mesh, err := LoadOBJFrom(strings.NewReader(cubesOBJ), false)
+    if err != nil { t.Error(err); return }
+    materials, err := LoadMTLFrom(strings.NewReader(cubesMTL))
+    if err != nil { t.Error(err); return }
+    matMap := make(map[string]*Material)
+    for _, m := range materials { matMap[m.Name] = m }
+    var buf bytes.Buffer
+    err = WriteSTL(&buf, &mesh.TriangleMesh,
+        &STLWriteOptions{Binary: true, Materials: matMap,
+            ComputeNormals: true})
+    if err != nil { t.Error(err); return }
+    if buf.Len() != 84 + 24*50 {
+        t.Errorf("Unexpected binary STL size %d", buf.Len())
+        return
+    }
+    reloaded, colors, err := LoadSTLFrom(&buf, true)
+    if err != nil { t.Error(err); return }
+    checkMesh(t, reloaded, nil, nil, nil, nil,
+        []*MeshObject{
+            &MeshObject{"stl", 0, 36, "color_a50000", true},
+            &MeshObject{"stl", 36, 36, "color_0000a5", true},
+        })
+    if len(reloaded.Vertices) != 2*8*3 {
+        t.Errorf("Unexpected number of welded vertices %d",
+            len(reloaded.Vertices)/3)
+    }
+    red, ok := colors["color_a50000"]
+    if !ok || red.Kd[0] < 0.6 || red.Kd[0] > 0.7 || red.Kd[2] != 0 {
+        t.Errorf("Unexpected colour materials %v", colors)
+    }
+}
+
+func TestSTLBinaryStartingWithSolid(t *testing.T) {
+    t.Log("Testing: STL Binary Detection")
+    data := make([]byte, 84 + 50)
+    copy(data, "solid but actually binary")
+    data[80] = 1
+    // Triangle in the xy plane with zero normal
+    floats := []float32{0, 0, 0,  0, 0, 0,  1, 0, 0,  0, 1, 0}
+    var buf bytes.Buffer
+    buf.Write(data[:84])
+    for _, f := range floats {
+        var b [4]byte
+        bits := math.Float32bits(f)
+        b[0], b[1], b[2], b[3] = byte(bits), byte(bits>>8),
+            byte(bits>>16), byte(bits>>24)
+        buf.Write(b[:])
+    }
+    buf.Write([]byte{0, 0})
+    mesh, _, err := LoadSTLFrom(&buf, false)
+    if err != nil { t.Error(err); return }
+    if len(mesh.Vertices) != 9 || mesh.Normals[2] != 1 {
+        t.Errorf("Unexpected mesh %v %v", mesh.Vertices, mesh.Normals)
+    }
+}
@@ -0,0 +1,267 @@
+package go3dm
+
+import (
+    "fmt"
+    "image"
+    "image/color"
+    "math"
+)
+
+// HeightmapOptions controls the terrain built by NewHeightmapMesh.
+type HeightmapOptions struct {
+    // Depth of the skirts hanging down from the terrain's edges, which
+    // hide cracks between neighbouring tiles. No skirts if 0.
+    SkirtDepth float32
+    // Maximum vertical error of the simplified terrain in world units.
+    // The full grid is used if 0.
+    MaxError float32
+}
+
+// heightGrid holds the terrain height of each grid point, row by row.
+type heightGrid struct {
+    cols, rows int
+    heights []float32
+}
+
+// NewHeightmapMesh builds an indexed terrain mesh from a grayscale
+// heightmap. The terrain spans width along X and depth along Z, centred
+// on the origin, with the top row of the image at -Z. Black maps to
+// height 0 and white to heightScale. Each pixel becomes a grid vertex
+// with texture coordinates covering the whole terrain and a normal from
+// the height differences of its neighbours. With a MaxError, the
+// heightmap is resampled to a square grid of 2^n+1 points per side
+// (unless it already is one) and flat areas are covered by larger
+// triangles, keeping the height error below MaxError without cracks. The
+// terrain is the mesh object "terrain", the skirts, if any, the mesh
+// object "skirts". A nil opts is equivalent to the zero HeightmapOptions.
+func NewHeightmapMesh(img image.Image, width, depth, heightScale float32,
+    opts *HeightmapOptions) (*TriangleMesh, error) {
+    if opts == nil { opts = &HeightmapOptions{} }
+    bounds := img.Bounds()
+    if bounds.Dx() < 2 || bounds.Dy() < 2 {
+        return nil, fmt.Errorf("Heightmap must be at least 2x2 pixels")
+    }
+    if width <= 0 || depth <= 0 {
+        return nil, fmt.Errorf("Invalid terrain size %gx%g", width, depth)
+    }
+    grid := &heightGrid{bounds.Dx(), bounds.Dy(),
+        make([]float32, bounds.Dx()*bounds.Dy())}
+    for y := 0; y < grid.rows; y++ {
+        for x := 0; x < grid.cols; x++ {
+            gray := color.Gray16Model.Convert(
+                img.At(bounds.Min.X + x, bounds.Min.Y + y)).(color.Gray16)
+            grid.heights[y*grid.cols+x] = float32(gray.Y) / 65535 *
+                heightScale
+        }
+    }
+    var triangles [][3]int
+    if opts.MaxError > 0 {
+        size := 2
+        for size + 1 < grid.cols || size + 1 < grid.rows { size *= 2 }
+        grid = grid.resample(size + 1)
+        triangles = grid.simplify(opts.MaxError)
+    } else {
+        triangles = grid.triangles()
+    }
+
+    // Grid point positions and normals
+    dx := width / float32(grid.cols - 1)
+    dz := depth / float32(grid.rows - 1)
+    position := func(p int) [3]float32 {
+        x, y := p % grid.cols, p / grid.cols
+        return [3]float32{float32(x) * dx - width / 2, grid.heights[p],
+            float32(y) * dz - depth / 2}
+    }
+    normal := func(p int) [3]float32 {
+        x, y := p % grid.cols, p / grid.cols
+        x0, x1 := x - 1, x + 1
+        if x0 < 0 { x0 = 0 }
+        if x1 >= grid.cols { x1 = grid.cols - 1 }
+        y0, y1 := y - 1, y + 1
+        if y0 < 0 { y0 = 0 }
+        if y1 >= grid.rows { y1 = grid.rows - 1 }
+        hx := (grid.at(x1, y) - grid.at(x0, y)) / (float32(x1 - x0) * dx)
+        hz := (grid.at(x, y1) - grid.at(x, y0)) / (float32(y1 - y0) * dz)
+        return normalize3([3]float64{float64(-hx), 1, float64(-hz)})
+    }
+    texCoord := func(p int) [2]float32 {
+        x, y := p % grid.cols, p / grid.cols
+        return [2]float32{float32(x) / float32(grid.cols - 1),
+            1 - float32(y) / float32(grid.rows - 1)}
+    }
+
+    mesh := &TriangleMesh{}
+    vertexMap := make(map[[2]int]uint32)
+    // vertex returns the index of grid point p, lowered by drop and with
+    // the given normal if it is a skirt vertex of the side
+    vertex := func(p, side int, drop float32, n [3]float32) uint32 {
+        key := [2]int{p, side}
+        if drop > 0 { key[1] += 4 }
+        if v, ok := vertexMap[key]; ok { return v }
+        v := uint32(len(mesh.Vertices) / 3)
+        vertexMap[key] = v
+        pos := position(p)
+        pos[1] -= drop
+        tc := texCoord(p)
+        mesh.Vertices = append(mesh.Vertices, pos[:]...)
+        mesh.Normals = append(mesh.Normals, n[:]...)
+        mesh.TextureCoords = append(mesh.TextureCoords, tc[:]...)
+        return v
+    }
+    for _, tri := range triangles {
+        for _, p := range tri {
+            mesh.VertexIndex = append(mesh.VertexIndex,
+                vertex(p, -1, 0, normal(p)))
+        }
+    }
+    mesh.Objects = []*MeshObject{
+        &MeshObject{"terrain", 0, int32(len(mesh.VertexIndex)), "", true}}
+    if opts.SkirtDepth <= 0 { return mesh, nil }
+
+    // Each terrain edge on a border gets a wall facing outwards, the
+    // sides being -X, +X, -Z and +Z
+    sideNormals := [4][3]float32{{-1, 0, 0}, {1, 0, 0}, {0, 0, -1},
+        {0, 0, 1}}
+    side := func(p, q int) int {
+        px, py := p % grid.cols, p / grid.cols
+        qx, qy := q % grid.cols, q / grid.cols
+        switch {
+        case px == 0 && qx == 0: return 0
+        case px == grid.cols - 1 && qx == grid.cols - 1: return 1
+        case py == 0 && qy == 0: return 2
+        case py == grid.rows - 1 && qy == grid.rows - 1: return 3
+        }
+        return -1
+    }
+    skirtOffset := int32(len(mesh.VertexIndex))
+    for _, tri := range triangles {
+        for c := 0; c < 3; c++ {
+            p, q := tri[c], tri[(c+1)%3]
+            s := side(p, q)
+            if s < 0 { continue }
+            n := sideNormals[s]
+            top := [2]uint32{vertex(p, s, 0, n), vertex(q, s, 0, n)}
+            bottom := [2]uint32{vertex(p, s, opts.SkirtDepth, n),
+                vertex(q, s, opts.SkirtDepth, n)}
+            mesh.VertexIndex = append(mesh.VertexIndex,
+                top[0], bottom[0], bottom[1], top[0], bottom[1], top[1])
+        }
+    }
+    mesh.Objects = append(mesh.Objects, &MeshObject{"skirts", skirtOffset,
+        int32(len(mesh.VertexIndex)) - skirtOffset, "", false})
+    return mesh, nil
+}
+
+func (g *heightGrid) at(x, y int) float32 {
+    return g.heights[y*g.cols+x]
+}
+
+// triangles returns two triangles per grid cell, counter-clockwise when
+// seen from above.
+func (g *heightGrid) triangles() [][3]int {
+    triangles := make([][3]int, 0, (g.cols - 1) * (g.rows - 1) * 2)
+    for y := 0; y + 1 < g.rows; y++ {
+        for x := 0; x + 1 < g.cols; x++ {
+            a, d := y*g.cols + x, y*g.cols + x + 1
+            b, c := a + g.cols, d + g.cols
+            triangles = append(triangles, [3]int{a, b, c}, [3]int{a, c, d})
+        }
+    }
+    return triangles
+}
+
+// resample returns a size by size grid bilinearly interpolating g.
+func (g *heightGrid) resample(size int) *heightGrid {
+    if g.cols == size && g.rows == size { return g }
+    r := &heightGrid{size, size, make([]float32, size*size)}
+    sample := func(v float32, n int) (int, float32) {
+        i := int(v)
+        if i >= n - 1 { i = n - 2 }
+        return i, v - float32(i)
+    }
+    for y := 0; y < size; y++ {
+        y0, fy := sample(float32(y * (g.rows - 1)) / float32(size - 1),
+            g.rows)
+        for x := 0; x < size; x++ {
+            x0, fx := sample(float32(x * (g.cols - 1)) / float32(size - 1),
+                g.cols)
+            top := g.at(x0, y0) * (1 - fx) + g.at(x0 + 1, y0) * fx
+            bottom := g.at(x0, y0 + 1) * (1 - fx) +
+                g.at(x0 + 1, y0 + 1) * fx
+            r.heights[y*size+x] = top * (1 - fy) + bottom * fy
+        }
+    }
+    return r
+}
+
+// simplify triangulates a square grid of 2^n+1 points per side with right
+// triangles, splitting them as long as the height at the middle of their
+// long edge deviates by more than maxError from the edge. Splits are
+// propagated so neighbouring triangles match (the RTIN scheme of
+// Evans et al.).
+func (g *heightGrid) simplify(maxError float32) [][3]int {
+    size := g.cols
+    tile := size - 1
+    // The error of each grid point is the largest deviation of any
+    // triangle that is split at it, including its descendants. Triangles
+    // are numbered like a binary heap below the two halves of the grid,
+    // children after their parents.
+    errors := make([]float32, size*size)
+    numTriangles := tile * tile * 2 - 2
+    numParents := numTriangles - tile * tile
+    for i := numTriangles - 1; i >= 0; i-- {
+        id := i + 2
+        var ax, ay, bx, by, cx, cy int
+        if id & 1 != 0 {
+            bx, by, cx, cy = tile, tile, tile, 0
+        } else {
+            ax, ay, cy = tile, tile, tile
+        }
+        for id >>= 1; id > 1; id >>= 1 {
+            mx, my := (ax + bx) >> 1, (ay + by) >> 1
+            if id & 1 != 0 {
+                bx, by, ax, ay = ax, ay, cx, cy
+            } else {
+                ax, ay, bx, by = bx, by, cx, cy
+            }
+            cx, cy = mx, my
+        }
+        mx, my := (ax + bx) >> 1, (ay + by) >> 1
+        middle := my*size + mx
+        interpolated := (g.at(ax, ay) + g.at(bx, by)) / 2
+        deviation := float32(math.Abs(float64(interpolated -
+            g.heights[middle])))
+        if deviation > errors[middle] { errors[middle] = deviation }
+        if i < numParents {
+            left := ((ay + cy) >> 1) * size + ((ax + cx) >> 1)
+            right := ((by + cy) >> 1) * size + ((bx + cx) >> 1)
+            for _, e := range [2]float32{errors[left], errors[right]} {
+                if e > errors[middle] { errors[middle] = e }
+            }
+        }
+    }
+
+    triangles := make([][3]int, 0)
+    var process func(ax, ay, bx, by, cx, cy int)
+    process = func(ax, ay, bx, by, cx, cy int) {
+        mx, my := (ax + bx) >> 1, (ay + by) >> 1
+        if absInt(ax - cx) + absInt(ay - cy) > 1 &&
+            errors[my*size+mx] > maxError {
+            process(cx, cy, ax, ay, mx, my)
+            process(bx, by, cx, cy, mx, my)
+            return
+        }
+        a, b, c := ay*size + ax, by*size + bx, cy*size + cx
+        // Counter-clockwise when seen from above
+        if (by - ay) * (cx - ax) - (bx - ax) * (cy - ay) < 0 { b, c = c, b }
+        triangles = append(triangles, [3]int{a, b, c})
+    }
+    process(0, 0, tile, tile, tile, 0)
+    process(tile, tile, 0, 0, 0, tile)
+    return triangles
+}
+
+func absInt(v int) int {
+    if v < 0 { return -v }
+    return v
+}
@@ -0,0 +1,85 @@
+package go3dm
+
+import (
+    "image"
+    "image/color"
+    "math"
+    "testing"
+)
+
+// checkTerrainWinding checks that the triangles of mesh object mo face
+// the same way as their vertex normals.
+func checkTerrainWinding(t *testing.T, mesh *TriangleMesh, mo *MeshObject) {
+    for i := int(mo.VertexOffset); i < int(mo.VertexOffset + mo.VertexCount);
+        i += 3 {
+        a, b, c := mesh.vertexIndex(i), mesh.vertexIndex(i+1),
+            mesh.vertexIndex(i+2)
+        n := faceNormal(mesh.position(a), mesh.position(b), mesh.position(c))
+        var dot float32
+        for k := 0; k < 3; k++ { dot += n[k] * mesh.Normals[a*3+uint32(k)] }
+        if dot <= 0 {
+            t.Errorf("%s triangle %d faces the wrong way", mo.Name, i / 3)
+            return
+        }
+    }
+}
+
+func TestHeightmapMesh(t *testing.T) {
+    t.Log("Testing: Heightmap Terrain")
+    // Rising from left to right
+    img := image.NewGray(image.Rect(0, 0, 3, 2))
+    for y := 0; y < 2; y++ {
+        img.SetGray(1, y, color.Gray{255})
+        img.SetGray(2, y, color.Gray{255})
+    }
+    mesh, err := NewHeightmapMesh(img, 4, 2, 2, nil)
+    if err != nil { t.Error(err); return }
+    checkMesh(t, mesh,
+        []float32{-2, 0, -1,  -2, 0, 1,  0, 2, 1,  0, 2, -1,  2, 2, 1,
+            2, 2, -1},
+        []float32{0, 1,  0, 0,  0.5, 0,  0.5, 1,  1, 0,  1, 1},
+        nil,
+        []uint32{0, 1, 2,  0, 2, 3,  3, 2, 4,  3, 4, 5},
+        []*MeshObject{&MeshObject{"terrain", 0, 12, "", true}})
+    s := float32(1 / math.Sqrt(2))
+    checkFloats(t, "Normals", mesh.Normals[:9], []float32{-s, s, 0,
+        -s, s, 0,  -float32(1 / math.Sqrt(1.25)) / 2,
+        float32(1 / math.Sqrt(1.25)), 0})
+    checkTerrainWinding(t, mesh, mesh.Objects[0])
+
+    t.Log("Testing: Simplified Heightmap Terrain with Skirts")
+    flat := image.NewGray(image.Rect(0, 0, 20, 20))
+    opts := &HeightmapOptions{SkirtDepth: 1, MaxError: 0.01}
+    mesh, err = NewHeightmapMesh(flat, 10, 10, 1, opts)
+    if err != nil { t.Error(err); return }
+    if len(mesh.Objects) != 2 || mesh.Objects[0].VertexCount != 6 ||
+        mesh.Objects[1].VertexCount != 8 * 3 {
+        t.Errorf("Unexpected flat terrain objects %v", mesh.Objects)
+    }
+    for _, mo := range mesh.Objects { checkTerrainWinding(t, mesh, mo) }
+    minY := float32(0)
+    for i := 1; i < len(mesh.Vertices); i += 3 {
+        if mesh.Vertices[i] < minY { minY = mesh.Vertices[i] }
+    }
+    if minY != -1 { t.Errorf("Unexpected skirt bottom %g", minY) }
+
+    // A peak needs smaller triangles around it, but not everywhere
+    hill := image.NewGray(image.Rect(0, 0, 33, 33))
+    hill.SetGray(8, 8, color.Gray{255})
+    mesh, err = NewHeightmapMesh(hill, 10, 10, 1, opts)
+    if err != nil { t.Error(err); return }
+    triangles := mesh.Objects[0].VertexCount / 3
+    if triangles <= 2 || triangles >= 32 * 32 * 2 / 4 {
+        t.Errorf("Unexpected number of triangles %d", triangles)
+    }
+    peak := false
+    for i := 1; i < len(mesh.Vertices); i += 3 {
+        if mesh.Vertices[i] == 1 { peak = true }
+    }
+    if !peak { t.Error("Peak simplified away") }
+    for _, mo := range mesh.Objects { checkTerrainWinding(t, mesh, mo) }
+
+    _, err = NewHeightmapMesh(image.NewGray(image.Rect(0, 0, 1, 5)), 1, 1,
+        1, nil)
+    if err == nil { t.Error("Single column heightmap not rejected") }
+}
@@ -0,0 +1,217 @@
+package texfmt
+
+import (
+    "bufio"
+    "encoding/binary"
+    "fmt"
+    "image"
+    "image/color"
+    "io"
+    "math"
+    "math/bits"
+)
+
+const (
+    bmpRGB = 0
+    bmpBitFields = 3
+    bmpAlphaBitFields = 6
+)
+
+type bmpHeader struct {
+    offset uint32
+    width int
+    height int
+    topDown bool
+    bpp uint16
+    compression uint32
+    masks [4]uint32
+    palette color.Palette
+}
+
+func readBMPHeader(r io.Reader) (*bmpHeader, error) {
+    var fileHeader [14]byte
+    if _, err := io.ReadFull(r, fileHeader[:]); err != nil { return nil, err }
+    if fileHeader[0] != 'B' || fileHeader[1] != 'M' {
+        return nil, fmt.Errorf("BMP: invalid signature")
+    }
+    h := &bmpHeader{offset: binary.LittleEndian.Uint32(fileHeader[10:])}
+    var sizeBuf [4]byte
+    if _, err := io.ReadFull(r, sizeBuf[:]); err != nil { return nil, err }
+    infoSize := binary.LittleEndian.Uint32(sizeBuf[:])
+    if infoSize < 12 || infoSize > 1024 {
+        return nil, fmt.Errorf("BMP: invalid info header size %d", infoSize)
+    }
+    info := make([]byte, infoSize - 4)
+    if _, err := io.ReadFull(r, info); err != nil { return nil, err }
+    le := binary.LittleEndian
+    paletteEntrySize := 4
+    if infoSize == 12 {
+        // BITMAPCOREHEADER
+        h.width = int(int16(le.Uint16(info[0:])))
+        h.height = int(int16(le.Uint16(info[2:])))
+        h.bpp = le.Uint16(info[6:])
+        paletteEntrySize = 3
+    } else {
+        if infoSize < 40 {
+            return nil, fmt.Errorf("BMP: invalid info header size %d",
+                infoSize)
+        }
+        h.width = int(int32(le.Uint32(info[0:])))
+        h.height = int(int32(le.Uint32(info[4:])))
+        h.bpp = le.Uint16(info[10:])
+        h.compression = le.Uint32(info[12:])
+    }
+    if h.height < 0 {
+        h.height = -h.height
+        h.topDown = true
+    }
+    if h.width <= 0 || h.height == 0 {
+        return nil, fmt.Errorf("BMP: invalid dimensions")
+    }
+    switch h.compression {
+    case bmpRGB:
+        switch h.bpp {
+        case 16:
+            h.masks = [4]uint32{0x7c00, 0x03e0, 0x001f, 0}
+        case 24, 32:
+            h.masks = [4]uint32{0xff0000, 0x00ff00, 0x0000ff, 0}
+        }
+    case bmpBitFields, bmpAlphaBitFields:
+        if h.bpp != 16 && h.bpp != 32 {
+            return nil, fmt.Errorf("BMP: invalid bit fields depth")
+        }
+        count := 3
+        if h.compression == bmpAlphaBitFields || infoSize >= 56 {
+            count = 4
+        }
+        var masks []byte
+        if infoSize >= 52 {
+            masks = info[36:]
+        } else {
+            masks = make([]byte, count*4)
+            if _, err := io.ReadFull(r, masks); err != nil { return nil, err }
+            infoSize += uint32(count*4)
+        }
+        for i := 0; i < count; i++ {
+            h.masks[i] = le.Uint32(masks[i*4:])
+        }
+    default:
+        return nil, fmt.Errorf("BMP: unsupported compression %d",
+            h.compression)
+    }
+    switch h.bpp {
+    case 1, 4, 8:
+        colors := 1 << h.bpp
+        if infoSize >= 40 {
+            if used := int(le.Uint32(info[28:])); used > 0 && used < colors {
+                colors = used
+            }
+        }
+        entries := make([]byte, colors * paletteEntrySize)
+        if _, err := io.ReadFull(r, entries); err != nil { return nil, err }
+        h.palette = make(color.Palette, colors)
+        for i := range h.palette {
+            e := entries[i*paletteEntrySize:]
+            h.palette[i] = color.RGBA{e[2], e[1], e[0], 255}
+        }
+        infoSize += uint32(len(entries))
+    case 16, 24, 32:
+    default:
+        return nil, fmt.Errorf("BMP: unsupported depth %d", h.bpp)
+    }
+    if h.offset < 14 + infoSize {
+        return nil, fmt.Errorf("BMP: invalid pixel data offset")
+    }
+    h.offset -= 14 + infoSize
+    return h, nil
+}
+
+// DecodeBMPConfig returns the colour model and dimensions of a BMP image.
+func DecodeBMPConfig(r io.Reader) (image.Config, error) {
+    h, err := readBMPHeader(r)
+    if err != nil { return image.Config{}, err }
+    var model color.Model = color.NRGBAModel
+    if h.palette != nil { model = h.palette }
+    return image.Config{ColorModel: model,
+        Width: h.width, Height: h.height}, nil
+}
+
+// DecodeBMP decodes uncompressed 1, 4, 8, 16, 24 and 32 bit BMP images,
+// including bit field encoded 16 and 32 bit images.
+func DecodeBMP(r io.Reader) (image.Image, error) {
+    br := bufio.NewReader(r)
+    h, err := readBMPHeader(br)
+    if err != nil { return nil, err }
+    // h.offset is now relative to the end of the headers and palette
+    if _, err = br.Discard(int(h.offset)); err != nil { return nil, err }
+    rowSize := int((int64(h.width)*int64(h.bpp) + 31) / 32 * 4)
+    if h.height > math.MaxInt32 / rowSize {
+        return nil, fmt.Errorf("BMP: image too large")
+    }
+    // The pixel data is read before allocating the image, so that the
+    // allocation is bounded by the data actually present
+    size := rowSize * h.height
+    data, err := io.ReadAll(io.LimitReader(br, int64(size)))
+    if err == nil && len(data) < size { err = io.ErrUnexpectedEOF }
+    if err != nil { return nil, fmt.Errorf("BMP: %v", err) }
+    var row []byte
+    var img image.Image
+    var setRow func(y int)
+    if h.palette != nil {
+        paletted := image.NewPaletted(
+            image.Rect(0, 0, h.width, h.height), h.palette)
+        perByte := 8 / int(h.bpp)
+        mask := byte(1 << h.bpp - 1)
+        setRow = func(y int) {
+            pix := paletted.Pix[y*paletted.Stride:]
+            for x := 0; x < h.width; x++ {
+                b := row[x / perByte]
+                shift := uint(8 - int(h.bpp)*(x % perByte + 1))
+                idx := (b >> shift) & mask
+                if int(idx) >= len(h.palette) { idx = 0 }
+                pix[x] = idx
+            }
+        }
+        img = paletted
+    } else {
+        nrgba := image.NewNRGBA(image.Rect(0, 0, h.width, h.height))
+        bytesPerPixel := int(h.bpp) / 8
+        setRow = func(y int) {
+            pix := nrgba.Pix[y*nrgba.Stride:]
+            for x := 0; x < h.width; x++ {
+                p := row[x*bytesPerPixel:]
+                var v uint32
+                switch bytesPerPixel {
+                case 2: v = uint32(p[0]) | uint32(p[1]) << 8
+                case 3: v = uint32(p[0]) | uint32(p[1]) << 8 |
+                    uint32(p[2]) << 16
+                case 4: v = binary.LittleEndian.Uint32(p)
+                }
+                c := pix[x*4:x*4+4]
+                for i := 0; i < 3; i++ {
+                    c[i] = extractBits(v, h.masks[i])
+                }
+                c[3] = 255
+                if h.masks[3] != 0 { c[3] = extractBits(v, h.masks[3]) }
+            }
+        }
+        img = nrgba
+    }
+    for i := 0; i < h.height; i++ {
+        row = data[i*rowSize:(i+1)*rowSize]
+        y := h.height - 1 - i
+        if h.topDown { y = i }
+        setRow(y)
+    }
+    return img, nil
+}
+
+// extractBits returns the bits of v selected by mask scaled to 8 bits.
+func extractBits(v, mask uint32) uint8 {
+    if mask == 0 { return 0 }
+    shift := uint(bits.TrailingZeros32(mask))
+    width := uint(bits.OnesCount32(mask))
+    val := (v & mask) >> shift
+    if width >= 8 { return uint8(val >> (width - 8)) }
+    return uint8(val * 255 / (1 << width - 1))
+}
@@ -0,0 +1,151 @@
+package texfmt
+
+import (
+    "bytes"
+    "encoding/binary"
+    "image"
+    "image/color"
+    "os"
+    "path/filepath"
+    "testing"
+    "github.com/sf1/go3dm"
+)
+
+// All fixtures contain the same 3x2 image
+var expectedPixels = [][]color.NRGBA {
+    {{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}},
+    {{255, 255, 255, 255}, {0, 0, 0, 255}, {255, 255, 0, 128}},
+}
+
+func TestDecodeFixtures(t *testing.T) {
+    fixtures := []struct {
+        file string
+        format string
+        alpha bool
+    }{
+        {"rgb24.tga", "tga", false},
+        {"rgb24-rle.tga", "tga", false},
+        {"rgba32-rle-top.tga", "tga", true},
+        {"rgb24.bmp", "bmp", false},
+        {"rgba32-top.bmp", "bmp", true},
+        {"pal8.bmp", "bmp", false},
+    }
+    for _, fixture := range fixtures {
+        t.Log("Testing: " + fixture.file)
+        data, err := os.ReadFile(filepath.Join("testdata", fixture.file))
+        if err != nil { t.Error(err); continue }
+        img, format, err := image.Decode(bytes.NewReader(data))
+        if err != nil { t.Errorf("%s: %v", fixture.file, err); continue }
+        if format != fixture.format {
+            t.Errorf("%s: unexpected format %s", fixture.file, format)
+        }
+        checkPixels(t, fixture.file, img, fixture.alpha)
+        cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+        if err != nil || cfg.Width != 3 || cfg.Height != 2 {
+            t.Errorf("%s: unexpected config %v %v", fixture.file, cfg, err)
+        }
+    }
+}
+
+func TestDecodeTGARunPacket(t *testing.T) {
+    t.Log("Testing: TGA RLE Run Packets")
+    data := []byte{0, 0, tgaRLEGray, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+        4, 0, 1, 0, 8, 0,
+        0x82, 200, // run of 3
+        0x00, 100} // raw pixel
+    img, err := DecodeTGA(bytes.NewReader(data))
+    if err != nil { t.Error(err); return }
+    gray := img.(*image.Gray)
+    if !bytes.Equal(gray.Pix, []byte{200, 200, 200, 100}) {
+        t.Errorf("Unexpected pixels: %v", gray.Pix)
+    }
+    data[len(data)-4] = 0x84
+    if _, err = DecodeTGA(bytes.NewReader(data)); err == nil {
+        t.Error("Expected error for overlong run packet")
+    }
+}
+
+func TestTGAHeaderChecks(t *testing.T) {
+    t.Log("Testing: TGA Sniffing and Truncated Data")
+    header := []byte{0, 0, tgaTrueColor, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+        0xff, 0xff, 0xff, 0xff, 24, 0}
+    // Huge image with a single pixel of data
+    data := append(append([]byte{}, header...), 1, 2, 3)
+    if _, err := DecodeTGA(bytes.NewReader(data)); err == nil {
+        t.Error("Expected error for truncated image data")
+    }
+    data[2] = tgaRLETrueColor
+    data = append(data, 0x81, 1, 2, 3)
+    if _, err := DecodeTGA(bytes.NewReader(data)); err == nil {
+        t.Error("Expected error for truncated RLE data")
+    }
+    // Not a TGA, despite the image type in the third byte
+    data = append(append([]byte{}, header...), 1, 2, 3)
+    data[16] = 7
+    _, _, err := image.Decode(bytes.NewReader(data))
+    if err != image.ErrFormat {
+        t.Errorf("Unexpected error for unsupported depth: %v", err)
+    }
+    data[16], data[5] = 24, 1
+    _, _, err = image.Decode(bytes.NewReader(data))
+    if err != image.ErrFormat {
+        t.Errorf("Unexpected error for colour map fields: %v", err)
+    }
+}
+
+func TestBMPHeaderChecks(t *testing.T) {
+    t.Log("Testing: BMP Truncated Data")
+    // Huge 24 bit image with a single row of data
+    data := make([]byte, 54)
+    copy(data, "BM")
+    le := binary.LittleEndian
+    le.PutUint32(data[10:], 54)
+    le.PutUint32(data[14:], 40)
+    le.PutUint32(data[18:], 0x7fffffff)
+    le.PutUint32(data[22:], 0x7fffffff)
+    le.PutUint16(data[28:], 24)
+    data = append(data, 1, 2, 3, 0)
+    if _, err := DecodeBMP(bytes.NewReader(data)); err == nil {
+        t.Error("Expected error for huge image")
+    }
+    le.PutUint32(data[18:], 1)
+    le.PutUint32(data[22:], 100000)
+    if _, err := DecodeBMP(bytes.NewReader(data)); err == nil {
+        t.Error("Expected error for truncated image data")
+    }
+    le.PutUint32(data[22:], 1)
+    img, err := DecodeBMP(bytes.NewReader(data))
+    if err != nil { t.Error(err); return }
+    if c := img.At(0, 0).(color.NRGBA); c != (color.NRGBA{3, 2, 1, 255}) {
+        t.Errorf("Unexpected pixel %v", c)
+    }
+}
+
+func TestTextureDecoderRegistered(t *testing.T) {
+    t.Log("Testing: go3dm Texture Decoder Registration")
+    f, err := os.Open(filepath.Join("testdata", "rgb24.tga"))
+    if err != nil { t.Error(err); return }
+    defer f.Close()
+    img, err := go3dm.DecodeTexture(f, ".TGA")
+    if err != nil { t.Error(err); return }
+    checkPixels(t, "rgb24.tga", img, false)
+}
+
+func checkPixels(t *testing.T, name string, img image.Image, alpha bool) {
+    b := img.Bounds()
+    if b.Dx() != 3 || b.Dy() != 2 {
+        t.Errorf("%s: unexpected size %v", name, b)
+        return
+    }
+    for y, row := range expectedPixels {
+        for x, expected := range row {
+            if !alpha { expected.A = 255 }
+            c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+            if c != expected {
+                t.Errorf("%s: pixel %d,%d is %v, expected %v",
+                    name, x, y, c, expected)
+                return
+            }
+        }
+    }
+}
@@ -0,0 +1,186 @@
+// Package texfmt provides decoders for texture formats commonly found in
+// legacy model packs which the standard library can't decode. Importing
+// the package registers TGA and BMP with image.RegisterFormat and with
+// go3dm.RegisterTextureDecoder:
+//
+//    import _ "github.com/sf1/go3dm/texfmt"
+package texfmt
+
+import (
+    "bufio"
+    "encoding/binary"
+    "fmt"
+    "image"
+    "image/color"
+    "io"
+    "github.com/sf1/go3dm"
+)
+
+func init() {
+    // TGA has no signature, so sniff on the header of each supported
+    // image type and depth: no colour map, zero colour map fields and any
+    // origin and size.
+    for t, depths := range tgaDepths {
+        for _, depth := range depths {
+            magic := []byte{'?', 0, t, 0, 0, 0, 0, 0,
+                '?', '?', '?', '?', '?', '?', '?', '?', depth}
+            image.RegisterFormat("tga", string(magic), DecodeTGA,
+                DecodeTGAConfig)
+        }
+    }
+    image.RegisterFormat("bmp", "BM", DecodeBMP, DecodeBMPConfig)
+    go3dm.RegisterTextureDecoder(".tga", DecodeTGA)
+    go3dm.RegisterTextureDecoder(".bmp", DecodeBMP)
+}
+
+const (
+    tgaTrueColor = 2
+    tgaGray = 3
+    tgaRLETrueColor = 10
+    tgaRLEGray = 11
+)
+
+// tgaDepths holds the supported pixel depths of each image type.
+var tgaDepths = map[byte][]byte{
+    tgaTrueColor: {16, 24, 32},
+    tgaRLETrueColor: {16, 24, 32},
+    tgaGray: {8},
+    tgaRLEGray: {8},
+}
+
+type tgaHeader struct {
+    IDLength uint8
+    ColorMapType uint8
+    ImageType uint8
+    ColorMapFirst uint16
+    ColorMapLength uint16
+    ColorMapDepth uint8
+    XOrigin uint16
+    YOrigin uint16
+    Width uint16
+    Height uint16
+    Depth uint8
+    Descriptor uint8
+}
+
+func readTGAHeader(r io.Reader) (*tgaHeader, error) {
+    h := new(tgaHeader)
+    if err := binary.Read(r, binary.LittleEndian, h); err != nil {
+        return nil, err
+    }
+    if h.ColorMapType != 0 {
+        return nil, fmt.Errorf("TGA: colour mapped images not supported")
+    }
+    depths, ok := tgaDepths[h.ImageType]
+    if !ok {
+        return nil, fmt.Errorf("TGA: unsupported image type %d",
+            h.ImageType)
+    }
+    for _, depth := range depths {
+        if h.Depth == depth { return h, nil }
+    }
+    return nil, fmt.Errorf("TGA: unsupported depth %d", h.Depth)
+}
+
+// DecodeTGAConfig returns the colour model and dimensions of a TGA image.
+func DecodeTGAConfig(r io.Reader) (image.Config, error) {
+    h, err := readTGAHeader(r)
+    if err != nil { return image.Config{}, err }
+    var model color.Model = color.NRGBAModel
+    if h.Depth == 8 { model = color.GrayModel }
+    return image.Config{ColorModel: model,
+        Width: int(h.Width), Height: int(h.Height)}, nil
+}
+
+// DecodeTGA decodes uncompressed and run-length encoded true colour
+// (16, 24 and 32 bit) and grayscale TGA images with either origin.
+func DecodeTGA(r io.Reader) (image.Image, error) {
+    br := bufio.NewReader(r)
+    h, err := readTGAHeader(br)
+    if err != nil { return nil, err }
+    if _, err = br.Discard(int(h.IDLength)); err != nil { return nil, err }
+    width, height := int(h.Width), int(h.Height)
+    bpp := int(h.Depth) / 8
+    // The pixel data is read before allocating the image, so that the
+    // allocation is bounded by the data actually present
+    size := width * height * bpp
+    var data []byte
+    if h.ImageType == tgaRLETrueColor || h.ImageType == tgaRLEGray {
+        data, err = readTGARLE(br, size, bpp)
+    } else {
+        data, err = io.ReadAll(io.LimitReader(br, int64(size)))
+        if err == nil && len(data) < size { err = io.ErrUnexpectedEOF }
+    }
+    if err != nil { return nil, fmt.Errorf("TGA: %v", err) }
+    rightToLeft := h.Descriptor & 0x10 != 0
+    topToBottom := h.Descriptor & 0x20 != 0
+    hasAlpha := h.Descriptor & 0x0f != 0
+    var img image.Image
+    var setPixel func(x, y int, p []byte)
+    if bpp == 1 {
+        gray := image.NewGray(image.Rect(0, 0, width, height))
+        setPixel = func(x, y int, p []byte) {
+            gray.Pix[y*gray.Stride + x] = p[0]
+        }
+        img = gray
+    } else {
+        nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+        setPixel = func(x, y int, p []byte) {
+            i := y*nrgba.Stride + x*4
+            c := nrgba.Pix[i:i+4]
+            if bpp == 2 {
+                v := uint16(p[0]) | uint16(p[1]) << 8
+                c[0] = expand5(uint8(v >> 10))
+                c[1] = expand5(uint8(v >> 5))
+                c[2] = expand5(uint8(v))
+                c[3] = 255
+                if hasAlpha && v & 0x8000 == 0 { c[3] = 0 }
+                return
+            }
+            c[0], c[1], c[2], c[3] = p[2], p[1], p[0], 255
+            if bpp == 4 && hasAlpha { c[3] = p[3] }
+        }
+        img = nrgba
+    }
+    idx := 0
+    for row := 0; row < height; row++ {
+        y := height - 1 - row
+        if topToBottom { y = row }
+        for col := 0; col < width; col++ {
+            x := col
+            if rightToLeft { x = width - 1 - col }
+            setPixel(x, y, data[idx:idx+bpp])
+            idx += bpp
+        }
+    }
+    return img, nil
+}
+
+// readTGARLE decodes run-length encoded pixel data of the given size.
+func readTGARLE(r *bufio.Reader, size, bpp int) ([]byte, error) {
+    data := make([]byte, 0)
+    pixel := make([]byte, bpp)
+    for len(data) < size {
+        packet, err := r.ReadByte()
+        if err != nil { return nil, err }
+        count := int(packet & 0x7f) + 1
+        if len(data) + count*bpp > size {
+            return nil, fmt.Errorf("RLE packet exceeds image size")
+        }
+        if packet & 0x80 != 0 {
+            if _, err = io.ReadFull(r, pixel); err != nil { return nil, err }
+            for i := 0; i < count; i++ { data = append(data, pixel...) }
+        } else {
+            start := len(data)
+            data = append(data, make([]byte, count*bpp)...)
+            _, err = io.ReadFull(r, data[start:])
+            if err != nil { return nil, err }
+        }
+    }
+    return data, nil
+}
+
+func expand5(v uint8) uint8 {
+    v &= 0x1f
+    return v << 3 | v >> 2
+}
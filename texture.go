@@ -0,0 +1,237 @@
+package go3dm
+
+import (
+    "fmt"
+    "image"
+    _ "image/gif"
+    _ "image/jpeg"
+    _ "image/png"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+)
+
+var textureMapNames = []string{"map_Ka", "map_Kd", "map_Ks"}
+
+func (mat *Material) textureMaps() []*string {
+    return []*string{&mat.KaMap, &mat.KdMap, &mat.KsMap}
+}
+
+// ResolveTexturePaths rewrites the texture maps of every material to
+// absolute paths, relative references being resolved against the
+// material's Folder. If check is true, each path is tested for existence,
+// falling back to a case-insensitive lookup for assets authored on
+// case-insensitive file systems. A warning is returned for every texture
+// that can't be found.
+func ResolveTexturePaths(materials map[string]*Material,
+    check bool) []string {
+    warnings := make([]string, 0)
+    for _, name := range sortedMaterialNames(materials) {
+        mat := materials[name]
+        for idx, ref := range mat.textureMaps() {
+            if *ref == "" || isEmbeddedTexture(*ref) { continue }
+            path := makeAbsPath(mat.Folder, normaliseTexturePath(*ref))
+            if check {
+                found, ok := findFile(path)
+                if !ok {
+                    found, ok = findFile(
+                        filepath.Join(mat.Folder, filepath.Base(path)))
+                }
+                if !ok {
+                    warnings = append(warnings, fmt.Sprintf(
+                        "Missing texture: %s %s of material %s",
+                        textureMapNames[idx], path, mat.Name))
+                } else {
+                    path = found
+                }
+            }
+            *ref = path
+        }
+    }
+    return warnings
+}
+
+// Texture maps referring to images embedded in a model file (e.g. glTF)
+// start with embeddedTexturePrefix. Their decoded images are stored in
+// Model.Textures under the same key.
+const embeddedTexturePrefix = "embedded:"
+
+func isEmbeddedTexture(ref string) bool {
+    return strings.HasPrefix(ref, embeddedTexturePrefix)
+}
+
+// processTextures applies the texture options of opts to model.
+func processTextures(model *Model, opts *LoadOptions) {
+    if opts.ResolveTextures || opts.CheckTextures || opts.LoadTextures {
+        model.Warnings = append(model.Warnings,
+            ResolveTexturePaths(model.Materials, opts.CheckTextures)...)
+    }
+    if opts.LoadTextures {
+        textures, warnings := LoadTextures(model.Materials,
+            opts.TextureCache)
+        if model.Textures == nil {
+            model.Textures = textures
+        } else {
+            for key, img := range textures { model.Textures[key] = img }
+        }
+        model.Warnings = append(model.Warnings, warnings...)
+    }
+}
+
+func normaliseTexturePath(path string) string {
+    if filepath.Separator != '\\' {
+        path = strings.Replace(path, "\\", "/", -1)
+    }
+    return filepath.FromSlash(path)
+}
+
+// findFile returns path if it exists, otherwise it walks the path one
+// component at a time looking for case-insensitive matches.
+func findFile(path string) (string, bool) {
+    if _, err := os.Stat(path); err == nil { return path, true }
+    path = filepath.Clean(path)
+    vol := filepath.VolumeName(path)
+    rest := path[len(vol):]
+    cur := vol
+    if strings.HasPrefix(rest, string(filepath.Separator)) {
+        cur += string(filepath.Separator)
+        rest = rest[1:]
+    }
+    if cur == "" { cur = "." }
+    for _, part := range strings.Split(rest, string(filepath.Separator)) {
+        next := filepath.Join(cur, part)
+        if _, err := os.Lstat(next); err == nil {
+            cur = next
+            continue
+        }
+        dir, err := os.Open(cur)
+        if err != nil { return "", false }
+        names, err := dir.Readdirnames(-1)
+        dir.Close()
+        if err != nil { return "", false }
+        match := ""
+        for _, name := range names {
+            if strings.EqualFold(name, part) {
+                match = name
+                break
+            }
+        }
+        if match == "" { return "", false }
+        cur = filepath.Join(cur, match)
+    }
+    return cur, true
+}
+
+func makeAbsPath(absMtlDir, path string) string {
+    if filepath.IsAbs(path) { return path }
+    return filepath.Join(absMtlDir, path)
+}
+
+// TextureDecoder decodes a texture image.
+type TextureDecoder func(r io.Reader) (image.Image, error)
+
+var textureDecoders = struct {
+    sync.RWMutex
+    byExt map[string]TextureDecoder
+}{byExt: make(map[string]TextureDecoder)}
+
+// RegisterTextureDecoder registers a decoder for texture files with the
+// given extension (e.g. ".dds"). Files with unregistered extensions are
+// decoded with image.Decode, which handles PNG, JPEG, GIF and any format
+// registered with image.RegisterFormat.
+func RegisterTextureDecoder(ext string, decoder TextureDecoder) {
+    textureDecoders.Lock()
+    defer textureDecoders.Unlock()
+    textureDecoders.byExt[strings.ToLower(ext)] = decoder
+}
+
+// DecodeTexture decodes a texture, choosing the decoder by extension.
+func DecodeTexture(r io.Reader, ext string) (image.Image, error) {
+    textureDecoders.RLock()
+    decoder, ok := textureDecoders.byExt[strings.ToLower(ext)]
+    textureDecoders.RUnlock()
+    if ok { return decoder(r) }
+    img, _, err := image.Decode(r)
+    return img, err
+}
+
+// TextureCache holds decoded textures keyed by path, so that materials
+// and models referencing the same file share a single image. It is safe
+// for concurrent use; different textures are decoded in parallel.
+type TextureCache struct {
+    mutex sync.Mutex
+    entries map[string]*textureEntry
+}
+
+// textureEntry holds a decoded texture, or one being decoded until done
+// is closed.
+type textureEntry struct {
+    done chan struct{}
+    img image.Image
+    err error
+}
+
+func NewTextureCache() *TextureCache {
+    return &TextureCache{entries: make(map[string]*textureEntry)}
+}
+
+// Load returns the cached image for path, decoding it on first use.
+// Concurrent loads of the same path wait for a single decode. Failed
+// loads aren't cached.
+func (c *TextureCache) Load(path string) (image.Image, error) {
+    c.mutex.Lock()
+    if entry, ok := c.entries[path]; ok {
+        c.mutex.Unlock()
+        <-entry.done
+        return entry.img, entry.err
+    }
+    entry := &textureEntry{done: make(chan struct{})}
+    c.entries[path] = entry
+    c.mutex.Unlock()
+
+    entry.img, entry.err = decodeTextureFile(path)
+    if entry.err != nil {
+        c.mutex.Lock()
+        delete(c.entries, path)
+        c.mutex.Unlock()
+    }
+    close(entry.done)
+    return entry.img, entry.err
+}
+
+func decodeTextureFile(path string) (image.Image, error) {
+    f, err := os.Open(path)
+    if err != nil { return nil, err }
+    defer f.Close()
+    img, err := DecodeTexture(f, filepath.Ext(path))
+    if err != nil {
+        return nil, fmt.Errorf("Can't decode texture %s: %v", path, err)
+    }
+    return img, nil
+}
+
+// LoadTextures decodes every texture referenced by materials. Texture
+// paths are expected to be resolved (see ResolveTexturePaths). The result
+// is keyed by texture path; textures that fail to load are reported as
+// warnings. If cache is nil, a new cache is used.
+func LoadTextures(materials map[string]*Material,
+    cache *TextureCache) (map[string]image.Image, []string) {
+    if cache == nil { cache = NewTextureCache() }
+    textures := make(map[string]image.Image)
+    warnings := make([]string, 0)
+    for _, name := range sortedMaterialNames(materials) {
+        for _, ref := range materials[name].textureMaps() {
+            if *ref == "" || isEmbeddedTexture(*ref) { continue }
+            if _, ok := textures[*ref]; ok { continue }
+            img, err := cache.Load(*ref)
+            if err != nil {
+                warnings = append(warnings, err.Error())
+                continue
+            }
+            textures[*ref] = img
+        }
+    }
+    return textures, warnings
+}
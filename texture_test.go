@@ -0,0 +1,145 @@
+package go3dm
+
+import (
+    "fmt"
+    "image"
+    "image/color"
+    "image/png"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestResolveMissingTexture(t *testing.T) {
+    t.Log("Testing: Texture Resolution (Missing Texture)")
+    model, err := LoadOBJModel("test-meshes/texplane2.obj",
+        &LoadOptions{CheckTextures: true})
+    if err != nil { t.Error(err); return }
+    mat := model.Materials["Material"]
+    if !filepath.IsAbs(mat.KdMap) {
+        t.Errorf("Texture path not absolute: %s", mat.KdMap)
+        return
+    }
+    if filepath.Base(mat.KdMap) != "bricks.diffuse.jpg" {
+        t.Errorf("Unexpected texture path: %s", mat.KdMap)
+        return
+    }
+    if len(model.Warnings) != 1 ||
+        !strings.Contains(model.Warnings[0], "map_Kd") {
+        t.Errorf("Unexpected warnings: %v", model.Warnings)
+    }
+}
+
+func TestResolveTextureCaseInsensitive(t *testing.T) {
+    t.Log("Testing: Texture Resolution (Case Insensitive)")
+    dir := t.TempDir()
+    texDir := filepath.Join(dir, "Textures")
+    if err := os.Mkdir(texDir, 0755); err != nil { t.Fatal(err) }
+    texPath := filepath.Join(texDir, "Bricks.JPG")
+    if err := os.WriteFile(texPath, []byte{0}, 0644); err != nil {
+        t.Fatal(err)
+    }
+    materials := map[string]*Material{
+        "bricks": &Material{Name: "bricks", Folder: dir,
+            KdMap: "textures\\bricks.jpg", KsMap: "missing.png"},
+    }
+    warnings := ResolveTexturePaths(materials, true)
+    if materials["bricks"].KdMap != texPath {
+        t.Errorf("Unexpected texture path: %s", materials["bricks"].KdMap)
+    }
+    if len(warnings) != 1 || !strings.Contains(warnings[0], "map_Ks") {
+        t.Errorf("Unexpected warnings: %v", warnings)
+    }
+}
+
+func TestLoadTextures(t *testing.T) {
+    t.Log("Testing: Texture Decoding")
+    dir := t.TempDir()
+    img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+    img.Set(1, 1, color.NRGBA{255, 0, 0, 255})
+    f, err := os.Create(filepath.Join(dir, "red.png"))
+    if err != nil { t.Fatal(err) }
+    png.Encode(f, img)
+    f.Close()
+    err = os.WriteFile(filepath.Join(dir, "tex.raw"), []byte{7}, 0644)
+    if err != nil { t.Fatal(err) }
+    RegisterTextureDecoder(".RAW", func(r io.Reader) (image.Image, error) {
+        return image.NewGray(image.Rect(0, 0, 1, 1)), nil
+    })
+    materials := map[string]*Material{
+        "a": &Material{Name: "a", Folder: dir, KdMap: "red.png"},
+        "b": &Material{Name: "b", Folder: dir, KdMap: "red.png",
+            KsMap: "tex.raw"},
+    }
+    ResolveTexturePaths(materials, false)
+    cache := NewTextureCache()
+    textures, warnings := LoadTextures(materials, cache)
+    if len(warnings) != 0 { t.Errorf("Unexpected warnings: %v", warnings) }
+    if len(textures) != 2 {
+        t.Errorf("Unexpected number of textures: %d", len(textures))
+        return
+    }
+    red := textures[materials["a"].KdMap]
+    if red == nil || red.Bounds().Dx() != 2 {
+        t.Error("PNG texture not decoded")
+        return
+    }
+    if r, _, _, _ := red.At(1, 1).RGBA(); r != 0xffff {
+        t.Error("Unexpected texture data")
+    }
+    if _, ok := textures[materials["b"].KsMap].(*image.Gray); !ok {
+        t.Error("Registered decoder not used")
+    }
+    cached, err := cache.Load(materials["b"].KdMap)
+    if err != nil || cached != red {
+        t.Error("Texture not shared through cache")
+    }
+}
+
+func TestTextureCacheConcurrency(t *testing.T) {
+    t.Log("Testing: Concurrent Texture Decoding")
+    dir := t.TempDir()
+    paths := []string{filepath.Join(dir, "a.wait"),
+        filepath.Join(dir, "b.wait")}
+    for _, path := range paths {
+        if err := os.WriteFile(path, []byte{0}, 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    // Each decode waits for the other texture's decode to start
+    var decodes int32
+    both := make(chan struct{})
+    RegisterTextureDecoder(".wait", func(r io.Reader) (image.Image, error) {
+        if atomic.AddInt32(&decodes, 1) == 2 { close(both) }
+        select {
+        case <-both:
+        case <-time.After(time.Second):
+            return nil, fmt.Errorf("Textures decoded one at a time")
+        }
+        return image.NewGray(image.Rect(0, 0, 1, 1)), nil
+    })
+    cache := NewTextureCache()
+    images := make([]image.Image, 4)
+    errs := make([]error, 4)
+    var wg sync.WaitGroup
+    for i := range images {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            images[i], errs[i] = cache.Load(paths[i%2])
+        }(i)
+    }
+    wg.Wait()
+    for _, err := range errs {
+        if err != nil { t.Error(err); return }
+    }
+    if images[0] != images[2] || images[1] != images[3] {
+        t.Error("Texture not shared between concurrent loads")
+    }
+    if decodes != 2 { t.Errorf("Unexpected number of decodes %d", decodes) }
+}
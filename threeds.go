@@ -0,0 +1,407 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "math"
+    "path/filepath"
+)
+
+// Autodesk 3D Studio chunk IDs
+const (
+    threeDSMain = 0x4D4D
+    threeDSEditor = 0x3D3D
+    threeDSObject = 0x4000
+    threeDSTriMesh = 0x4100
+    threeDSVertices = 0x4110
+    threeDSFaces = 0x4120
+    threeDSFaceMaterial = 0x4130
+    threeDSTexCoords = 0x4140
+    threeDSSmoothing = 0x4150
+    threeDSMaterial = 0xAFFF
+    threeDSMatName = 0xA000
+    threeDSMatAmbient = 0xA010
+    threeDSMatDiffuse = 0xA020
+    threeDSMatSpecular = 0xA030
+    threeDSMatShininess = 0xA040
+    threeDSMatTransparency = 0xA050
+    threeDSMatTexture = 0xA200
+    threeDSMatSpecularMap = 0xA204
+    threeDSMapFile = 0xA300
+    threeDSColorF = 0x0010
+    threeDSColor24 = 0x0011
+    threeDSLinColor24 = 0x0012
+    threeDSLinColorF = 0x0013
+    threeDSPercentInt = 0x0030
+    threeDSPercentF = 0x0031
+)
+
+func init() {
+    RegisterFormat(&Format{Name: "3ds", Extensions: []string{".3ds"},
+        Sniff: func(header []byte) bool {
+            if len(header) < 8 { return false }
+            le := binary.LittleEndian
+            sub := le.Uint16(header[6:])
+            return le.Uint16(header) == threeDSMain &&
+                (sub == 0x0002 || sub == threeDSEditor)
+        },
+        Load: Load3DS})
+}
+
+// Load3DS loads a 3D Studio file. See Load3DSFrom.
+func Load3DS(tdsPath string, opts *LoadOptions) (*Model, error) {
+    f, err := openFile(tdsPath)
+    if err != nil { return nil, err }
+    defer f.Close()
+    return Load3DSFrom(f, filepath.Dir(tdsPath), opts)
+}
+
+// threeDSFace is a triangle of a 3DS object.
+type threeDSFace struct {
+    v [3]uint16
+    smoothing uint32
+}
+
+// threeDSMesh is a named triangle mesh object of a 3DS file.
+type threeDSMesh struct {
+    name string
+    vertices [][3]float32
+    texCoords [][2]float32
+    faces []threeDSFace
+    // Face indices by material, in the order the materials are assigned
+    materialNames []string
+    materialFaces map[string][]uint16
+}
+
+// Load3DSFrom loads the meshes and materials of a 3D Studio file. Each
+// named object becomes a mesh object per material it uses, named
+// "<object>" if it uses a single material and "<object>_<material>"
+// otherwise. Normals are computed from the smoothing groups: faces
+// sharing a vertex and a smoothing group are smoothed, faces without one
+// are flat. Coordinates are converted from 3DS's Z up to Y up. Texture
+// map names are relative to dir. Lights, cameras and keyframer data are
+// ignored. A nil opts is equivalent to the zero LoadOptions.
+func Load3DSFrom(reader io.Reader, dir string,
+    opts *LoadOptions) (*Model, error) {
+    if opts == nil { opts = &LoadOptions{} }
+    data, err := io.ReadAll(reader)
+    if err != nil { return nil, err }
+    if len(data) < 6 ||
+        binary.LittleEndian.Uint16(data) != threeDSMain {
+        return nil, fmt.Errorf("Not a 3DS file")
+    }
+    model := &Model{Materials: make(map[string]*Material)}
+    objects := make([]*threeDSMesh, 0)
+    err = threeDSChunks(data, func(id uint16, body []byte) error {
+        if id != threeDSMain { return nil }
+        return threeDSChunks(body, func(id uint16, body []byte) error {
+            if id != threeDSEditor { return nil }
+            return threeDSChunks(body, func(id uint16, body []byte) error {
+                switch id {
+                case threeDSMaterial:
+                    mat, err := parse3DSMaterial(body, dir)
+                    if err != nil { return err }
+                    model.Materials[mat.Name] = mat
+                case threeDSObject:
+                    name, rest := threeDSString(body)
+                    obj := &threeDSMesh{name: name,
+                        materialFaces: make(map[string][]uint16)}
+                    err := threeDSChunks(rest, func(id uint16,
+                        body []byte) error {
+                        if id != threeDSTriMesh { return nil }
+                        return parse3DSTriMesh(body, obj)
+                    })
+                    if err != nil { return err }
+                    if len(obj.faces) > 0 { objects = append(objects, obj) }
+                }
+                return nil
+            })
+        })
+    })
+    if err != nil { return nil, err }
+
+    hasTexCoords := false
+    for _, obj := range objects {
+        hasTexCoords = hasTexCoords || len(obj.texCoords) > 0
+    }
+    b := newMeshBuilder(opts.Index, true, hasTexCoords)
+    for _, obj := range objects {
+        if err := add3DSObject(b, obj, model); err != nil { return nil, err }
+    }
+    model.Mesh = b.mesh()
+    processTextures(model, opts)
+    return model, nil
+}
+
+// threeDSChunks calls fn for each chunk in data.
+func threeDSChunks(data []byte, fn func(id uint16, body []byte) error) error {
+    le := binary.LittleEndian
+    for len(data) >= 6 {
+        id := le.Uint16(data)
+        length := le.Uint32(data[2:])
+        if length < 6 || uint64(length) > uint64(len(data)) {
+            return fmt.Errorf("Corrupt 3DS chunk %04X", id)
+        }
+        if err := fn(id, data[6:length]); err != nil { return err }
+        data = data[length:]
+    }
+    return nil
+}
+
+// threeDSString splits a NUL terminated string off data.
+func threeDSString(data []byte) (string, []byte) {
+    i := bytes.IndexByte(data, 0)
+    if i < 0 { return string(data), nil }
+    return string(data[:i]), data[i+1:]
+}
+
+func parse3DSTriMesh(data []byte, obj *threeDSMesh) error {
+    le := binary.LittleEndian
+    corrupt := fmt.Errorf("Corrupt 3DS object %s", obj.name)
+    return threeDSChunks(data, func(id uint16, body []byte) error {
+        switch id {
+        case threeDSVertices:
+            if len(body) < 2 { return corrupt }
+            n := int(le.Uint16(body))
+            if len(body) < 2 + n*12 { return corrupt }
+            obj.vertices = make([][3]float32, n)
+            for i := range obj.vertices {
+                for c := 0; c < 3; c++ {
+                    obj.vertices[i][c] = math.Float32frombits(
+                        le.Uint32(body[2+i*12+c*4:]))
+                }
+            }
+        case threeDSTexCoords:
+            if len(body) < 2 { return corrupt }
+            n := int(le.Uint16(body))
+            if len(body) < 2 + n*8 { return corrupt }
+            obj.texCoords = make([][2]float32, n)
+            for i := range obj.texCoords {
+                for c := 0; c < 2; c++ {
+                    obj.texCoords[i][c] = math.Float32frombits(
+                        le.Uint32(body[2+i*8+c*4:]))
+                }
+            }
+        case threeDSFaces:
+            if len(body) < 2 { return corrupt }
+            n := int(le.Uint16(body))
+            if len(body) < 2 + n*8 { return corrupt }
+            obj.faces = make([]threeDSFace, n)
+            for i := range obj.faces {
+                for c := 0; c < 3; c++ {
+                    obj.faces[i].v[c] = le.Uint16(body[2+i*8+c*2:])
+                }
+            }
+            return threeDSChunks(body[2+n*8:], func(id uint16,
+                body []byte) error {
+                switch id {
+                case threeDSFaceMaterial:
+                    name, rest := threeDSString(body)
+                    if len(rest) < 2 { return corrupt }
+                    n := int(le.Uint16(rest))
+                    if len(rest) < 2 + n*2 { return corrupt }
+                    if _, ok := obj.materialFaces[name]; !ok {
+                        obj.materialNames = append(obj.materialNames, name)
+                    }
+                    for i := 0; i < n; i++ {
+                        obj.materialFaces[name] = append(
+                            obj.materialFaces[name], le.Uint16(rest[2+i*2:]))
+                    }
+                case threeDSSmoothing:
+                    if len(body) < len(obj.faces)*4 { return corrupt }
+                    for i := range obj.faces {
+                        obj.faces[i].smoothing = le.Uint32(body[i*4:])
+                    }
+                }
+                return nil
+            })
+        }
+        return nil
+    })
+}
+
+func parse3DSMaterial(data []byte, dir string) (*Material, error) {
+    mat := colorMaterial("", [3]float32{0.8, 0.8, 0.8})
+    mat.Folder = dir
+    err := threeDSChunks(data, func(id uint16, body []byte) error {
+        switch id {
+        case threeDSMatName:
+            mat.Name, _ = threeDSString(body)
+        case threeDSMatAmbient:
+            mat.Ka = parse3DSColor(body, mat.Ka)
+        case threeDSMatDiffuse:
+            mat.Kd = parse3DSColor(body, mat.Kd)
+        case threeDSMatSpecular:
+            mat.Ks = parse3DSColor(body, mat.Ks)
+        case threeDSMatShininess:
+            // Same scale as the shininess of X3D and VRML
+            mat.Ns = parse3DSPercent(body, 0) * 128
+        case threeDSMatTransparency:
+            mat.Tr = 1 - parse3DSPercent(body, 0)
+        case threeDSMatTexture, threeDSMatSpecularMap:
+            return threeDSChunks(body, func(sub uint16, body []byte) error {
+                if sub != threeDSMapFile { return nil }
+                name, _ := threeDSString(body)
+                if id == threeDSMatTexture {
+                    mat.KdMap = name
+                } else {
+                    mat.KsMap = name
+                }
+                return nil
+            })
+        }
+        return nil
+    })
+    return mat, err
+}
+
+// parse3DSColor returns the first colour in data, preferring the gamma
+// corrected variants, or def if there is none.
+func parse3DSColor(data []byte, def []float32) []float32 {
+    var color []float32
+    threeDSChunks(data, func(id uint16, body []byte) error {
+        switch {
+        case (id == threeDSColorF || id == threeDSLinColorF) &&
+            len(body) >= 12:
+            if color != nil && id == threeDSLinColorF { return nil }
+            color = make([]float32, 3)
+            for c := 0; c < 3; c++ {
+                color[c] = math.Float32frombits(
+                    binary.LittleEndian.Uint32(body[c*4:]))
+            }
+        case (id == threeDSColor24 || id == threeDSLinColor24) &&
+            len(body) >= 3:
+            if color != nil && id == threeDSLinColor24 { return nil }
+            color = []float32{float32(body[0]) / 255,
+                float32(body[1]) / 255, float32(body[2]) / 255}
+        }
+        return nil
+    })
+    if color == nil { return def }
+    return color
+}
+
+// parse3DSPercent returns the percentage in data as a fraction.
+func parse3DSPercent(data []byte, def float32) float32 {
+    value := def
+    threeDSChunks(data, func(id uint16, body []byte) error {
+        switch {
+        case id == threeDSPercentInt && len(body) >= 2:
+            value = float32(int16(binary.LittleEndian.Uint16(body))) / 100
+        case id == threeDSPercentF && len(body) >= 4:
+            value = math.Float32frombits(
+                binary.LittleEndian.Uint32(body)) / 100
+        }
+        return nil
+    })
+    return value
+}
+
+// add3DSObject adds the faces of obj to b, one mesh object per material.
+func add3DSObject(b *meshBuilder, obj *threeDSMesh, model *Model) error {
+    for _, f := range obj.faces {
+        for _, v := range f.v {
+            if int(v) >= len(obj.vertices) {
+                return fmt.Errorf("3DS object %s: face vertex out of range",
+                    obj.name)
+            }
+        }
+    }
+    positions := make([][3]float32, len(obj.vertices))
+    for i, p := range obj.vertices {
+        copy(positions[i][:], zUpToYUp(p))
+    }
+    normals := threeDSNormals(obj, positions)
+
+    // Faces without material come last
+    assigned := make([]bool, len(obj.faces))
+    groups := make([][]uint16, 0, len(obj.materialNames) + 1)
+    names := make([]string, 0, len(obj.materialNames) + 1)
+    for _, name := range obj.materialNames {
+        faces := make([]uint16, 0, len(obj.materialFaces[name]))
+        for _, f := range obj.materialFaces[name] {
+            if int(f) < len(obj.faces) && !assigned[f] {
+                assigned[f] = true
+                faces = append(faces, f)
+            }
+        }
+        groups = append(groups, faces)
+        names = append(names, name)
+    }
+    unassigned := make([]uint16, 0)
+    for f := range obj.faces {
+        if !assigned[f] { unassigned = append(unassigned, uint16(f)) }
+    }
+    groups = append(groups, unassigned)
+    names = append(names, "")
+
+    used := 0
+    for _, faces := range groups {
+        if len(faces) > 0 { used++ }
+    }
+    for g, faces := range groups {
+        if len(faces) == 0 { continue }
+        name := obj.name
+        if used > 1 && names[g] != "" { name += "_" + names[g] }
+        materialRef := names[g]
+        if _, ok := model.Materials[materialRef]; !ok && materialRef != "" {
+            model.Warnings = append(model.Warnings, fmt.Sprintf(
+                "3DS object %s: unknown material %s", obj.name, materialRef))
+            materialRef = ""
+        }
+        b.beginObject(name, materialRef, true)
+        for _, f := range faces {
+            for c, v := range obj.faces[f].v {
+                vertex := &meshVertex{Position: positions[v],
+                    Normal: normals[int(f)*3+c]}
+                if int(v) < len(obj.texCoords) {
+                    vertex.TexCoord = obj.texCoords[v]
+                }
+                b.addVertex(vertex)
+            }
+        }
+    }
+    return nil
+}
+
+// threeDSNormals returns the normal of each face corner. Corners are
+// smoothed with the other faces at the same vertex that share a smoothing
+// group.
+func threeDSNormals(obj *threeDSMesh, positions [][3]float32) [][3]float32 {
+    faceNormals := make([][3]float64, len(obj.faces))
+    incident := make([][]int, len(positions))
+    for f, face := range obj.faces {
+        a, b, c := positions[face.v[0]], positions[face.v[1]],
+            positions[face.v[2]]
+        // The unnormalised cross product is weighted by triangle area
+        u := [3]float64{float64(b[0] - a[0]), float64(b[1] - a[1]),
+            float64(b[2] - a[2])}
+        w := [3]float64{float64(c[0] - a[0]), float64(c[1] - a[1]),
+            float64(c[2] - a[2])}
+        faceNormals[f] = [3]float64{
+            u[1]*w[2] - u[2]*w[1],
+            u[2]*w[0] - u[0]*w[2],
+            u[0]*w[1] - u[1]*w[0],
+        }
+        for _, v := range face.v { incident[v] = append(incident[v], f) }
+    }
+    normals := make([][3]float32, len(obj.faces)*3)
+    for f, face := range obj.faces {
+        for c, v := range face.v {
+            sum := faceNormals[f]
+            if face.smoothing != 0 {
+                for _, other := range incident[v] {
+                    if other == f ||
+                        obj.faces[other].smoothing & face.smoothing == 0 {
+                        continue
+                    }
+                    for i := 0; i < 3; i++ { sum[i] += faceNormals[other][i] }
+                }
+            }
+            normals[f*3+c] = normalize3(sum)
+        }
+    }
+    return normals
+}
@@ -0,0 +1,108 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/binary"
+    "math"
+    "strings"
+    "testing"
+)
+
+// threeDSChunk encodes a 3DS chunk with the given body parts.
+func threeDSChunk(id uint16, parts ...interface{}) []byte {
+    var body bytes.Buffer
+    for _, part := range parts {
+        switch p := part.(type) {
+        case string:
+            body.WriteString(p)
+            body.WriteByte(0)
+        case []byte:
+            body.Write(p)
+        default:
+            binary.Write(&body, binary.LittleEndian, p)
+        }
+    }
+    var buf bytes.Buffer
+    binary.Write(&buf, binary.LittleEndian, id)
+    binary.Write(&buf, binary.LittleEndian, uint32(body.Len() + 6))
+    buf.Write(body.Bytes())
+    return buf.Bytes()
+}
+
+// threeDSTestData builds a 3DS file with a material and an object made of
+// two triangles folded along their shared edge, the first using the
+// material and both in the given smoothing groups.
+func threeDSTestData(smoothing [2]uint32) []byte {
+    material := threeDSChunk(threeDSMaterial,
+        threeDSChunk(threeDSMatName, "red"),
+        threeDSChunk(threeDSMatDiffuse,
+            threeDSChunk(threeDSColor24, []byte{255, 0, 0})),
+        threeDSChunk(threeDSMatSpecular,
+            threeDSChunk(threeDSColorF, []float32{0.5, 0.5, 0.5})),
+        threeDSChunk(threeDSMatShininess,
+            threeDSChunk(threeDSPercentInt, int16(50))),
+        threeDSChunk(threeDSMatTransparency,
+            threeDSChunk(threeDSPercentInt, int16(25))),
+        threeDSChunk(threeDSMatTexture,
+            threeDSChunk(threeDSMapFile, "red.png")))
+    faces := threeDSChunk(threeDSFaces, uint16(2),
+        []uint16{0, 1, 2, 0, 0, 2, 3, 0},
+        threeDSChunk(threeDSFaceMaterial, "red", uint16(1), uint16(0)),
+        threeDSChunk(threeDSSmoothing, smoothing[:]))
+    object := threeDSChunk(threeDSObject, "roof",
+        threeDSChunk(threeDSTriMesh,
+            threeDSChunk(threeDSVertices, uint16(4),
+                []float32{0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1}),
+            threeDSChunk(threeDSTexCoords, uint16(4),
+                []float32{0, 0, 1, 0, 0, 1, 1, 1}),
+            faces))
+    return threeDSChunk(threeDSMain, threeDSChunk(0x0002, uint32(3)),
+        threeDSChunk(threeDSEditor, material, object))
+}
+
+func TestLoad3DS(t *testing.T) {
+    t.Log("Testing: 3DS Import")
+    model, err := Load3DSFrom(bytes.NewReader(threeDSTestData(
+        [2]uint32{1, 3})), "maps", nil)
+    if err != nil { t.Error(err); return }
+    s := float32(1 / math.Sqrt(2))
+    checkMesh(t, model.Mesh,
+        []float32{0, 0, 0, 1, 0, 0, 0, 0, -1, 0, 0, 0, 0, 0, -1, 0, 1, 0},
+        []float32{0, 0, 1, 0, 0, 1, 0, 0, 0, 1, 1, 1},
+        []float32{s, s, 0, 0, 1, 0, s, s, 0, s, s, 0, s, s, 0, 1, 0, 0},
+        nil,
+        []*MeshObject{&MeshObject{"roof_red", 0, 3, "red", true},
+            &MeshObject{"roof", 3, 3, "", true}})
+    red := colorMaterial("red", [3]float32{1, 0, 0})
+    red.Ks = []float32{0.5, 0.5, 0.5}
+    red.Ns = 64
+    red.Tr = 0.75
+    red.KdMap = "red.png"
+    checkMaterials(t, model.Materials, []*Material{red})
+    if model.Materials["red"].Folder != "maps" {
+        t.Errorf("Unexpected texture folder: %s",
+            model.Materials["red"].Folder)
+    }
+
+    // Without a common smoothing group the faces stay flat
+    model, err = Load3DSFrom(bytes.NewReader(threeDSTestData(
+        [2]uint32{1, 2})), "", &LoadOptions{Index: true})
+    if err != nil { t.Error(err); return }
+    checkFloats(t, "Flat normals", model.Mesh.Normals,
+        []float32{0, 1, 0, 0, 1, 0, 0, 1, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0})
+    if len(model.Mesh.VertexIndex) != 6 {
+        t.Errorf("Unexpected index: %v", model.Mesh.VertexIndex)
+    }
+
+    data := threeDSTestData([2]uint32{1, 1})
+    _, err = Load3DSFrom(bytes.NewReader(data[:len(data)-3]), "", nil)
+    if err == nil || !strings.Contains(err.Error(), "Corrupt") {
+        t.Errorf("Expected corrupt file error, got %v", err)
+    }
+    format := findFormat(func(f *Format) bool {
+        return f.Sniff != nil && f.Sniff(data)
+    })
+    if format == nil || format.Name != "3ds" {
+        t.Errorf("3DS file not detected")
+    }
+}
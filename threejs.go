@@ -0,0 +1,196 @@
+package go3dm
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "math"
+    "sort"
+)
+
+// three.js JSON BufferGeometry, as read by THREE.BufferGeometryLoader
+
+func init() {
+    RegisterFormat(&Format{Name: "threejs", Extensions: []string{".json"},
+        Save: func(path string, mesh *TriangleMesh,
+            materials map[string]*Material, opts *SaveOptions) error {
+            return writeFile(path, func(w io.Writer) error {
+                return WriteThreeJS(w, mesh, materials)
+            })
+        },
+    })
+}
+
+type threeJSGeometry struct {
+    Metadata threeJSMetadata `json:"metadata"`
+    Type string `json:"type"`
+    Data threeJSData `json:"data"`
+    UserData threeJSUserData `json:"userData"`
+}
+
+type threeJSMetadata struct {
+    Version float32 `json:"version"`
+    Type string `json:"type"`
+    Generator string `json:"generator"`
+}
+
+type threeJSData struct {
+    Attributes map[string]*threeJSAttribute `json:"attributes"`
+    Morphs map[string][]*threeJSAttribute `json:"morphAttributes,omitempty"`
+    MorphTargetsRelative bool `json:"morphTargetsRelative"`
+    Index *threeJSIndex `json:"index,omitempty"`
+    Groups []*threeJSGroup `json:"groups,omitempty"`
+}
+
+type threeJSAttribute struct {
+    Name string `json:"name,omitempty"`
+    ItemSize int `json:"itemSize"`
+    Type string `json:"type"`
+    Array []float32 `json:"array"`
+    Normalized bool `json:"normalized"`
+}
+
+type threeJSIndex struct {
+    Type string `json:"type"`
+    Array []uint32 `json:"array"`
+}
+
+type threeJSGroup struct {
+    Start int32 `json:"start"`
+    Count int32 `json:"count"`
+    MaterialIndex int `json:"materialIndex"`
+}
+
+type threeJSUserData struct {
+    // Names of the mesh objects, one per group
+    Objects []string `json:"objects"`
+    // Material names and materials by materialIndex, the materials are
+    // null if unknown
+    MaterialNames []string `json:"materialNames"`
+    Materials []*Material `json:"materials"`
+}
+
+// threeJSAttributeNames maps vertex attributes to the names three.js uses
+// for skinning.
+var threeJSAttributeNames = map[string]string{
+    JointsAttribute: "skinIndex",
+    WeightsAttribute: "skinWeight",
+}
+
+// WriteThreeJS writes mesh as three.js JSON BufferGeometry (format 4).
+// Positions, normals, texture coordinates ("uv"), RGBA vertex colours and
+// vertex attributes become geometry attributes, joints and weights under
+// three.js's skinIndex and skinWeight names, morph frames become morph
+// attributes. Each mesh object becomes a group whose materialIndex counts
+// the distinct materials in order of first use. The object names and the
+// materials by index are stored in the geometry's userData. JSON has no
+// NaN or infinite numbers, attributes containing them are rejected.
+func WriteThreeJS(writer io.Writer, mesh *TriangleMesh,
+    materials map[string]*Material) error {
+    vertexCount := len(mesh.Vertices) / 3
+    attribute := func(name string, size int,
+        values []float32) *threeJSAttribute {
+        return &threeJSAttribute{Name: name, ItemSize: size,
+            Type: "Float32Array", Array: values}
+    }
+    data := threeJSData{Attributes: map[string]*threeJSAttribute{
+        "position": attribute("", 3, mesh.Vertices[:vertexCount*3]),
+    }}
+    if len(mesh.Normals) >= vertexCount*3 {
+        data.Attributes["normal"] = attribute("", 3,
+            mesh.Normals[:vertexCount*3])
+    }
+    if len(mesh.TextureCoords) >= vertexCount*2 {
+        data.Attributes["uv"] = attribute("", 2,
+            mesh.TextureCoords[:vertexCount*2])
+    }
+    if len(mesh.Colors) >= vertexCount*4 {
+        data.Attributes["color"] = attribute("", 4,
+            mesh.Colors[:vertexCount*4])
+    }
+    for _, attr := range mesh.Attributes {
+        name := attr.Name
+        if mapped, ok := threeJSAttributeNames[name]; ok { name = mapped }
+        _, exists := data.Attributes[name]
+        if exists || attr.Size <= 0 ||
+            len(attr.Values) < vertexCount*attr.Size {
+            continue
+        }
+        data.Attributes[name] = attribute("", attr.Size,
+            attr.Values[:vertexCount*attr.Size])
+    }
+    for _, frame := range mesh.MorphFrames {
+        if len(frame.Vertices) < vertexCount*3 { continue }
+        if data.Morphs == nil {
+            data.Morphs = make(map[string][]*threeJSAttribute)
+        }
+        data.Morphs["position"] = append(data.Morphs["position"],
+            attribute(frame.Name, 3, frame.Vertices[:vertexCount*3]))
+        if len(frame.Normals) >= vertexCount*3 {
+            data.Morphs["normal"] = append(data.Morphs["normal"],
+                attribute(frame.Name, 3, frame.Normals[:vertexCount*3]))
+        }
+    }
+    if mesh.VertexIndex != nil {
+        data.Index = &threeJSIndex{Type: "Uint32Array",
+            Array: mesh.VertexIndex}
+        if vertexCount <= 65536 { data.Index.Type = "Uint16Array" }
+    }
+
+    userData := threeJSUserData{Objects: make([]string, 0),
+        MaterialNames: make([]string, 0), Materials: make([]*Material, 0)}
+    materialIndex := make(map[string]int)
+    for _, mo := range mesh.Objects {
+        if mo.VertexOffset < 0 { continue }
+        idx, ok := materialIndex[mo.MaterialRef]
+        if !ok {
+            idx = len(userData.MaterialNames)
+            materialIndex[mo.MaterialRef] = idx
+            userData.MaterialNames = append(userData.MaterialNames,
+                mo.MaterialRef)
+            userData.Materials = append(userData.Materials,
+                materials[mo.MaterialRef])
+        }
+        data.Groups = append(data.Groups, &threeJSGroup{mo.VertexOffset,
+            mo.VertexCount, idx})
+        userData.Objects = append(userData.Objects, mo.Name)
+    }
+
+    if err := data.checkFinite(); err != nil { return err }
+    geometry := &threeJSGeometry{
+        Metadata: threeJSMetadata{4.6, "BufferGeometry", "go3dm"},
+        Type: "BufferGeometry",
+        Data: data,
+        UserData: userData,
+    }
+    return json.NewEncoder(writer).Encode(geometry)
+}
+
+// checkFinite returns an error naming the first attribute with a NaN or
+// infinite value, which encoding/json would reject without saying where.
+func (data *threeJSData) checkFinite() error {
+    check := func(name string, values []float32) error {
+        for _, v := range values {
+            if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+                return fmt.Errorf("three.js attribute %s: unsupported "+
+                    "value %g", name, v)
+            }
+        }
+        return nil
+    }
+    names := make([]string, 0, len(data.Attributes))
+    for name := range data.Attributes { names = append(names, name) }
+    sort.Strings(names)
+    for _, name := range names {
+        if err := check(name, data.Attributes[name].Array); err != nil {
+            return err
+        }
+    }
+    for _, name := range []string{"position", "normal"} {
+        for _, attr := range data.Morphs[name] {
+            err := check(name + " of morph " + attr.Name, attr.Array)
+            if err != nil { return err }
+        }
+    }
+    return nil
+}
@@ -0,0 +1,103 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/json"
+    "math"
+    "strings"
+    "testing"
+)
+
+func TestWriteThreeJS(t *testing.T) {
+    t.Log("Testing: three.js BufferGeometry Export")
+    mesh, materials, err := LoadOBJ("test-meshes/cubes.obj", true)
+    if err != nil { t.Error(err); return }
+    var buf bytes.Buffer
+    if err = WriteThreeJS(&buf, mesh, materials); err != nil {
+        t.Error(err)
+        return
+    }
+    var doc threeJSGeometry
+    if err = json.Unmarshal(buf.Bytes(), &doc); err != nil {
+        t.Error(err)
+        return
+    }
+    if doc.Metadata.Type != "BufferGeometry" ||
+        doc.Type != "BufferGeometry" {
+        t.Errorf("Unexpected geometry type %v", doc.Metadata)
+    }
+    checkFloats(t, "Positions", doc.Data.Attributes["position"].Array,
+        mesh.Vertices)
+    checkFloats(t, "Normals", doc.Data.Attributes["normal"].Array,
+        mesh.Normals)
+    if _, ok := doc.Data.Attributes["uv"]; ok {
+        t.Error("Unexpected uv attribute")
+    }
+    index := doc.Data.Index
+    if index == nil || index.Type != "Uint16Array" ||
+        len(index.Array) != len(mesh.VertexIndex) {
+        t.Errorf("Unexpected index %v", index)
+    }
+    if len(doc.Data.Groups) != len(mesh.Objects) {
+        t.Errorf("Expected %d groups, got %d", len(mesh.Objects),
+            len(doc.Data.Groups))
+        return
+    }
+    for i, mo := range mesh.Objects {
+        group := doc.Data.Groups[i]
+        if group.Start != mo.VertexOffset || group.Count != mo.VertexCount ||
+            group.MaterialIndex != i {
+            t.Errorf("Unexpected group %v for %s", group, mo.Name)
+        }
+        if doc.UserData.Objects[i] != mo.Name ||
+            doc.UserData.MaterialNames[i] != mo.MaterialRef ||
+            !doc.UserData.Materials[i].Equals(materials[mo.MaterialRef]) {
+            t.Errorf("Unexpected user data for %s", mo.Name)
+        }
+    }
+    if bytes.Contains(buf.Bytes(), []byte(`"folder"`)) {
+        t.Error("Local material folder exported")
+    }
+
+    mesh.Attributes = []*VertexAttribute{&VertexAttribute{"range", 1,
+        make([]float32, len(mesh.Vertices) / 3)}}
+    mesh.Attributes[0].Values[2] = float32(math.NaN())
+    err = WriteThreeJS(&buf, mesh, materials)
+    if err == nil || !strings.Contains(err.Error(), "range") {
+        t.Errorf("Expected error naming the NaN attribute, got %v", err)
+    }
+}
+
+func TestMeshJSON(t *testing.T) {
+    t.Log("Testing: TriangleMesh JSON Encoding")
+    mesh, materials, err := LoadOBJ("test-meshes/cubes.obj", true)
+    if err != nil { t.Error(err); return }
+    data, err := json.Marshal(mesh)
+    if err != nil { t.Error(err); return }
+    for _, field := range []string{`"vertices":`, `"vertexIndex":`,
+        `"objects":[{"name":"redCube","vertexOffset":0,`} {
+        if !bytes.Contains(data, []byte(field)) {
+            t.Errorf("Missing %s in %s", field, data[:80])
+        }
+    }
+    if bytes.Contains(data, []byte(`"textureCoords"`)) {
+        t.Error("Empty texture coordinates not omitted")
+    }
+    var decoded TriangleMesh
+    if err = json.Unmarshal(data, &decoded); err != nil {
+        t.Error(err)
+        return
+    }
+    checkMesh(t, &decoded, cubesIndexedVertices, nil, cubesIndexedNormals,
+        cubesVertexIndex, cubesObjects)
+
+    data, err = json.Marshal(materials["blueCube"])
+    if err != nil { t.Error(err); return }
+    var mat Material
+    if err = json.Unmarshal(data, &mat); err != nil {
+        t.Error(err)
+        return
+    }
+    checkMaterials(t, map[string]*Material{mat.Name: &mat},
+        cubesMaterials[:1])
+}
@@ -0,0 +1,490 @@
+package go3dm
+
+import (
+    "archive/zip"
+    "bufio"
+    "bytes"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+)
+
+// 3MF package structure
+
+const (
+    threeMFModelPath = "3D/3dmodel.model"
+    threeMFRelType =
+        "http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"
+    threeMFCoreNS =
+        "http://schemas.microsoft.com/3dmanufacturing/core/2015/02"
+)
+
+// Namespaces of the extensions the loader supports, which files may list
+// in their required extensions. Colour groups are part of the materials
+// extension, model file references of the production extension.
+var threeMFExtensions = map[string]bool{
+    "http://schemas.microsoft.com/3dmanufacturing/material/2015/02": true,
+    "http://schemas.microsoft.com/3dmanufacturing/production/2015/06": true,
+}
+
+// Size of 3MF units in millimetres
+var threeMFUnits = map[string]float64{
+    "micron": 0.001, "millimeter": 1, "centimeter": 10,
+    "inch": 25.4, "foot": 304.8, "meter": 1000,
+}
+
+type threeMFModel struct {
+    Unit string `xml:"unit,attr"`
+    RequiredExtensions string `xml:"requiredextensions,attr"`
+    BaseMaterials []*threeMFBaseMaterials `xml:"resources>basematerials"`
+    ColorGroups []*threeMFColorGroup `xml:"resources>colorgroup"`
+    Objects []*threeMFObject `xml:"resources>object"`
+    Items []*threeMFComponent `xml:"build>item"`
+    // Including the namespace declarations
+    Attrs []xml.Attr `xml:",any,attr"`
+}
+
+type threeMFBaseMaterials struct {
+    ID int `xml:"id,attr"`
+    Bases []struct {
+        Name string `xml:"name,attr"`
+        DisplayColor string `xml:"displaycolor,attr"`
+    } `xml:"base"`
+}
+
+type threeMFColorGroup struct {
+    ID int `xml:"id,attr"`
+    Colors []struct {
+        Color string `xml:"color,attr"`
+    } `xml:"color"`
+}
+
+type threeMFObject struct {
+    ID int `xml:"id,attr"`
+    Name string `xml:"name,attr"`
+    PID string `xml:"pid,attr"`
+    PIndex string `xml:"pindex,attr"`
+    Vertices []struct {
+        X float32 `xml:"x,attr"`
+        Y float32 `xml:"y,attr"`
+        Z float32 `xml:"z,attr"`
+    } `xml:"mesh>vertices>vertex"`
+    Triangles []struct {
+        V1 int `xml:"v1,attr"`
+        V2 int `xml:"v2,attr"`
+        V3 int `xml:"v3,attr"`
+        PID string `xml:"pid,attr"`
+        P1 string `xml:"p1,attr"`
+    } `xml:"mesh>triangles>triangle"`
+    Components []*threeMFComponent `xml:"components>component"`
+}
+
+// threeMFComponent is a component of an object or an item of the build.
+type threeMFComponent struct {
+    ObjectID int `xml:"objectid,attr"`
+    Transform string `xml:"transform,attr"`
+    // Model file of the object (production extension)
+    Path string `xml:"path,attr"`
+}
+
+func init() {
+    RegisterFormat(&Format{Name: "3mf", Extensions: []string{".3mf"},
+        Sniff: func(header []byte) bool {
+            return bytes.HasPrefix(header, []byte("PK\x03\x04")) &&
+                bytes.Contains(header, []byte("3D/"))
+        },
+        Load: Load3MF,
+        Save: func(path string, mesh *TriangleMesh,
+            materials map[string]*Material, opts *SaveOptions) error {
+            return writeFile(path, func(w io.Writer) error {
+                return Write3MF(w, mesh, materials)
+            })
+        },
+    })
+}
+
+// Load3MF loads a 3MF file. See Load3MFFrom.
+func Load3MF(tmfPath string, opts *LoadOptions) (*Model, error) {
+    f, err := os.Open(tmfPath)
+    if err != nil { return nil, err }
+    defer f.Close()
+    info, err := f.Stat()
+    if err != nil { return nil, err }
+    return Load3MFFrom(f, info.Size(), opts)
+}
+
+// Load3MFFrom loads a 3MF package of the given size. Every build item is
+// added to the mesh with its transform applied, objects made of
+// components are flattened. Coordinates are converted to millimetres.
+// Triangles are grouped into one mesh object per object and material
+// run. Base materials become materials with the display colour as
+// diffuse colour, colour group entries become colour materials. Models
+// requiring extensions other than the materials and production extensions
+// are refused, as the 3MF specification demands.
+func Load3MFFrom(reader io.ReaderAt, size int64,
+    opts *LoadOptions) (*Model, error) {
+    if opts == nil { opts = &LoadOptions{} }
+    archive, err := zip.NewReader(reader, size)
+    if err != nil { return nil, fmt.Errorf("Not a 3MF package: %v", err) }
+    files := make(map[string]*zip.File)
+    for _, f := range archive.File {
+        files[strings.TrimPrefix(f.Name, "/")] = f
+    }
+    modelPath := threeMFRootModel(files)
+    l := &threeMFLoader{files: files,
+        models: make(map[string]*threeMFModel),
+        mesh: &TriangleMesh{Objects: make([]*MeshObject, 0)},
+        model: &Model{Materials: make(map[string]*Material)},
+        materialRefs: make(map[string]string)}
+    root, err := l.loadModel(modelPath)
+    if err != nil { return nil, err }
+    scale, ok := threeMFUnits[root.Unit]
+    if root.Unit == "" { scale, ok = 1, true }
+    if !ok { return nil, fmt.Errorf("Unknown 3MF unit %s", root.Unit) }
+    unit := identityMat4
+    unit[0], unit[5], unit[10] = scale, scale, scale
+    for _, item := range root.Items {
+        transform, err := parse3MFTransform(item.Transform)
+        if err != nil { return nil, err }
+        err = l.addObject(modelPath, item, unit.mul(transform), 0)
+        if err != nil { return nil, err }
+    }
+    if len(l.mesh.Vertices) == 0 {
+        return nil, fmt.Errorf("3MF build contains no triangles")
+    }
+    if !opts.Index { unindex(l.mesh) }
+    l.model.Mesh = l.mesh
+    processTextures(l.model, opts)
+    return l.model, nil
+}
+
+// threeMFRootModel returns the path of the root model part, as given by
+// the package relationships.
+func threeMFRootModel(files map[string]*zip.File) string {
+    var rels struct {
+        Relationships []struct {
+            Target string `xml:"Target,attr"`
+            Type string `xml:"Type,attr"`
+        } `xml:"Relationship"`
+    }
+    if f, ok := files["_rels/.rels"]; ok {
+        if r, err := f.Open(); err == nil {
+            xml.NewDecoder(r).Decode(&rels)
+            r.Close()
+        }
+    }
+    for _, rel := range rels.Relationships {
+        if rel.Type == threeMFRelType {
+            return strings.TrimPrefix(rel.Target, "/")
+        }
+    }
+    return threeMFModelPath
+}
+
+type threeMFLoader struct {
+    files map[string]*zip.File
+    models map[string]*threeMFModel
+    mesh *TriangleMesh
+    model *Model
+    // Material names by model path, group ID and index
+    materialRefs map[string]string
+}
+
+func (l *threeMFLoader) warn(format string, args ...interface{}) {
+    l.model.Warnings = append(l.model.Warnings, fmt.Sprintf(format, args...))
+}
+
+// loadModel parses a model part and registers its materials.
+func (l *threeMFLoader) loadModel(modelPath string) (*threeMFModel, error) {
+    if m, ok := l.models[modelPath]; ok { return m, nil }
+    f, ok := l.files[modelPath]
+    if !ok { return nil, fmt.Errorf("3MF model %s not found", modelPath) }
+    r, err := f.Open()
+    if err != nil { return nil, err }
+    defer r.Close()
+    m := new(threeMFModel)
+    if err = xml.NewDecoder(r).Decode(m); err != nil {
+        return nil, fmt.Errorf("Invalid 3MF model %s: %v", modelPath, err)
+    }
+    // Consumers must refuse models requiring unsupported extensions
+    for _, prefix := range strings.Fields(m.RequiredExtensions) {
+        namespace := prefix
+        for _, attr := range m.Attrs {
+            if attr.Name.Space == "xmlns" && attr.Name.Local == prefix {
+                namespace = attr.Value
+            }
+        }
+        if !threeMFExtensions[namespace] {
+            return nil, fmt.Errorf("3MF model %s requires unsupported "+
+                "extension %s", modelPath, namespace)
+        }
+    }
+    l.models[modelPath] = m
+    for _, group := range m.BaseMaterials {
+        for i, base := range group.Bases {
+            rgba, err := parse3MFColor(base.DisplayColor)
+            if err != nil { return nil, err }
+            baseName := base.Name
+            if baseName == "" {
+                baseName = fmt.Sprintf("material%d_%d", group.ID, i)
+            }
+            name := baseName
+            for n := 2; l.model.Materials[name] != nil; n++ {
+                name = fmt.Sprintf("%s.%d", baseName, n)
+            }
+            mat := colorMaterial(name, [3]float32{rgba[0], rgba[1], rgba[2]})
+            mat.Tr = rgba[3]
+            l.model.Materials[name] = mat
+            l.materialRefs[threeMFPropertyKey(modelPath, group.ID, i)] = name
+        }
+    }
+    for _, group := range m.ColorGroups {
+        for i, c := range group.Colors {
+            rgba, err := parse3MFColor(c.Color)
+            if err != nil { return nil, err }
+            rgb := [3]float32{rgba[0], rgba[1], rgba[2]}
+            name := colorMaterialName(rgb)
+            if _, ok := l.model.Materials[name]; !ok {
+                l.model.Materials[name] = colorMaterial(name, rgb)
+            }
+            l.materialRefs[threeMFPropertyKey(modelPath, group.ID, i)] = name
+        }
+    }
+    return m, nil
+}
+
+func threeMFPropertyKey(modelPath string, id, index int) string {
+    return fmt.Sprintf("%s#%d#%d", modelPath, id, index)
+}
+
+// addObject adds the object a build item or component refers to.
+func (l *threeMFLoader) addObject(modelPath string,
+    ref *threeMFComponent, transform mat4, depth int) error {
+    if depth > 32 { return fmt.Errorf("3MF components nested too deeply") }
+    if ref.Path != "" { modelPath = strings.TrimPrefix(ref.Path, "/") }
+    m, err := l.loadModel(modelPath)
+    if err != nil { return err }
+    var obj *threeMFObject
+    for _, o := range m.Objects {
+        if o.ID == ref.ObjectID { obj = o }
+    }
+    if obj == nil {
+        return fmt.Errorf("3MF object %d not found", ref.ObjectID)
+    }
+    for _, c := range obj.Components {
+        t, err := parse3MFTransform(c.Transform)
+        if err != nil { return err }
+        err = l.addObject(modelPath, c, transform.mul(t), depth + 1)
+        if err != nil { return err }
+    }
+    if len(obj.Triangles) == 0 { return nil }
+
+    mesh := l.mesh
+    first := uint32(len(mesh.Vertices) / 3)
+    for _, v := range obj.Vertices {
+        p := transform.transformPoint([3]float32{v.X, v.Y, v.Z})
+        mesh.Vertices = append(mesh.Vertices, p[:]...)
+    }
+    flip := transform.determinant3() < 0
+    name := obj.Name
+    if name == "" { name = fmt.Sprintf("object%d", obj.ID) }
+    var mo *MeshObject
+    for _, tri := range obj.Triangles {
+        count := len(obj.Vertices)
+        if tri.V1 < 0 || tri.V2 < 0 || tri.V3 < 0 || tri.V1 >= count ||
+            tri.V2 >= count || tri.V3 >= count {
+            return fmt.Errorf("3MF object %d: vertex index out of range",
+                obj.ID)
+        }
+        pid, pindex := obj.PID, obj.PIndex
+        if tri.PID != "" { pid = tri.PID }
+        if tri.P1 != "" { pindex = tri.P1 }
+        materialRef := ""
+        if pid != "" {
+            id, err1 := strconv.Atoi(pid)
+            idx, err2 := strconv.Atoi(pindex)
+            if pindex == "" { idx, err2 = 0, nil }
+            if err1 != nil || err2 != nil {
+                return fmt.Errorf("3MF object %d: invalid property", obj.ID)
+            }
+            materialRef = l.materialRefs[threeMFPropertyKey(modelPath, id,
+                idx)]
+        }
+        if mo == nil || mo.MaterialRef != materialRef {
+            mo = &MeshObject{name, int32(len(mesh.VertexIndex)), 0,
+                materialRef, false}
+            mesh.Objects = append(mesh.Objects, mo)
+        }
+        v2, v3 := tri.V2, tri.V3
+        if flip { v2, v3 = v3, v2 }
+        mesh.VertexIndex = append(mesh.VertexIndex, first + uint32(tri.V1),
+            first + uint32(v2), first + uint32(v3))
+        mo.VertexCount += 3
+    }
+    return nil
+}
+
+// parse3MFTransform parses a 3MF transform, a 4x3 matrix applied to row
+// vectors, into a mat4.
+func parse3MFTransform(s string) (mat4, error) {
+    fields := strings.Fields(s)
+    if len(fields) == 0 { return identityMat4, nil }
+    if len(fields) != 12 {
+        return mat4{}, fmt.Errorf("Invalid 3MF transform %q", s)
+    }
+    var values [12]float64
+    for i, field := range fields {
+        v, err := strconv.ParseFloat(field, 64)
+        if err != nil {
+            return mat4{}, fmt.Errorf("Invalid 3MF transform %q", s)
+        }
+        values[i] = v
+    }
+    // Each row of the 3MF matrix is a column of the mat4
+    return mat4{
+        values[0], values[1], values[2], 0,
+        values[3], values[4], values[5], 0,
+        values[6], values[7], values[8], 0,
+        values[9], values[10], values[11], 1,
+    }, nil
+}
+
+// parse3MFColor parses #RRGGBB or #RRGGBBAA into RGBA.
+func parse3MFColor(s string) ([4]float32, error) {
+    rgba := [4]float32{1, 1, 1, 1}
+    if s == "" { return rgba, nil }
+    hex := strings.TrimPrefix(s, "#")
+    v, err := strconv.ParseUint(hex, 16, 32)
+    if err != nil || len(hex) != 6 && len(hex) != 8 || len(s) == len(hex) {
+        return rgba, fmt.Errorf("Invalid 3MF color %q", s)
+    }
+    if len(hex) == 6 { v = v << 8 | 0xff }
+    for c := 0; c < 4; c++ {
+        rgba[c] = float32(v >> uint(24 - c*8) & 0xff) / 255
+    }
+    return rgba, nil
+}
+
+// Write3MF writes mesh as a 3MF package in millimetres, with one object
+// and build item per mesh object. Vertices of each object are welded by
+// position, degenerate triangles are dropped. The materials referenced by
+// mesh objects are written as base materials with their diffuse colour.
+func Write3MF(writer io.Writer, mesh *TriangleMesh,
+    materials map[string]*Material) error {
+    objects := mesh.objects()
+    // Base materials referenced by the mesh
+    used := make(map[string]*Material)
+    for _, mo := range objects {
+        if mat, ok := materials[mo.MaterialRef]; ok {
+            used[mo.MaterialRef] = mat
+        }
+    }
+    names := sortedMaterialNames(used)
+    baseIndex := make(map[string]int)
+    for i, name := range names { baseIndex[name] = i }
+
+    var model bytes.Buffer
+    w := bufio.NewWriter(&model)
+    fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+        "<model unit=\"millimeter\" xml:lang=\"en-US\" xmlns=\"%s\">\n" +
+        " <resources>\n", threeMFCoreNS)
+    if len(names) > 0 {
+        fmt.Fprintf(w, "  <basematerials id=\"1\">\n")
+        for _, name := range names {
+            mat := used[name]
+            rgba := [4]float32{1, 1, 1, mat.Tr}
+            copy(rgba[:3], mat.Kd)
+            if mat.Tr <= 0 { rgba[3] = 1 }
+            fmt.Fprintf(w, "   <base name=\"%s\" " +
+                "displaycolor=\"#%02X%02X%02X%02X\"/>\n", xmlEscape(name),
+                unitToByte(rgba[0]), unitToByte(rgba[1]),
+                unitToByte(rgba[2]), unitToByte(rgba[3]))
+        }
+        fmt.Fprintf(w, "  </basematerials>\n")
+    }
+    ids := make([]int, 0, len(objects))
+    for _, mo := range objects {
+        if mo.VertexOffset < 0 || mo.VertexCount < 3 { continue }
+        local := make(map[[3]float32]int)
+        positions := make([][3]float32, 0)
+        triangles := make([][3]int, 0, mo.VertexCount / 3)
+        start := int(mo.VertexOffset)
+        for i := start; i + 2 < start + int(mo.VertexCount); i += 3 {
+            var tri [3]int
+            for c := 0; c < 3; c++ {
+                p := mesh.position(mesh.vertexIndex(i+c))
+                idx, ok := local[p]
+                if !ok {
+                    idx = len(positions)
+                    local[p] = idx
+                    positions = append(positions, p)
+                }
+                tri[c] = idx
+            }
+            if tri[0] == tri[1] || tri[1] == tri[2] || tri[0] == tri[2] {
+                continue
+            }
+            triangles = append(triangles, tri)
+        }
+        if len(triangles) == 0 { continue }
+        id := len(ids) + 2
+        ids = append(ids, id)
+        fmt.Fprintf(w, "  <object id=\"%d\" type=\"model\" name=\"%s\"",
+            id, xmlEscape(mo.Name))
+        if idx, ok := baseIndex[mo.MaterialRef]; ok {
+            fmt.Fprintf(w, " pid=\"1\" pindex=\"%d\"", idx)
+        }
+        fmt.Fprintf(w, ">\n   <mesh>\n    <vertices>\n")
+        for _, p := range positions {
+            fmt.Fprintf(w, "     <vertex x=\"%s\" y=\"%s\" z=\"%s\"/>\n",
+                formatF32(p[0], -1), formatF32(p[1], -1),
+                formatF32(p[2], -1))
+        }
+        fmt.Fprintf(w, "    </vertices>\n    <triangles>\n")
+        for _, tri := range triangles {
+            fmt.Fprintf(w, "     <triangle v1=\"%d\" v2=\"%d\" v3=\"%d\"/>\n",
+                tri[0], tri[1], tri[2])
+        }
+        fmt.Fprintf(w, "    </triangles>\n   </mesh>\n  </object>\n")
+    }
+    fmt.Fprintf(w, " </resources>\n <build>\n")
+    for _, id := range ids {
+        fmt.Fprintf(w, "  <item objectid=\"%d\"/>\n", id)
+    }
+    fmt.Fprintf(w, " </build>\n</model>\n")
+    if err := w.Flush(); err != nil { return err }
+
+    archive := zip.NewWriter(writer)
+    parts := []struct{ name, content string }{
+        {"[Content_Types].xml", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+            "<Types xmlns=\"http://schemas.openxmlformats.org/package/" +
+            "2006/content-types\">\n <Default Extension=\"rels\" " +
+            "ContentType=\"application/vnd.openxmlformats-package." +
+            "relationships+xml\"/>\n <Default Extension=\"model\" " +
+            "ContentType=\"application/vnd.ms-package.3dmanufacturing-" +
+            "3dmodel+xml\"/>\n</Types>\n"},
+        {"_rels/.rels", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+            "<Relationships xmlns=\"http://schemas.openxmlformats.org/" +
+            "package/2006/relationships\">\n <Relationship Target=\"/" +
+            threeMFModelPath + "\" Id=\"rel0\" Type=\"" + threeMFRelType +
+            "\"/>\n</Relationships>\n"},
+        {threeMFModelPath, model.String()},
+    }
+    for _, part := range parts {
+        f, err := archive.Create(part.name)
+        if err != nil { return err }
+        if _, err = io.WriteString(f, part.content); err != nil {
+            return err
+        }
+    }
+    return archive.Close()
+}
+
+func xmlEscape(s string) string {
+    var buf bytes.Buffer
+    xml.EscapeText(&buf, []byte(s))
+    return buf.String()
+}
@@ -0,0 +1,118 @@
+package go3dm
+
+import (
+    "archive/zip"
+    "bytes"
+    "strings"
+    "testing"
+)
+
+const componentsModel = `<?xml version="1.0" encoding="UTF-8"?>
+<model unit="centimeter" xmlns="http://schemas.microsoft.com/3dmanufacturing/core/2015/02"
+    xmlns:m="http://schemas.microsoft.com/3dmanufacturing/material/2015/02">
+ <resources>
+  <basematerials id="1">
+   <base name="Red PLA" displaycolor="#FF000080"/>
+  </basematerials>
+  <m:colorgroup id="5">
+   <m:color color="#00FF00"/>
+  </m:colorgroup>
+  <object id="2" type="model" name="tri" pid="1" pindex="0">
+   <mesh>
+    <vertices>
+     <vertex x="0" y="0" z="0"/>
+     <vertex x="1" y="0" z="0"/>
+     <vertex x="0" y="1" z="0"/>
+     <vertex x="1" y="1" z="0"/>
+    </vertices>
+    <triangles>
+     <triangle v1="0" v2="1" v3="2"/>
+     <triangle v1="1" v2="3" v3="2" pid="5" p1="0"/>
+    </triangles>
+   </mesh>
+  </object>
+  <object id="3" type="model" name="group">
+   <components>
+    <component objectid="2" transform="-1 0 0 0 1 0 0 0 1 0 0 0"/>
+   </components>
+  </object>
+ </resources>
+ <build>
+  <item objectid="3" transform="1 0 0 0 1 0 0 0 1 10 0 0"/>
+ </build>
+</model>
+`
+
+// load3MFModel loads a 3MF package holding the given root model.
+func load3MFModel(modelXML string) (*Model, error) {
+    var buf bytes.Buffer
+    archive := zip.NewWriter(&buf)
+    f, _ := archive.Create("3D/3dmodel.model")
+    f.Write([]byte(modelXML))
+    archive.Close()
+    return Load3MFFrom(bytes.NewReader(buf.Bytes()), int64(buf.Len()),
+        &LoadOptions{Index: true})
+}
+
+func TestLoad3MF(t *testing.T) {
+    t.Log("Testing: 3MF Components, Units and Materials")
+    model, err := load3MFModel(strings.Replace(componentsModel,
+        "<model ", "<model requiredextensions=\"m\" ", 1))
+    if err != nil { t.Error(err); return }
+    // The mirroring component flips the winding, the item moves by 10cm
+    checkMesh(t, model.Mesh,
+        []float32{100, 0, 0,  90, 0, 0,  100, 10, 0,  90, 10, 0},
+        nil, nil,
+        []uint32{0, 2, 1,  1, 2, 3},
+        []*MeshObject{
+            &MeshObject{"tri", 0, 3, "Red PLA", false},
+            &MeshObject{"tri", 3, 3, "color_00ff00", false},
+        })
+    red := model.Materials["Red PLA"]
+    if red == nil || red.Kd[0] != 1 || red.Tr != float32(0x80) / 255 {
+        t.Errorf("Unexpected material %v", red)
+    }
+    if _, ok := model.Materials["color_00ff00"]; !ok {
+        t.Error("Missing colour group material")
+    }
+
+    beamLattice := strings.Replace(componentsModel, "<model ",
+        "<model requiredextensions=\"b\" xmlns:b=\"http://schemas." +
+        "microsoft.com/3dmanufacturing/beamlattice/2017/02\" ", 1)
+    if _, err = load3MFModel(beamLattice); err == nil {
+        t.Error("Unsupported required extension not rejected")
+    }
+}
+
+func Test3MFRoundTrip(t *testing.T) {
+    t.Log("Testing: 3MF Round Trip")
+    mesh, materials, err := LoadOBJ("test-meshes/cubes.obj", false)
+    if err != nil { t.Error(err); return }
+    var buf bytes.Buffer
+    if err = Write3MF(&buf, mesh, materials); err != nil {
+        t.Error(err)
+        return
+    }
+    model, err := Load3MFFrom(bytes.NewReader(buf.Bytes()),
+        int64(buf.Len()), nil)
+    if err != nil { t.Error(err); return }
+    if len(model.Warnings) > 0 { t.Error(model.Warnings) }
+    loaded := model.Mesh
+    if len(loaded.Objects) != len(mesh.Objects) {
+        t.Errorf("Expected %d objects, got %d", len(mesh.Objects),
+            len(loaded.Objects))
+        return
+    }
+    for i, mo := range loaded.Objects {
+        if mo.Name != mesh.Objects[i].Name ||
+            mo.MaterialRef != mesh.Objects[i].MaterialRef {
+            t.Errorf("Unexpected object %v", mo)
+        }
+    }
+    checkMesh(t, loaded, mesh.Vertices, nil, nil, nil, nil)
+    mat := model.Materials["redCube"]
+    if mat == nil ||
+        unitToByte(mat.Kd[0]) != unitToByte(materials["redCube"].Kd[0]) {
+        t.Errorf("Unexpected material %v", mat)
+    }
+}
@@ -1,25 +1,94 @@
 package go3dm
 
+import (
+    "image"
+    "math"
+    "sort"
+)
+
 // Public Structs
 
 type TriangleMesh struct {
-    Vertices []float32
-    Normals []float32
-    TextureCoords []float32
-    VertexIndex []uint32
-    Objects []*MeshObject
+    Vertices []float32 `json:"vertices"`
+    Normals []float32 `json:"normals,omitempty"`
+    TextureCoords []float32 `json:"textureCoords,omitempty"`
+    VertexIndex []uint32 `json:"vertexIndex,omitempty"`
+    Objects []*MeshObject `json:"objects"`
+    // RGBA vertex colours, 4 values per vertex
+    Colors []float32 `json:"colors,omitempty"`
+    // Additional named per-vertex values
+    Attributes []*VertexAttribute `json:"attributes,omitempty"`
+    // Additional named per-triangle values, in the order of the triangles
+    // in VertexIndex (or Vertices if not indexed)
+    FaceAttributes []*VertexAttribute `json:"faceAttributes,omitempty"`
+    // Keyframes of vertex animated meshes
+    MorphFrames []*MorphFrame `json:"morphFrames,omitempty"`
+    // Set for point clouds, whose vertices aren't connected by triangles.
+    // Writers of mesh formats write point clouds without faces.
+    Points bool `json:"points,omitempty"`
 }
 
 func (m *TriangleMesh) VTN() ([]float32, []float32, []float32) {
     return m.Vertices, m.TextureCoords, m.Normals
 }
 
+// VertexAttribute holds Size values per vertex, or per triangle if it is
+// one of a mesh's FaceAttributes.
+type VertexAttribute struct {
+    Name string `json:"name"`
+    Size int `json:"size"`
+    Values []float32 `json:"values"`
+}
+
+func (m *TriangleMesh) Attribute(name string) *VertexAttribute {
+    for _, attr := range m.Attributes {
+        if attr.Name == name { return attr }
+    }
+    return nil
+}
+
+func (m *TriangleMesh) FaceAttribute(name string) *VertexAttribute {
+    for _, attr := range m.FaceAttributes {
+        if attr.Name == name { return attr }
+    }
+    return nil
+}
+
+// MorphFrame holds the vertex positions and normals of a keyframe of a
+// vertex animated mesh, laid out like the mesh's Vertices and Normals.
+type MorphFrame struct {
+    Name string `json:"name"`
+    Vertices []float32 `json:"vertices"`
+    Normals []float32 `json:"normals,omitempty"`
+}
+
+// Names of the vertex attributes of skinned meshes, holding up to four
+// joint indices and the corresponding weights per vertex.
+const (
+    JointsAttribute = "joints"
+    WeightsAttribute = "weights"
+)
+
+// Name of the vertex attribute holding the per-point intensity of laser
+// scans.
+const IntensityAttribute = "intensity"
+
+// Joint is a joint of a skeleton in its bind pose. Position and
+// Orientation, a unit quaternion (x, y, z, w), are in model space. Parent
+// is the index of the parent joint, -1 for root joints.
+type Joint struct {
+    Name string `json:"name"`
+    Parent int `json:"parent"`
+    Position [3]float32 `json:"position"`
+    Orientation [4]float32 `json:"orientation"`
+}
+
 type MeshObject struct {
-    Name string
-    VertexOffset int32
-    VertexCount int32
-    MaterialRef string
-    Smooth bool
+    Name string `json:"name"`
+    VertexOffset int32 `json:"vertexOffset"`
+    VertexCount int32 `json:"vertexCount"`
+    MaterialRef string `json:"materialRef"`
+    Smooth bool `json:"smooth"`
 }
 
 func (mo1 *MeshObject) Equals(mo2 *MeshObject) bool {
@@ -32,16 +101,17 @@ func (mo1 *MeshObject) Equals(mo2 *MeshObject) bool {
 }
 
 type Material struct {
-    Name string
-    Ka []float32
-    Kd []float32
-    Ks []float32
-    Ns float32
-    Tr float32
-    KaMap string
-    KdMap string
-    KsMap string
-    Folder string
+    Name string `json:"name"`
+    Ka []float32 `json:"ka"`
+    Kd []float32 `json:"kd"`
+    Ks []float32 `json:"ks"`
+    Ns float32 `json:"ns"`
+    Tr float32 `json:"tr"`
+    KaMap string `json:"kaMap,omitempty"`
+    KdMap string `json:"kdMap,omitempty"`
+    KsMap string `json:"ksMap,omitempty"`
+    // Local directory texture maps are relative to, not encoded to JSON
+    Folder string `json:"-"`
 }
 
 func (mat1 *Material) Equals(mat2 *Material) bool {
@@ -59,6 +129,55 @@ func (mat1 *Material) Equals(mat2 *Material) bool {
     return true
 }
 
+// materialRoughness maps the specular exponent of a Phong material to
+// the roughness of physically based materials.
+func materialRoughness(mat *Material) float32 {
+    return float32(math.Sqrt(2 / (math.Max(float64(mat.Ns), 0) + 2)))
+}
+
+// materialOpacity returns the opacity of a material and whether it is
+// translucent. Tr holds the dissolve value, 0 usually means it wasn't
+// specified.
+func materialOpacity(mat *Material) (float32, bool) {
+    if mat.Tr > 0 && mat.Tr < 1 { return mat.Tr, true }
+    return 1, false
+}
+
+func sortedMaterialNames(materials map[string]*Material) []string {
+    names := make([]string, 0, len(materials))
+    for name := range materials {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// LoadOptions controls optional processing performed by the loaders.
+type LoadOptions struct {
+    // Generate an indexed mesh
+    Index bool
+    // Rewrite texture maps to absolute paths
+    ResolveTextures bool
+    // Resolve texture maps and report the ones that can't be found
+    CheckTextures bool
+    // Decode referenced textures into Model.Textures
+    LoadTextures bool
+    // Cache used for decoding textures, may be shared between loads
+    TextureCache *TextureCache
+}
+
+// Model bundles a mesh with its materials and any non-fatal problems
+// encountered while loading it.
+type Model struct {
+    Mesh *TriangleMesh
+    Materials map[string]*Material
+    // Decoded textures keyed by texture path
+    Textures map[string]image.Image
+    // Skeleton of skinned meshes, see JointsAttribute
+    Joints []*Joint
+    Warnings []string
+}
+
 // Internal Structs
 
 type f32VA struct {
@@ -0,0 +1,224 @@
+package go3dm
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+func init() {
+    RegisterFormat(&Format{Name: "usda", Extensions: []string{".usda"},
+        Save: func(path string, mesh *TriangleMesh,
+            materials map[string]*Material, opts *SaveOptions) error {
+            usdOpts := &USDWriteOptions{TextureDir: filepath.Dir(path)}
+            return writeFile(path, func(w io.Writer) error {
+                return WriteUSDA(w, mesh, materials, usdOpts)
+            })
+        },
+    })
+}
+
+// USDWriteOptions controls the output of WriteUSDA.
+type USDWriteOptions struct {
+    // Directory texture asset paths are made relative to, usually the
+    // directory the file is written to
+    TextureDir string
+}
+
+// WriteUSDA writes mesh as a USD ASCII layer. Each mesh object becomes a
+// Mesh prim under the default prim "root", with its own points and
+// per-vertex normals, st and displayColor primvars. The materials
+// referenced by mesh objects are written as UsdPreviewSurface materials
+// under /root/Materials and bound to the meshes. A nil opts is
+// equivalent to the zero USDWriteOptions.
+func WriteUSDA(writer io.Writer, mesh *TriangleMesh,
+    materials map[string]*Material, opts *USDWriteOptions) error {
+    if opts == nil { opts = &USDWriteOptions{} }
+    objects := mesh.objects()
+    // Materials referenced by the mesh
+    used := make(map[string]*Material)
+    for _, mo := range objects {
+        if mat, ok := materials[mo.MaterialRef]; ok {
+            used[mo.MaterialRef] = mat
+        }
+    }
+    matNames := sortedMaterialNames(used)
+    matPaths := make(map[string]string)
+    primNames := make(map[string]bool)
+    scopeName := usdUniqueName("Materials", primNames)
+    matPrimNames := make(map[string]bool)
+    for _, name := range matNames {
+        matPaths[name] = "/root/" + scopeName + "/" +
+            usdUniqueName(name, matPrimNames)
+    }
+
+    vertexCount := len(mesh.Vertices) / 3
+    hasNormals := len(mesh.Normals) >= vertexCount*3
+    hasColors := len(mesh.Colors) >= vertexCount*4
+    hasTexCoords := len(mesh.TextureCoords) >= vertexCount*2
+    w := bufio.NewWriter(writer)
+    fmt.Fprintf(w, "#usda 1.0\n(\n    defaultPrim = \"root\"\n" +
+        "    doc = \"written by go3dm\"\n    metersPerUnit = 1\n" +
+        "    upAxis = \"Y\"\n)\n\ndef Xform \"root\"\n{\n")
+    first := true
+    for _, mo := range objects {
+        if mo.VertexOffset < 0 || mo.VertexCount < 3 { continue }
+        // Vertices of the object, renumbered from 0
+        local := make(map[uint32]int)
+        vertices := make([]uint32, 0)
+        indices := make([]string, 0, mo.VertexCount)
+        start := int(mo.VertexOffset)
+        end := start + int(mo.VertexCount) / 3 * 3
+        for i := start; i < end; i++ {
+            v := mesh.vertexIndex(i)
+            idx, ok := local[v]
+            if !ok {
+                idx = len(vertices)
+                local[v] = idx
+                vertices = append(vertices, v)
+            }
+            indices = append(indices, strconv.Itoa(idx))
+        }
+        counts := make([]string, len(indices) / 3)
+        for i := range counts { counts[i] = "3" }
+
+        if !first { w.WriteString("\n") }
+        first = false
+        matPath, bound := matPaths[mo.MaterialRef]
+        fmt.Fprintf(w, "    def Mesh \"%s\"", usdUniqueName(mo.Name,
+            primNames))
+        if bound {
+            fmt.Fprintf(w, " (\n        prepend apiSchemas = " +
+                "[\"MaterialBindingAPI\"]\n    )")
+        }
+        fmt.Fprintf(w, "\n    {\n")
+        fmt.Fprintf(w, "        int[] faceVertexCounts = [%s]\n",
+            strings.Join(counts, ", "))
+        fmt.Fprintf(w, "        int[] faceVertexIndices = [%s]\n",
+            strings.Join(indices, ", "))
+        fmt.Fprintf(w, "        point3f[] points = [%s]\n",
+            usdTuples(mesh.Vertices, vertices, 3, 3))
+        if hasNormals {
+            fmt.Fprintf(w, "        normal3f[] normals = [%s] (\n" +
+                "            interpolation = \"vertex\"\n        )\n",
+                usdTuples(mesh.Normals, vertices, 3, 3))
+        }
+        if hasColors {
+            fmt.Fprintf(w, "        color3f[] primvars:displayColor = " +
+                "[%s] (\n            interpolation = \"vertex\"\n" +
+                "        )\n", usdTuples(mesh.Colors, vertices, 4, 3))
+        }
+        if hasTexCoords {
+            fmt.Fprintf(w, "        texCoord2f[] primvars:st = [%s] (\n" +
+                "            interpolation = \"vertex\"\n        )\n",
+                usdTuples(mesh.TextureCoords, vertices, 2, 2))
+        }
+        fmt.Fprintf(w, "        uniform token subdivisionScheme = " +
+            "\"none\"\n")
+        if bound {
+            fmt.Fprintf(w, "        rel material:binding = <%s>\n", matPath)
+        }
+        fmt.Fprintf(w, "    }\n")
+    }
+    if len(matNames) > 0 {
+        fmt.Fprintf(w, "\n    def Scope \"%s\"\n    {\n", scopeName)
+        for i, name := range matNames {
+            if i > 0 { w.WriteString("\n") }
+            writeUSDMaterial(w, used[name], matPaths[name], opts)
+        }
+        fmt.Fprintf(w, "    }\n")
+    }
+    fmt.Fprintf(w, "}\n")
+    return w.Flush()
+}
+
+// writeUSDMaterial converts a Phong material to a UsdPreviewSurface in
+// the specular workflow. The specular exponent is mapped to roughness as
+// for glTF, the diffuse texture is read with the st primvar.
+func writeUSDMaterial(w *bufio.Writer, mat *Material, path string,
+    opts *USDWriteOptions) {
+    const indent = "            "
+    fmt.Fprintf(w, "        def Material \"%s\"\n        {\n",
+        path[strings.LastIndexByte(path, '/')+1:])
+    fmt.Fprintf(w, "            token outputs:surface.connect = " +
+        "<%s/PreviewSurface.outputs:surface>\n\n", path)
+    fmt.Fprintf(w, indent + "def Shader \"PreviewSurface\"\n" + indent +
+        "{\n" + indent + "    uniform token info:id = " +
+        "\"UsdPreviewSurface\"\n")
+    texture := mat.KdMap != "" && !isEmbeddedTexture(mat.KdMap)
+    if texture {
+        fmt.Fprintf(w, indent + "    color3f inputs:diffuseColor.connect " +
+            "= <%s/DiffuseTexture.outputs:rgb>\n", path)
+    } else if len(mat.Kd) >= 3 {
+        fmt.Fprintf(w, indent + "    color3f inputs:diffuseColor = %s\n",
+            usdTuple(mat.Kd[:3]))
+    }
+    if len(mat.Ks) >= 3 {
+        fmt.Fprintf(w, indent + "    color3f inputs:specularColor = %s\n",
+            usdTuple(mat.Ks[:3]))
+    }
+    fmt.Fprintf(w, indent + "    float inputs:roughness = %s\n",
+        formatF32(materialRoughness(mat), -1))
+    if opacity, translucent := materialOpacity(mat); translucent {
+        fmt.Fprintf(w, indent + "    float inputs:opacity = %s\n",
+            formatF32(opacity, -1))
+    }
+    fmt.Fprintf(w, indent + "    int inputs:useSpecularWorkflow = 1\n" +
+        indent + "    token outputs:surface\n" + indent + "}\n")
+    if texture {
+        file := filepath.ToSlash(relativeTexturePath(mat, mat.KdMap,
+            opts.TextureDir))
+        fmt.Fprintf(w, "\n" + indent + "def Shader \"DiffuseTexture\"\n" +
+            indent + "{\n" + indent + "    uniform token info:id = " +
+            "\"UsdUVTexture\"\n" + indent + "    asset inputs:file = @%s@\n" +
+            indent + "    float2 inputs:st.connect = " +
+            "<%s/STReader.outputs:result>\n" + indent +
+            "    float3 outputs:rgb\n" + indent + "}\n", file, path)
+        fmt.Fprintf(w, "\n" + indent + "def Shader \"STReader\"\n" +
+            indent + "{\n" + indent + "    uniform token info:id = " +
+            "\"UsdPrimvarReader_float2\"\n" + indent +
+            "    token inputs:varname = \"st\"\n" + indent +
+            "    float2 outputs:result\n" + indent + "}\n")
+    }
+    fmt.Fprintf(w, "        }\n")
+}
+
+func usdTuple(values []float32) string {
+    s := make([]string, len(values))
+    for i, v := range values { s[i] = formatF32(v, -1) }
+    return "(" + strings.Join(s, ", ") + ")"
+}
+
+// usdTuples formats the first n of every stride values of the given
+// vertices.
+func usdTuples(values []float32, vertices []uint32, stride, n int) string {
+    s := make([]string, len(vertices))
+    for i, v := range vertices {
+        offset := int(v) * stride
+        s[i] = usdTuple(values[offset:offset+n])
+    }
+    return strings.Join(s, ", ")
+}
+
+// usdUniqueName turns name into a valid prim name that isn't in names
+// yet and adds it.
+func usdUniqueName(name string, names map[string]bool) string {
+    b := []byte(name)
+    for i, c := range b {
+        if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+            c >= '0' && c <= '9' || c == '_') {
+            b[i] = '_'
+        }
+    }
+    name = string(b)
+    if name == "" || name[0] >= '0' && name[0] <= '9' { name = "_" + name }
+    unique := name
+    for i := 2; names[unique]; i++ {
+        unique = name + "_" + strconv.Itoa(i)
+    }
+    names[unique] = true
+    return unique
+}
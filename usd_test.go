@@ -0,0 +1,113 @@
+package go3dm
+
+import (
+    "bytes"
+    "regexp"
+    "strings"
+    "testing"
+)
+
+func TestWriteUSDA(t *testing.T) {
+    t.Log("Testing: USDA Export")
+    mesh, materials, err := LoadOBJ("test-meshes/cubes.obj", false)
+    if err != nil { t.Error(err); return }
+    materials["redCube"].KdMap = "textures/red.png"
+    var buf bytes.Buffer
+    if err = WriteUSDA(&buf, mesh, materials, nil); err != nil {
+        t.Error(err)
+        return
+    }
+    out := buf.String()
+    if !strings.HasPrefix(out, "#usda 1.0\n") {
+        t.Error("Missing usda header")
+        return
+    }
+    if strings.Count(out, "{") != strings.Count(out, "}") ||
+        strings.Count(out, "(") != strings.Count(out, ")") ||
+        strings.Count(out, "[") != strings.Count(out, "]") {
+        t.Error("Unbalanced brackets")
+    }
+    for _, s := range []string{
+        "defaultPrim = \"root\"",
+        "def Xform \"root\"\n{\n",
+        "    def Mesh \"redCube\" (\n" +
+            "        prepend apiSchemas = [\"MaterialBindingAPI\"]\n    )\n",
+        "    def Mesh \"blueCube\" (",
+        "rel material:binding = </root/Materials/redCube>\n",
+        "rel material:binding = </root/Materials/blueCube>\n",
+        "    def Scope \"Materials\"\n",
+        "        def Material \"redCube\"\n",
+        "token outputs:surface.connect = " +
+            "</root/Materials/redCube/PreviewSurface.outputs:surface>\n",
+        "uniform token info:id = \"UsdPreviewSurface\"\n",
+        "color3f inputs:diffuseColor = (0, 0, 0.64)\n",
+        "color3f inputs:diffuseColor.connect = " +
+            "</root/Materials/redCube/DiffuseTexture.outputs:rgb>\n",
+        "asset inputs:file = @textures/red.png@\n",
+        "token inputs:varname = \"st\"\n",
+    } {
+        if !strings.Contains(out, s) {
+            t.Errorf("Missing %q in:\n%s", s, out)
+            return
+        }
+    }
+
+    // Each mesh prim has one count per triangle and one point and normal
+    // per distinct vertex
+    arrays := regexp.MustCompile(`(?m)^ *(\S+) (\S+) = \[(.*)\]( \(\n *` +
+        `interpolation = "(\w+)")?`)
+    matches := arrays.FindAllStringSubmatch(out, -1)
+    lengths := make(map[string][]int)
+    for _, m := range matches {
+        n := strings.Count(m[3], ",") + 1
+        if strings.Contains(m[3], "(") { n = strings.Count(m[3], "(") }
+        lengths[m[2]] = append(lengths[m[2]], n)
+        if m[2] == "normals" && m[5] != "vertex" {
+            t.Errorf("Unexpected normal interpolation %q", m[5])
+        }
+    }
+    for i, mo := range mesh.Objects {
+        counts := lengths["faceVertexCounts"]
+        indices := lengths["faceVertexIndices"]
+        if len(counts) != 2 || counts[i] != int(mo.VertexCount) / 3 ||
+            indices[i] != int(mo.VertexCount) {
+            t.Errorf("Unexpected face arrays for %s: %v", mo.Name, lengths)
+            return
+        }
+        points, normals := lengths["points"], lengths["normals"]
+        if points[i] != int(mo.VertexCount) || normals[i] != points[i] {
+            t.Errorf("Unexpected vertex arrays for %s: %v", mo.Name,
+                lengths)
+        }
+    }
+    if lengths["primvars:st"] != nil {
+        t.Error("st primvar written for mesh without texture coordinates")
+    }
+}
+
+func TestWriteUSDAPrimNames(t *testing.T) {
+    t.Log("Testing: USDA Prim Names")
+    mesh, err := LoadOBJFrom(strings.NewReader(texplaneOBJ), true)
+    if err != nil { t.Error(err); return }
+    mesh.Objects[0].Name = "Materials"
+    mesh.Objects = append(mesh.Objects,
+        &MeshObject{"1st plane", 0, 6, "", false})
+    var buf bytes.Buffer
+    err = WriteUSDA(&buf, &mesh.TriangleMesh, map[string]*Material{
+        "Material": &Material{Name: "Material"}}, nil)
+    if err != nil { t.Error(err); return }
+    out := buf.String()
+    for _, s := range []string{
+        "def Mesh \"Materials_2\"",
+        "def Mesh \"_1st_plane\"\n",
+        "def Scope \"Materials\"",
+        "texCoord2f[] primvars:st = [(1, 0), (1, 1), (0, 1), (0, 0)] (\n" +
+            "            interpolation = \"vertex\"\n",
+        "faceVertexIndices = [0, 1, 2, 3, 0, 2]\n",
+    } {
+        if !strings.Contains(out, s) {
+            t.Errorf("Missing %q in:\n%s", s, out)
+            return
+        }
+    }
+}
@@ -0,0 +1,339 @@
+package go3dm
+
+import (
+    "bufio"
+    "encoding/base64"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "math"
+    "strconv"
+    "strings"
+)
+
+func init() {
+    RegisterFormat(&Format{Name: "vtk", Extensions: []string{".vtk"},
+        Save: func(path string, mesh *TriangleMesh,
+            materials map[string]*Material, opts *SaveOptions) error {
+            return writeFile(path, func(w io.Writer) error {
+                return WriteVTK(w, mesh, &VTKWriteOptions{opts.Binary})
+            })
+        },
+    })
+    RegisterFormat(&Format{Name: "vtu", Extensions: []string{".vtu"},
+        Save: func(path string, mesh *TriangleMesh,
+            materials map[string]*Material, opts *SaveOptions) error {
+            return writeFile(path, func(w io.Writer) error {
+                return WriteVTU(w, mesh, &VTKWriteOptions{opts.Binary})
+            })
+        },
+    })
+}
+
+// VTKWriteOptions controls the output of WriteVTK and WriteVTU.
+type VTKWriteOptions struct {
+    // Write binary data (big-endian for legacy files, base64 encoded
+    // little-endian for VTU) instead of ASCII
+    Binary bool
+}
+
+// vtkArray is a point or cell data array.
+type vtkArray struct {
+    name string
+    size int
+    values []float32
+    // Legacy attribute type: NORMALS, TEXTURE_COORDINATES, VECTORS,
+    // SCALARS or FIELD
+    kind string
+    integer bool
+}
+
+// vtkArrays collects the point and cell data of mesh: normals, texture
+// coordinates, colours and vertex attributes per point, the index of the
+// mesh object and face attributes per cell.
+func vtkArrays(mesh *TriangleMesh) ([]*vtkArray, []*vtkArray, error) {
+    vertexCount := len(mesh.Vertices) / 3
+    faceCount := mesh.cornerCount() / 3
+    points := make([]*vtkArray, 0)
+    if len(mesh.Normals) >= vertexCount*3 {
+        points = append(points, &vtkArray{"Normals", 3,
+            mesh.Normals[:vertexCount*3], "NORMALS", false})
+    }
+    if len(mesh.TextureCoords) >= vertexCount*2 {
+        points = append(points, &vtkArray{"TCoords", 2,
+            mesh.TextureCoords[:vertexCount*2],
+            "TEXTURE_COORDINATES", false})
+    }
+    if len(mesh.Colors) >= vertexCount*4 {
+        points = append(points, &vtkArray{"Colors", 4,
+            mesh.Colors[:vertexCount*4], "SCALARS", false})
+    }
+    add := func(list []*vtkArray, attr *VertexAttribute,
+        count int) ([]*vtkArray, error) {
+        if attr.Size < 1 || len(attr.Values) < attr.Size*count {
+            return nil, fmt.Errorf("Attribute %s has %d values, expected %d",
+                attr.Name, len(attr.Values), attr.Size*count)
+        }
+        kind := "FIELD"
+        if attr.Size == 3 {
+            kind = "VECTORS"
+        } else if attr.Size <= 4 {
+            kind = "SCALARS"
+        }
+        return append(list, &vtkArray{vtkName(attr.Name), attr.Size,
+            attr.Values[:attr.Size*count], kind, false}), nil
+    }
+    var err error
+    for _, attr := range mesh.Attributes {
+        if points, err = add(points, attr, vertexCount); err != nil {
+            return nil, nil, err
+        }
+    }
+
+    objectIds := make([]float32, faceCount)
+    for i := range objectIds { objectIds[i] = -1 }
+    for id, mo := range mesh.Objects {
+        if mo.VertexOffset < 0 { continue }
+        first := int(mo.VertexOffset) / 3
+        for f := first; f < first + int(mo.VertexCount) / 3 &&
+            f < faceCount; f++ {
+            objectIds[f] = float32(id)
+        }
+    }
+    cells := []*vtkArray{&vtkArray{"ObjectId", 1, objectIds, "SCALARS",
+        true}}
+    for _, attr := range mesh.FaceAttributes {
+        if cells, err = add(cells, attr, faceCount); err != nil {
+            return nil, nil, err
+        }
+    }
+    return points, cells, nil
+}
+
+// vtkName replaces the whitespace legacy VTK files can't have in names.
+func vtkName(name string) string {
+    name = strings.Join(strings.Fields(name), "_")
+    if name == "" { return "_" }
+    return name
+}
+
+// WriteVTK writes mesh as legacy VTK POLYDATA with triangle polygons.
+// Normals, texture coordinates, colours and vertex attributes are written
+// as point data; the index of the mesh object each triangle belongs to
+// (-1 if none) and face attributes as cell data. Attributes of size 3
+// become VECTORS, of size 1, 2 or 4 SCALARS and others FIELD arrays. A
+// nil opts is equivalent to the zero VTKWriteOptions.
+func WriteVTK(writer io.Writer, mesh *TriangleMesh,
+    opts *VTKWriteOptions) error {
+    if opts == nil { opts = &VTKWriteOptions{} }
+    points, cells, err := vtkArrays(mesh)
+    if err != nil { return err }
+    vertexCount := len(mesh.Vertices) / 3
+    faceCount := mesh.cornerCount() / 3
+    w := bufio.NewWriter(writer)
+    e := &vtkEncoder{w: w, binary: opts.Binary}
+    mode := "ASCII"
+    if opts.Binary { mode = "BINARY" }
+    fmt.Fprintf(w, "# vtk DataFile Version 3.0\ngo3dm\n%s\n" +
+        "DATASET POLYDATA\nPOINTS %d float\n", mode, vertexCount)
+    e.floats(mesh.Vertices[:vertexCount*3], 3, false)
+    fmt.Fprintf(w, "POLYGONS %d %d\n", faceCount, faceCount*4)
+    for f := 0; f < faceCount; f++ {
+        e.ints(3, int32(mesh.vertexIndex(f*3)),
+            int32(mesh.vertexIndex(f*3+1)), int32(mesh.vertexIndex(f*3+2)))
+    }
+    e.end()
+    if len(points) > 0 {
+        fmt.Fprintf(w, "POINT_DATA %d\n", vertexCount)
+        writeVTKData(e, points, vertexCount)
+    }
+    if faceCount > 0 {
+        fmt.Fprintf(w, "CELL_DATA %d\n", faceCount)
+        writeVTKData(e, cells, faceCount)
+    }
+    return w.Flush()
+}
+
+func writeVTKData(e *vtkEncoder, arrays []*vtkArray, count int) {
+    fields := make([]*vtkArray, 0)
+    for _, a := range arrays {
+        dataType := "float"
+        if a.integer { dataType = "int" }
+        switch a.kind {
+        case "NORMALS", "VECTORS":
+            fmt.Fprintf(e.w, "%s %s %s\n", a.kind, a.name, dataType)
+        case "TEXTURE_COORDINATES":
+            fmt.Fprintf(e.w, "%s %s %d %s\n", a.kind, a.name, a.size,
+                dataType)
+        case "SCALARS":
+            fmt.Fprintf(e.w, "SCALARS %s %s %d\nLOOKUP_TABLE default\n",
+                a.name, dataType, a.size)
+        default:
+            fields = append(fields, a)
+            continue
+        }
+        e.floats(a.values, a.size, a.integer)
+    }
+    if len(fields) == 0 { return }
+    fmt.Fprintf(e.w, "FIELD FieldData %d\n", len(fields))
+    for _, a := range fields {
+        fmt.Fprintf(e.w, "%s %d %d float\n", a.name, a.size, count)
+        e.floats(a.values, a.size, false)
+    }
+}
+
+// vtkEncoder writes legacy VTK data, either as ASCII lines or big-endian
+// binary values followed by a newline.
+type vtkEncoder struct {
+    w *bufio.Writer
+    binary bool
+    buf [4]byte
+}
+
+func (e *vtkEncoder) floats(values []float32, perLine int, integer bool) {
+    for i, v := range values {
+        if e.binary {
+            if integer {
+                binary.BigEndian.PutUint32(e.buf[:], uint32(int32(v)))
+            } else {
+                binary.BigEndian.PutUint32(e.buf[:], math.Float32bits(v))
+            }
+            e.w.Write(e.buf[:])
+            continue
+        }
+        if i % perLine > 0 { e.w.WriteByte(' ') }
+        if integer {
+            e.w.WriteString(strconv.Itoa(int(v)))
+        } else {
+            e.w.WriteString(formatF32(v, -1))
+        }
+        if i % perLine == perLine - 1 { e.w.WriteByte('\n') }
+    }
+    e.end()
+}
+
+// ints writes a line of integers.
+func (e *vtkEncoder) ints(values ...int32) {
+    for i, v := range values {
+        if e.binary {
+            binary.BigEndian.PutUint32(e.buf[:], uint32(v))
+            e.w.Write(e.buf[:])
+            continue
+        }
+        if i > 0 { e.w.WriteByte(' ') }
+        e.w.WriteString(strconv.Itoa(int(v)))
+    }
+    if !e.binary { e.w.WriteByte('\n') }
+}
+
+// end terminates a binary data section.
+func (e *vtkEncoder) end() {
+    if e.binary { e.w.WriteByte('\n') }
+}
+
+// WriteVTU writes mesh as a VTK XML UnstructuredGrid of triangle cells,
+// with the same point and cell data as WriteVTK. Binary data arrays are
+// base64 encoded with a UInt32 byte count header. A nil opts is
+// equivalent to the zero VTKWriteOptions.
+func WriteVTU(writer io.Writer, mesh *TriangleMesh,
+    opts *VTKWriteOptions) error {
+    if opts == nil { opts = &VTKWriteOptions{} }
+    points, cells, err := vtkArrays(mesh)
+    if err != nil { return err }
+    vertexCount := len(mesh.Vertices) / 3
+    faceCount := mesh.cornerCount() / 3
+    w := bufio.NewWriter(writer)
+    fmt.Fprintf(w, "<?xml version=\"1.0\"?>\n<VTKFile " +
+        "type=\"UnstructuredGrid\" version=\"0.1\" " +
+        "byte_order=\"LittleEndian\" header_type=\"UInt32\">\n" +
+        "  <UnstructuredGrid>\n" +
+        "    <Piece NumberOfPoints=\"%d\" NumberOfCells=\"%d\">\n",
+        vertexCount, faceCount)
+    writeData := func(tag string, arrays []*vtkArray) {
+        fmt.Fprintf(w, "      <%s", tag)
+        // Active attributes
+        for _, a := range arrays {
+            switch {
+            case a.kind == "NORMALS":
+                fmt.Fprintf(w, " Normals=\"%s\"", xmlEscape(a.name))
+            case a.kind == "TEXTURE_COORDINATES":
+                fmt.Fprintf(w, " TCoords=\"%s\"", xmlEscape(a.name))
+            }
+        }
+        fmt.Fprintf(w, ">\n")
+        for _, a := range arrays {
+            dataType := "Float32"
+            if a.integer { dataType = "Int32" }
+            writeVTUArray(w, dataType, a.name, a.size, len(a.values),
+                floatValues(a.values), opts.Binary)
+        }
+        fmt.Fprintf(w, "      </%s>\n", tag)
+    }
+    writeData("PointData", points)
+    writeData("CellData", cells)
+    fmt.Fprintf(w, "      <Points>\n")
+    writeVTUArray(w, "Float32", "Points", 3, vertexCount*3,
+        floatValues(mesh.Vertices), opts.Binary)
+    fmt.Fprintf(w, "      </Points>\n      <Cells>\n")
+    writeVTUArray(w, "Int32", "connectivity", 3, faceCount*3,
+        func(i int) float64 { return float64(mesh.vertexIndex(i)) },
+        opts.Binary)
+    writeVTUArray(w, "Int32", "offsets", 1, faceCount,
+        func(i int) float64 { return float64(i*3 + 3) }, opts.Binary)
+    // VTK_TRIANGLE
+    writeVTUArray(w, "UInt8", "types", 1, faceCount,
+        func(i int) float64 { return 5 }, opts.Binary)
+    fmt.Fprintf(w, "      </Cells>\n    </Piece>\n  </UnstructuredGrid>\n" +
+        "</VTKFile>\n")
+    return w.Flush()
+}
+
+// writeVTUArray writes a DataArray of n Float32, Int32 or UInt8 values
+// given by value.
+func writeVTUArray(w *bufio.Writer, dataType, name string, size, n int,
+    value func(i int) float64, binaryFormat bool) {
+    format := "ascii"
+    if binaryFormat { format = "binary" }
+    fmt.Fprintf(w, "        <DataArray type=\"%s\" Name=\"%s\" " +
+        "NumberOfComponents=\"%d\" format=\"%s\">\n", dataType,
+        xmlEscape(name), size, format)
+    if binaryFormat {
+        elemSize := 4
+        if dataType == "UInt8" { elemSize = 1 }
+        data := make([]byte, 4 + n*elemSize)
+        le := binary.LittleEndian
+        le.PutUint32(data, uint32(n*elemSize))
+        for i := 0; i < n; i++ {
+            switch dataType {
+            case "Float32":
+                le.PutUint32(data[4+i*4:], math.Float32bits(float32(value(i))))
+            case "Int32":
+                le.PutUint32(data[4+i*4:], uint32(int32(value(i))))
+            default:
+                data[4+i] = uint8(value(i))
+            }
+        }
+        w.WriteString("          ")
+        w.WriteString(base64.StdEncoding.EncodeToString(data))
+        w.WriteByte('\n')
+    } else {
+        for i := 0; i < n; i += size {
+            w.WriteString("          ")
+            for c := 0; c < size && i + c < n; c++ {
+                if c > 0 { w.WriteByte(' ') }
+                if dataType == "Float32" {
+                    w.WriteString(formatF32(float32(value(i+c)), -1))
+                } else {
+                    w.WriteString(strconv.FormatInt(int64(value(i+c)), 10))
+                }
+            }
+            w.WriteByte('\n')
+        }
+    }
+    fmt.Fprintf(w, "        </DataArray>\n")
+}
+
+// floatValues returns a value function for writeVTUArray.
+func floatValues(values []float32) func(i int) float64 {
+    return func(i int) float64 { return float64(values[i]) }
+}
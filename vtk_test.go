@@ -0,0 +1,169 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/xml"
+    "math"
+    "strings"
+    "testing"
+)
+
+func vtkTestMesh(t *testing.T) *TriangleMesh {
+    mesh, err := LoadOBJFrom(strings.NewReader(texplaneOBJ), true)
+    if err != nil { t.Fatal(err) }
+    mesh.Attributes = []*VertexAttribute{
+        &VertexAttribute{"mean curvature", 1, []float32{0.5, 1, 1.5, 2}}}
+    mesh.FaceAttributes = []*VertexAttribute{
+        &VertexAttribute{"error", 3, []float32{1, 2, 3, 4, 5, 6}},
+        &VertexAttribute{"thickness", 1, []float32{0.25, 0.75}}}
+    return &mesh.TriangleMesh
+}
+
+func TestWriteVTK(t *testing.T) {
+    t.Log("Testing: Legacy VTK Export (ASCII)")
+    mesh := vtkTestMesh(t)
+    var buf bytes.Buffer
+    if err := WriteVTK(&buf, mesh, nil); err != nil { t.Error(err); return }
+    out := buf.String()
+    for _, s := range []string{
+        "# vtk DataFile Version 3.0\ngo3dm\nASCII\nDATASET POLYDATA\n" +
+            "POINTS 4 float\n1.934122 -1.1881 1.448717\n",
+        "POLYGONS 2 8\n3 0 1 2\n3 3 0 2\n",
+        "POINT_DATA 4\nNORMALS Normals float\n0 0.7732 0.6341\n",
+        "TEXTURE_COORDINATES TCoords 2 float\n1 0\n1 1\n0 1\n0 0\n",
+        "SCALARS mean_curvature float 1\nLOOKUP_TABLE default\n" +
+            "0.5\n1\n1.5\n2\n",
+        "CELL_DATA 2\nSCALARS ObjectId int 1\nLOOKUP_TABLE default\n0\n0\n",
+        "VECTORS error float\n1 2 3\n4 5 6\n",
+        "SCALARS thickness float 1\nLOOKUP_TABLE default\n0.25\n0.75\n",
+    } {
+        if !strings.Contains(out, s) {
+            t.Errorf("Missing %q in:\n%s", s, out)
+            return
+        }
+    }
+
+    mesh.FaceAttributes[1].Values = mesh.FaceAttributes[1].Values[:1]
+    if err := WriteVTK(&buf, mesh, nil); err == nil {
+        t.Error("Short face attribute not detected")
+    }
+}
+
+func TestWriteVTKBinary(t *testing.T) {
+    t.Log("Testing: Legacy VTK Export (Binary)")
+    mesh := vtkTestMesh(t)
+    var buf bytes.Buffer
+    err := WriteVTK(&buf, mesh, &VTKWriteOptions{Binary: true})
+    if err != nil { t.Error(err); return }
+    data := buf.Bytes()
+    header := "BINARY\nDATASET POLYDATA\nPOINTS 4 float\n"
+    i := bytes.Index(data, []byte(header))
+    if i < 0 { t.Errorf("Missing header in:\n%q", data); return }
+    points := data[i+len(header):]
+    for v, expected := range mesh.Vertices {
+        value := math.Float32frombits(binary.BigEndian.Uint32(points[v*4:]))
+        if value != expected {
+            t.Errorf("Point value %d: expected %v, got %v", v, expected,
+                value)
+            return
+        }
+    }
+    polygons := points[len(mesh.Vertices)*4:]
+    if !bytes.HasPrefix(polygons, []byte("\nPOLYGONS 2 8\n")) {
+        t.Errorf("Unexpected data after points: %q", polygons)
+        return
+    }
+    polygons = polygons[len("\nPOLYGONS 2 8\n"):]
+    expected := []uint32{3, 0, 1, 2, 3, 3, 0, 2}
+    for j, v := range expected {
+        if binary.BigEndian.Uint32(polygons[j*4:]) != v {
+            t.Errorf("Unexpected polygon data: %v", polygons[:32])
+            return
+        }
+    }
+    if !bytes.Contains(data, []byte("\nCELL_DATA 2\nSCALARS ObjectId int 1\n" +
+        "LOOKUP_TABLE default\n\x00\x00\x00\x00\x00\x00\x00\x00\n")) {
+        t.Error("Missing object ids")
+    }
+}
+
+type vtuTestArray struct {
+    Type string `xml:"type,attr"`
+    Name string `xml:"Name,attr"`
+    Components int `xml:"NumberOfComponents,attr"`
+    Format string `xml:"format,attr"`
+    Data string `xml:",chardata"`
+}
+
+type vtuTestFile struct {
+    Piece struct {
+        Points int `xml:"NumberOfPoints,attr"`
+        Cells int `xml:"NumberOfCells,attr"`
+        PointData struct {
+            Normals string `xml:"Normals,attr"`
+            Arrays []vtuTestArray `xml:"DataArray"`
+        }
+        CellData struct {
+            Arrays []vtuTestArray `xml:"DataArray"`
+        }
+        PointArray vtuTestArray `xml:"Points>DataArray"`
+        CellArrays []vtuTestArray `xml:"Cells>DataArray"`
+    } `xml:"UnstructuredGrid>Piece"`
+}
+
+func TestWriteVTU(t *testing.T) {
+    t.Log("Testing: VTU Export")
+    mesh := vtkTestMesh(t)
+    for _, binaryFormat := range []bool{false, true} {
+        var buf bytes.Buffer
+        err := WriteVTU(&buf, mesh, &VTKWriteOptions{Binary: binaryFormat})
+        if err != nil { t.Error(err); return }
+        var doc vtuTestFile
+        if err = xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+            t.Error(err)
+            return
+        }
+        piece := doc.Piece
+        if piece.Points != 4 || piece.Cells != 2 ||
+            piece.PointData.Normals != "Normals" {
+            t.Errorf("Unexpected piece: %+v", piece)
+            return
+        }
+        names := make([]string, 0)
+        for _, a := range piece.PointData.Arrays {
+            names = append(names, a.Name)
+        }
+        for _, a := range piece.CellData.Arrays {
+            names = append(names, a.Name)
+        }
+        if strings.Join(names, ",") !=
+            "Normals,TCoords,mean_curvature,ObjectId,error,thickness" {
+            t.Errorf("Unexpected data arrays: %v", names)
+        }
+        if len(piece.CellArrays) != 3 { t.Error("Missing cell arrays"); return }
+        connectivity := piece.CellArrays[0]
+        if binaryFormat {
+            data, err := base64.StdEncoding.DecodeString(
+                strings.TrimSpace(connectivity.Data))
+            if err != nil { t.Error(err); return }
+            le := binary.LittleEndian
+            if le.Uint32(data) != 24 || le.Uint32(data[4+3*4:]) != 3 {
+                t.Errorf("Unexpected connectivity data: %v", data)
+            }
+            types := piece.CellArrays[2]
+            if types.Type != "UInt8" ||
+                strings.TrimSpace(types.Data) != "AgAAAAUF" {
+                t.Errorf("Unexpected cell types: %+v", types)
+            }
+        } else if strings.Join(strings.Fields(connectivity.Data), " ") !=
+            "0 1 2 3 0 2" {
+            t.Errorf("Unexpected connectivity: %s", connectivity.Data)
+        }
+        faceError := piece.CellData.Arrays[1]
+        if faceError.Components != 3 || faceError.Type != "Float32" {
+            t.Errorf("Unexpected face attribute array: %+v", faceError)
+        }
+    }
+}
@@ -5,47 +5,81 @@ import (
     "bufio"
     "strings"
     "strconv"
-    "os"
     "fmt"
     "path/filepath"
 )
 
+func init() {
+    RegisterFormat(&Format{Name: "obj", Extensions: []string{".obj"},
+        Sniff: sniffOBJ, Load: LoadOBJModel, Save: saveOBJ})
+}
+
+func sniffOBJ(header []byte) bool {
+    switch firstToken(header) {
+    case "v", "vt", "vn", "f", "o", "g", "s", "mtllib", "usemtl":
+        return true
+    }
+    return false
+}
+
 func LoadOBJ(objPath string, index bool) (*TriangleMesh,
     map[string]*Material, error) {
+    model, err := LoadOBJModel(objPath, &LoadOptions{Index: index})
+    if err != nil { return nil, nil, err }
+    return model.Mesh, model.Materials, nil
+}
+
+// LoadOBJModel loads an OBJ file and its material library according to
+// opts. A nil opts is equivalent to the zero LoadOptions. Compressed files
+// (see RegisterDecompressor) are decompressed transparently. If objPath
+// is a zip archive, the OBJ file inside it is loaded, and its material
+// library and textures are looked up in the archive.
+func LoadOBJModel(objPath string, opts *LoadOptions) (*Model, error) {
+    model, _, err := loadOBJModel(objPath, opts)
+    return model, err
+}
+
+// loadOBJModel implements LoadOBJModel, additionally returning the
+// absolute path of the material library, if any.
+func loadOBJModel(objPath string, opts *LoadOptions) (*Model, string,
+    error) {
+    if opts == nil { opts = &LoadOptions{} }
     objPath, err := filepath.Abs(objPath)
-    if err != nil { return nil, nil, err}
+    if err != nil { return nil, "", err }
+    if strings.EqualFold(filepath.Ext(objPath), ".zip") {
+        model, err := loadOBJZip(objPath, opts)
+        return model, "", err
+    }
     absDir := filepath.Dir(objPath)
     matMap := make(map[string]*Material)
-    objFile, err := os.Open(objPath)
-    if err != nil { return nil, nil, err}
+    mtlPath := ""
+    objFile, err := openFile(objPath)
+    if err != nil { return nil, "", err }
     defer objFile.Close()
-    objMesh, err := LoadOBJFrom(objFile, index)
-    if err != nil { return nil, nil, err}
+    objMesh, err := LoadOBJFrom(objFile, opts.Index)
+    if err != nil { return nil, "", err }
     if objMesh.MTLLib != "" {
-        mtlPath := objMesh.MTLLib
+        mtlPath = objMesh.MTLLib
         if !filepath.IsAbs(mtlPath) {
             mtlPath = filepath.Join(absDir, objMesh.MTLLib)
         }
         absMtlDir := filepath.Dir(mtlPath)
-        mtlFile, err := os.Open(mtlPath)
+        mtlFile, err := openFile(mtlPath)
         if err != nil {
-            return nil, nil, fmt.Errorf(
+            return nil, "", fmt.Errorf(
                 "Can't open mtllib: %s", objMesh.MTLLib)
         }
         defer mtlFile.Close()
         matList, err := LoadMTLFrom(mtlFile)
-        if err != nil { return nil, nil, err}
+        if err != nil { return nil, "", err }
         for _, mat := range matList {
             mat.Folder = absMtlDir
             matMap[mat.Name] = mat
         }
     }
-    return &objMesh.TriangleMesh, matMap, nil
-}
-
-func makeAbsPath(absMtlDir, path string) string {
-    if filepath.IsAbs(path) { return path }
-    return filepath.Join(absMtlDir, path)
+    model := &Model{Mesh: &objMesh.TriangleMesh, Materials: matMap}
+    processTextures(model, opts)
+    return model, mtlPath, nil
 }
 
 type OLState struct {
@@ -136,11 +170,11 @@ func LoadOBJFrom(reader io.Reader, index bool) (*OBJMesh, error) {
 
     return &OBJMesh{
             TriangleMesh{
-                verticesFA,
-                normalsFA,
-                texCoordsFA,
-                state.indicies,
-                state.meshObjects},
+                Vertices: verticesFA,
+                Normals: normalsFA,
+                TextureCoords: texCoordsFA,
+                VertexIndex: state.indicies,
+                Objects: state.meshObjects},
             mtllib}, nil
 }
 
@@ -193,6 +227,11 @@ func parseFaceIndicies(fidx string) (int, int, int, error) {
     if err != nil {return 0,0,0,err}
     vIdx = int(val)
     if len(parts) == 1 { return vIdx,0,0,nil }
+    if len(parts) == 2 {
+        val, err = strconv.ParseUint(parts[1], 10, 32)
+        if err != nil {return 0,0,0,err}
+        return vIdx, int(val), 0, nil
+    }
     if len(parts) != 3 { return 0,0,0,fmt.Errorf("Parse error: %s", fidx) }
     if len(parts[1]) < 1 {
         tIdx = 0
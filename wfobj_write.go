@@ -0,0 +1,187 @@
+package go3dm
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+func WriteMTL(writer io.Writer, materials []*Material) error {
+    return WriteMTLRelative(writer, materials, "")
+}
+
+// WriteMTLRelative writes materials in MTL format. If texDir is not empty,
+// texture paths are rewritten relative to texDir, which should be the
+// directory the MTL file is written to. Relative texture paths are
+// resolved against the material's Folder first. Ns and d are omitted if
+// 0, which means they weren't specified, and so are embedded textures,
+// which have no file to refer to.
+func WriteMTLRelative(writer io.Writer, materials []*Material,
+    texDir string) error {
+    w := bufio.NewWriter(writer)
+    for idx, mat := range materials {
+        if idx > 0 { fmt.Fprintln(w) }
+        fmt.Fprintf(w, "newmtl %s\n", mat.Name)
+        if mat.Ns != 0 { fmt.Fprintf(w, "Ns %s\n", formatF32(mat.Ns, -1)) }
+        writeMTLColor(w, "Ka", mat.Ka)
+        writeMTLColor(w, "Kd", mat.Kd)
+        writeMTLColor(w, "Ks", mat.Ks)
+        if mat.Tr != 0 { fmt.Fprintf(w, "d %s\n", formatF32(mat.Tr, -1)) }
+        for i, ref := range mat.textureMaps() {
+            if *ref == "" || isEmbeddedTexture(*ref) { continue }
+            fmt.Fprintf(w, "%s %s\n", textureMapNames[i],
+                relativeTexturePath(mat, *ref, texDir))
+        }
+    }
+    return w.Flush()
+}
+
+func writeMTLColor(w io.Writer, key string, c []float32) {
+    if len(c) < 3 { return }
+    fmt.Fprintf(w, "%s %s %s %s\n", key, formatF32(c[0], -1),
+        formatF32(c[1], -1), formatF32(c[2], -1))
+}
+
+// formatF32 formats v with the given number of decimal places, or with the
+// shortest representation that reads back exactly if precision is < 0.
+func formatF32(v float32, precision int) string {
+    return strconv.FormatFloat(float64(v), 'f', precision, 32)
+}
+
+func relativeTexturePath(mat *Material, path, texDir string) string {
+    if texDir == "" { return path }
+    if !filepath.IsAbs(path) {
+        if mat.Folder == "" { return path }
+        path = makeAbsPath(mat.Folder, normaliseTexturePath(path))
+    }
+    absDir, err := filepath.Abs(texDir)
+    if err != nil { return path }
+    rel, err := filepath.Rel(absDir, path)
+    if err != nil { return path }
+    return filepath.ToSlash(rel)
+}
+
+// OBJWriteOptions controls the output of WriteOBJ.
+type OBJWriteOptions struct {
+    // Material library referenced by an mtllib statement, if not empty
+    MTLLib string
+    // Decimal places of floats, 6 if 0, shortest exact form if negative
+    Precision int
+    // Emit g instead of o statements for mesh objects
+    Groups bool
+}
+
+// WriteOBJ writes mesh in Wavefront OBJ format. Identical positions,
+// texture coordinates and normals are written once and shared between
+// faces. Unnamed mesh objects are written as "go3dm". A nil opts is
+// equivalent to the zero OBJWriteOptions.
+func WriteOBJ(writer io.Writer, mesh *TriangleMesh,
+    opts *OBJWriteOptions) error {
+    if opts == nil { opts = &OBJWriteOptions{} }
+    precision := opts.Precision
+    if precision == 0 { precision = 6 }
+    vertexCount := len(mesh.Vertices) / 3
+    hasTex := len(mesh.TextureCoords) >= vertexCount*2 && vertexCount > 0
+    hasNormals := len(mesh.Normals) >= vertexCount*3 && vertexCount > 0
+    w := bufio.NewWriter(writer)
+    if opts.MTLLib != "" { fmt.Fprintf(w, "mtllib %s\n", opts.MTLLib) }
+
+    // Write unique values and map each mesh vertex to its OBJ indices
+    vIdx := writeOBJValues(w, "v", mesh.Vertices, 3, precision)
+    var tIdx, nIdx []int
+    if hasTex {
+        tIdx = writeOBJValues(w, "vt", mesh.TextureCoords, 2, precision)
+    }
+    if hasNormals {
+        nIdx = writeOBJValues(w, "vn", mesh.Normals, 3, precision)
+    }
+
+    faceVertex := func(i int) string {
+        v := i
+        if mesh.VertexIndex != nil { v = int(mesh.VertexIndex[i]) }
+        switch {
+        case hasTex && hasNormals:
+            return fmt.Sprintf("%d/%d/%d", vIdx[v], tIdx[v], nIdx[v])
+        case hasTex:
+            return fmt.Sprintf("%d/%d", vIdx[v], tIdx[v])
+        case hasNormals:
+            return fmt.Sprintf("%d//%d", vIdx[v], nIdx[v])
+        }
+        return strconv.Itoa(vIdx[v])
+    }
+    writeFaces := func(offset, count int) {
+        for i := offset; i + 2 < offset + count; i += 3 {
+            fmt.Fprintf(w, "f %s %s %s\n", faceVertex(i),
+                faceVertex(i+1), faceVertex(i+2))
+        }
+    }
+
+    keyword := "o"
+    if opts.Groups { keyword = "g" }
+    for _, mo := range mesh.objects() {
+        name := mo.Name
+        if name == "" { name = "go3dm" }
+        fmt.Fprintf(w, "%s %s\n", keyword, name)
+        if mo.MaterialRef != "" {
+            fmt.Fprintf(w, "usemtl %s\n", mo.MaterialRef)
+        }
+        if mo.Smooth {
+            fmt.Fprintln(w, "s 1")
+        } else {
+            fmt.Fprintln(w, "s off")
+        }
+        if mo.VertexOffset >= 0 {
+            writeFaces(int(mo.VertexOffset), int(mo.VertexCount))
+        }
+    }
+    return w.Flush()
+}
+
+// writeOBJValues writes each distinct vector of values as a statement of
+// the given type and returns the 1-based OBJ index of every vector.
+func writeOBJValues(w io.Writer, statement string, values []float32,
+    size, precision int) []int {
+    count := len(values) / size
+    indices := make([]int, count)
+    seen := make(map[string]int)
+    parts := make([]string, size)
+    for i := 0; i < count; i++ {
+        for j := 0; j < size; j++ {
+            parts[j] = formatF32(values[i*size+j], precision)
+        }
+        key := strings.Join(parts, " ")
+        idx, ok := seen[key]
+        if !ok {
+            idx = len(seen) + 1
+            seen[key] = idx
+            fmt.Fprintf(w, "%s %s\n", statement, key)
+        }
+        indices[i] = idx
+    }
+    return indices
+}
+
+// saveOBJ writes an OBJ file and, if there are materials, an MTL file
+// with the same base name next to it.
+func saveOBJ(path string, mesh *TriangleMesh, materials map[string]*Material,
+    opts *SaveOptions) error {
+    objOpts := &OBJWriteOptions{}
+    if len(materials) > 0 {
+        mtlPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".mtl"
+        objOpts.MTLLib = filepath.Base(mtlPath)
+        list := make([]*Material, 0, len(materials))
+        for _, name := range sortedMaterialNames(materials) {
+            list = append(list, materials[name])
+        }
+        err := writeFile(mtlPath, func(w io.Writer) error {
+            return WriteMTLRelative(w, list, filepath.Dir(mtlPath))
+        })
+        if err != nil { return err }
+    }
+    return writeFile(path, func(w io.Writer) error {
+        return WriteOBJ(w, mesh, objOpts)
+    })
+}
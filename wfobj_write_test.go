@@ -0,0 +1,156 @@
+package go3dm
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestWriteMTLRoundTrip(t *testing.T) {
+    mtlFiles, err := filepath.Glob("test-meshes/*.mtl")
+    if err != nil { t.Error(err); return }
+    for _, mtlFile := range mtlFiles {
+        t.Log("Testing: MTL Round Trip " + mtlFile)
+        f, err := os.Open(mtlFile)
+        if err != nil { t.Error(err); return }
+        materials, err := LoadMTLFrom(f)
+        f.Close()
+        if err != nil { t.Error(err); return }
+        var buf bytes.Buffer
+        if err = WriteMTL(&buf, materials); err != nil {
+            t.Error(err)
+            return
+        }
+        reloaded, err := LoadMTLFrom(&buf)
+        if err != nil { t.Error(err); return }
+        matMap := make(map[string]*Material)
+        for _, m := range reloaded { matMap[m.Name] = m }
+        checkMaterials(t, matMap, materials)
+    }
+}
+
+func TestWriteMTLRelative(t *testing.T) {
+    t.Log("Testing: MTL Relative Texture Paths")
+    base, err := filepath.Abs("test-meshes")
+    if err != nil { t.Error(err); return }
+    materials := []*Material{
+        &Material{Name: "a", Folder: base, KdMap: "textures/a.png",
+            KaMap: filepath.Join(base, "b.png")},
+    }
+    var buf bytes.Buffer
+    err = WriteMTLRelative(&buf, materials, filepath.Join(base, "out"))
+    if err != nil { t.Error(err); return }
+    out := buf.String()
+    if !strings.Contains(out, "map_Kd ../textures/a.png\n") ||
+        !strings.Contains(out, "map_Ka ../b.png\n") {
+        t.Errorf("Unexpected texture paths:\n%s", out)
+    }
+}
+
+func TestWriteMTLUnspecified(t *testing.T) {
+    t.Log("Testing: MTL Unspecified Values")
+    materials := []*Material{&Material{Name: "m", Kd: []float32{1, 0, 0},
+        KdMap: embeddedTexturePrefix + "image0"}}
+    var buf bytes.Buffer
+    if err := WriteMTL(&buf, materials); err != nil { t.Error(err); return }
+    out := buf.String()
+    if strings.Contains(out, "\nd ") || strings.Contains(out, "\nNs ") ||
+        strings.Contains(out, "map_Kd") {
+        t.Errorf("Unexpected output:\n%s", out)
+    }
+    materials[0].Tr = 0.5
+    buf.Reset()
+    if err := WriteMTL(&buf, materials); err != nil { t.Error(err); return }
+    if !strings.Contains(buf.String(), "\nd 0.5\n") {
+        t.Errorf("Missing dissolve:\n%s", buf.String())
+    }
+}
+
+func TestWriteOBJRoundTrip(t *testing.T) {
+    sources := map[string]string{
+        "square": squareOBJ,
+        "cubes": cubesOBJ,
+        "texplane": texplaneOBJ,
+    }
+    for name, src := range sources {
+        for _, index := range []bool{false, true} {
+            t.Logf("Testing: OBJ Round Trip %s (indexed: %t)", name, index)
+            mesh, err := LoadOBJFrom(strings.NewReader(src), index)
+            if err != nil { t.Error(err); return }
+            var buf bytes.Buffer
+            err = WriteOBJ(&buf, &mesh.TriangleMesh,
+                &OBJWriteOptions{MTLLib: name + ".mtl"})
+            if err != nil { t.Error(err); return }
+            reloaded, err := LoadOBJFrom(&buf, index)
+            if err != nil { t.Error(err); return }
+            if reloaded.MTLLib != name + ".mtl" {
+                t.Errorf("Unexpected mtllib: %s", reloaded.MTLLib)
+            }
+            checkMesh(t, &reloaded.TriangleMesh,
+                mesh.Vertices,
+                mesh.TextureCoords,
+                mesh.Normals,
+                mesh.VertexIndex,
+                mesh.Objects)
+        }
+    }
+}
+
+func TestWriteOBJShared(t *testing.T) {
+    t.Log("Testing: OBJ Shared Values")
+    mesh, err := LoadOBJFrom(strings.NewReader(texplaneOBJ), false)
+    if err != nil { t.Error(err); return }
+    mesh.Normals = nil
+    var buf bytes.Buffer
+    err = WriteOBJ(&buf, &mesh.TriangleMesh,
+        &OBJWriteOptions{Precision: 2, Groups: true})
+    if err != nil { t.Error(err); return }
+    out := buf.String()
+    lines := "\n" + out
+    if strings.Count(lines, "\nv ") + strings.Count(lines, "\nvt ") != 8 ||
+        strings.Contains(out, "vn ") {
+        t.Errorf("Values not shared:\n%s", out)
+    }
+    if !strings.Contains(out, "g Plane\n") ||
+        !strings.Contains(out, "v -1.93 -1.19 1.45\n") ||
+        !strings.Contains(out, "f 1/1 2/2 3/3\n") {
+        t.Errorf("Unexpected output:\n%s", out)
+    }
+    reloaded, err := LoadOBJFrom(strings.NewReader(out), false)
+    if err != nil { t.Error(err); return }
+    if len(reloaded.TextureCoords) != len(mesh.TextureCoords) {
+        t.Error("Texture coordinates not reloaded")
+    }
+}
+
+func TestWriteOBJDefaultObject(t *testing.T) {
+    t.Log("Testing: OBJ Default and Unnamed Objects")
+    mesh := &TriangleMesh{Vertices: []float32{0, 0, 0, 1, 0, 0, 0, 1, 0}}
+    var buf bytes.Buffer
+    if err := WriteOBJ(&buf, mesh, nil); err != nil { t.Error(err); return }
+    if !strings.Contains(buf.String(), "o go3dm\n") ||
+        !strings.Contains(buf.String(), "f 1 2 3\n") {
+        t.Errorf("Unexpected output:\n%s", buf.String())
+    }
+
+    // Point clouds have no faces
+    mesh.Points = true
+    buf.Reset()
+    if err := WriteOBJ(&buf, mesh, nil); err != nil { t.Error(err); return }
+    if strings.Contains(buf.String(), "f ") {
+        t.Errorf("Unexpected point cloud faces:\n%s", buf.String())
+    }
+
+    // Unnamed objects reload
+    mesh.Points = false
+    mesh.Objects = []*MeshObject{&MeshObject{"", 0, 3, "", false}}
+    buf.Reset()
+    if err := WriteOBJ(&buf, mesh, nil); err != nil { t.Error(err); return }
+    reloaded, err := LoadOBJFrom(&buf, false)
+    if err != nil { t.Error(err); return }
+    if len(reloaded.Objects) != 1 || reloaded.Objects[0].VertexCount != 3 {
+        t.Errorf("Unexpected objects %v", reloaded.Objects)
+    }
+}
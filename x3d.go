@@ -0,0 +1,314 @@
+package go3dm
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "math"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+func init() {
+    RegisterFormat(&Format{Name: "x3d", Extensions: []string{".x3d"},
+        Save: func(path string, mesh *TriangleMesh,
+            materials map[string]*Material, opts *SaveOptions) error {
+            x3dOpts := &X3DWriteOptions{TextureDir: filepath.Dir(path)}
+            return writeFile(path, func(w io.Writer) error {
+                return WriteX3D(w, mesh, materials, x3dOpts)
+            })
+        },
+    })
+    RegisterFormat(&Format{Name: "vrml", Extensions: []string{".wrl"},
+        Save: func(path string, mesh *TriangleMesh,
+            materials map[string]*Material, opts *SaveOptions) error {
+            x3dOpts := &X3DWriteOptions{TextureDir: filepath.Dir(path)}
+            return writeFile(path, func(w io.Writer) error {
+                return WriteVRML(w, mesh, materials, x3dOpts)
+            })
+        },
+    })
+}
+
+// X3DWriteOptions controls the output of WriteX3D and WriteVRML.
+type X3DWriteOptions struct {
+    // Directory texture URLs are made relative to, usually the directory
+    // the file is written to
+    TextureDir string
+}
+
+// WriteX3D writes mesh as an X3D XML scene with an IndexedFaceSet shape
+// per mesh object. Vertex data is written once and shared between shapes
+// with DEF/USE, as are the appearances derived from materials. Diffuse
+// texture maps become ImageTexture nodes, embedded textures are left
+// out. A nil opts is equivalent to the zero X3DWriteOptions.
+func WriteX3D(writer io.Writer, mesh *TriangleMesh,
+    materials map[string]*Material, opts *X3DWriteOptions) error {
+    w := bufio.NewWriter(writer)
+    fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+        "<!DOCTYPE X3D PUBLIC \"ISO//Web3D//DTD X3D 3.3//EN\" " +
+        "\"http://www.web3d.org/specifications/x3d-3.3.dtd\">\n" +
+        "<X3D profile=\"Interchange\" version=\"3.3\">\n" +
+        " <head>\n  <meta name=\"generator\" content=\"go3dm\"/>\n" +
+        " </head>\n <Scene>\n")
+    e := &x3dEncoder{w: w, xml: true, depth: 2}
+    writeX3DScene(e, mesh, materials, opts)
+    fmt.Fprintf(w, " </Scene>\n</X3D>\n")
+    return w.Flush()
+}
+
+// WriteVRML writes mesh as a VRML97 scene. See WriteX3D.
+func WriteVRML(writer io.Writer, mesh *TriangleMesh,
+    materials map[string]*Material, opts *X3DWriteOptions) error {
+    w := bufio.NewWriter(writer)
+    fmt.Fprintf(w, "#VRML V2.0 utf8\n# written by go3dm\n\n")
+    e := &x3dEncoder{w: w}
+    writeX3DScene(e, mesh, materials, opts)
+    return w.Flush()
+}
+
+func writeX3DScene(e *x3dEncoder, mesh *TriangleMesh,
+    materials map[string]*Material, opts *X3DWriteOptions) {
+    if opts == nil { opts = &X3DWriteOptions{} }
+    objects := mesh.objects()
+    vertexCount := len(mesh.Vertices) / 3
+    hasNormals := len(mesh.Normals) >= vertexCount*3
+    hasColors := len(mesh.Colors) >= vertexCount*4
+    hasTexCoords := len(mesh.TextureCoords) >= vertexCount*2
+    names := make(map[string]bool)
+    appearances := make(map[string]string)
+    defined := false
+    for _, mo := range objects {
+        if mo.VertexOffset < 0 || mo.VertexCount < 3 { continue }
+        e.begin("Shape", x3dUniqueName(mo.Name, names), "")
+        if mat, ok := materials[mo.MaterialRef]; ok {
+            if def, ok := appearances[mo.MaterialRef]; ok {
+                e.use("Appearance", def, "appearance")
+            } else {
+                def = x3dUniqueName(mat.Name, names)
+                appearances[mo.MaterialRef] = def
+                writeX3DAppearance(e, mat, def, opts)
+            }
+        }
+
+        e.begin("IndexedFaceSet", "", "geometry")
+        e.boolField("solid", false)
+        if !hasNormals && mo.Smooth { e.field("creaseAngle", "3.14159") }
+        start := int(mo.VertexOffset)
+        index := make([]string, 0, mo.VertexCount / 3)
+        for i := start; i + 2 < start + int(mo.VertexCount); i += 3 {
+            index = append(index, fmt.Sprintf("%d %d %d -1",
+                mesh.vertexIndex(i), mesh.vertexIndex(i+1),
+                mesh.vertexIndex(i+2)))
+        }
+        e.array("coordIndex", index)
+        if defined {
+            e.use("Coordinate", "go3dm_coords", "coord")
+            if hasNormals { e.use("Normal", "go3dm_normals", "normal") }
+            if hasColors { e.use("Color", "go3dm_colors", "color") }
+            if hasTexCoords {
+                e.use("TextureCoordinate", "go3dm_texcoords", "texCoord")
+            }
+        } else {
+            e.values("Coordinate", "go3dm_coords", "coord", "point",
+                mesh.Vertices, 3, 3)
+            if hasNormals {
+                e.values("Normal", "go3dm_normals", "normal", "vector",
+                    mesh.Normals, 3, 3)
+            }
+            if hasColors {
+                e.values("Color", "go3dm_colors", "color", "color",
+                    mesh.Colors, 4, 3)
+            }
+            if hasTexCoords {
+                e.values("TextureCoordinate", "go3dm_texcoords", "texCoord",
+                    "point", mesh.TextureCoords, 2, 2)
+            }
+            defined = true
+        }
+        e.end()
+        e.end()
+    }
+}
+
+// writeX3DAppearance converts a Phong material. The specular exponent is
+// scaled to shininess (exponent / 128) and the dissolve value inverted
+// to transparency.
+func writeX3DAppearance(e *x3dEncoder, mat *Material, def string,
+    opts *X3DWriteOptions) {
+    e.begin("Appearance", def, "appearance")
+    e.begin("Material", "", "material")
+    if len(mat.Kd) >= 3 { e.field("diffuseColor", x3dFloats(mat.Kd[:3])) }
+    if len(mat.Ks) >= 3 { e.field("specularColor", x3dFloats(mat.Ks[:3])) }
+    if len(mat.Ka) >= 3 {
+        ambient := (mat.Ka[0] + mat.Ka[1] + mat.Ka[2]) / 3
+        e.field("ambientIntensity", formatF32(clampUnit(ambient), -1))
+    }
+    shininess := float32(math.Max(float64(mat.Ns), 0) / 128)
+    e.field("shininess", formatF32(clampUnit(shininess), -1))
+    if opacity, translucent := materialOpacity(mat); translucent {
+        e.field("transparency", formatF32(1 - opacity, -1))
+    }
+    e.end()
+    if mat.KdMap != "" && !isEmbeddedTexture(mat.KdMap) {
+        e.begin("ImageTexture", "", "texture")
+        e.stringField("url", filepath.ToSlash(relativeTexturePath(mat,
+            mat.KdMap, opts.TextureDir)))
+        e.end()
+    }
+    e.end()
+}
+
+func clampUnit(v float32) float32 {
+    if v < 0 { return 0 }
+    if v > 1 { return 1 }
+    return v
+}
+
+func x3dFloats(values []float32) string {
+    s := make([]string, len(values))
+    for i, v := range values { s[i] = formatF32(v, -1) }
+    return strings.Join(s, " ")
+}
+
+// x3dUniqueName turns name into a DEF name that isn't in names yet and
+// adds it.
+func x3dUniqueName(name string, names map[string]bool) string {
+    b := []byte(name)
+    for i, c := range b {
+        if c <= ' ' || c >= 0x7f || strings.IndexByte("\"#'+,.[\\]{}&<>",
+            c) >= 0 {
+            b[i] = '_'
+        }
+    }
+    name = string(b)
+    if name == "" || name[0] >= '0' && name[0] <= '9' || name[0] == '-' {
+        name = "_" + name
+    }
+    unique := name
+    for i := 2; names[unique]; i++ {
+        unique = name + "_" + strconv.Itoa(i)
+    }
+    names[unique] = true
+    return unique
+}
+
+// x3dEncoder writes nodes in X3D XML or classic VRML syntax. In XML,
+// fields are written as attributes and must precede child nodes.
+type x3dEncoder struct {
+    w *bufio.Writer
+    xml bool
+    depth int
+    // Nodes begun, and whether the XML start tag is still open
+    nodes []string
+    open bool
+}
+
+func (e *x3dEncoder) indent() {
+    e.w.WriteString(strings.Repeat(" ", e.depth))
+}
+
+// closeTag finishes an open XML start tag before a child node.
+func (e *x3dEncoder) closeTag() {
+    if e.xml && e.open {
+        e.w.WriteString(">\n")
+        e.open = false
+    }
+}
+
+// begin starts a node, named def if not empty, in the given field of the
+// parent node (containerField in XML).
+func (e *x3dEncoder) begin(node, def, field string) {
+    e.closeTag()
+    e.indent()
+    if e.xml {
+        e.w.WriteString("<" + node)
+        if def != "" { e.w.WriteString(" DEF=\"" + xmlEscape(def) + "\"") }
+        e.open = true
+    } else {
+        if field != "" { e.w.WriteString(field + " ") }
+        if def != "" { e.w.WriteString("DEF " + def + " ") }
+        e.w.WriteString(node + " {\n")
+    }
+    e.nodes = append(e.nodes, node)
+    e.depth++
+}
+
+func (e *x3dEncoder) end() {
+    node := e.nodes[len(e.nodes)-1]
+    e.nodes = e.nodes[:len(e.nodes)-1]
+    e.depth--
+    if e.xml && e.open {
+        e.w.WriteString("/>\n")
+        e.open = false
+        return
+    }
+    e.indent()
+    if e.xml {
+        e.w.WriteString("</" + node + ">\n")
+    } else {
+        e.w.WriteString("}\n")
+    }
+}
+
+// use references a node defined earlier.
+func (e *x3dEncoder) use(node, def, field string) {
+    e.closeTag()
+    e.indent()
+    if e.xml {
+        fmt.Fprintf(e.w, "<%s USE=\"%s\"/>\n", node, xmlEscape(def))
+    } else {
+        fmt.Fprintf(e.w, "%s USE %s\n", field, def)
+    }
+}
+
+// field writes a field whose value is the same in both syntaxes.
+func (e *x3dEncoder) field(name, value string) {
+    if e.xml {
+        fmt.Fprintf(e.w, " %s=\"%s\"", name, value)
+    } else {
+        e.indent()
+        fmt.Fprintf(e.w, "%s %s\n", name, value)
+    }
+}
+
+func (e *x3dEncoder) boolField(name string, value bool) {
+    if e.xml {
+        e.field(name, strconv.FormatBool(value))
+    } else {
+        e.field(name, strings.ToUpper(strconv.FormatBool(value)))
+    }
+}
+
+func (e *x3dEncoder) stringField(name, value string) {
+    if e.xml {
+        fmt.Fprintf(e.w, " %s='\"%s\"'", name, xmlEscape(value))
+    } else {
+        value = strings.Replace(value, "\\", "\\\\", -1)
+        value = strings.Replace(value, "\"", "\\\"", -1)
+        e.field(name, "\""+value+"\"")
+    }
+}
+
+// array writes a multiple-valued field.
+func (e *x3dEncoder) array(name string, items []string) {
+    if e.xml {
+        e.field(name, strings.Join(items, ", "))
+    } else {
+        e.field(name, "[ "+strings.Join(items, ", ")+" ]")
+    }
+}
+
+// values writes a node holding an array field, taking the first n of
+// every stride values.
+func (e *x3dEncoder) values(node, def, field, name string, values []float32,
+    stride, n int) {
+    e.begin(node, def, field)
+    tuples := make([]string, 0, len(values) / stride)
+    for i := 0; i + stride <= len(values); i += stride {
+        tuples = append(tuples, x3dFloats(values[i:i+n]))
+    }
+    e.array(name, tuples)
+    e.end()
+}
@@ -0,0 +1,107 @@
+package go3dm
+
+import (
+    "bytes"
+    "encoding/xml"
+    "strings"
+    "testing"
+)
+
+func TestWriteX3D(t *testing.T) {
+    t.Log("Testing: X3D Export")
+    mesh, materials, err := LoadOBJ("test-meshes/cubes.obj", true)
+    if err != nil { t.Error(err); return }
+    var buf bytes.Buffer
+    if err = WriteX3D(&buf, mesh, materials, nil); err != nil {
+        t.Error(err)
+        return
+    }
+    var doc struct {
+        Shapes []struct {
+            DEF string `xml:"DEF,attr"`
+            Appearance struct {
+                DEF string `xml:"DEF,attr"`
+                USE string `xml:"USE,attr"`
+                Material struct {
+                    DiffuseColor string `xml:"diffuseColor,attr"`
+                }
+            }
+            Faces struct {
+                CoordIndex string `xml:"coordIndex,attr"`
+                Coordinate struct {
+                    DEF string `xml:"DEF,attr"`
+                    USE string `xml:"USE,attr"`
+                    Point string `xml:"point,attr"`
+                }
+                Normal struct {
+                    USE string `xml:"USE,attr"`
+                    Vector string `xml:"vector,attr"`
+                }
+            } `xml:"IndexedFaceSet"`
+        } `xml:"Scene>Shape"`
+    }
+    if err = xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+        t.Error(err)
+        return
+    }
+    if len(doc.Shapes) != len(mesh.Objects) {
+        t.Errorf("Expected %d shapes, got %d", len(mesh.Objects),
+            len(doc.Shapes))
+        return
+    }
+    first, second := doc.Shapes[0], doc.Shapes[1]
+    if first.DEF != mesh.Objects[0].Name ||
+        first.Faces.Coordinate.DEF == "" ||
+        second.Faces.Coordinate.USE != first.Faces.Coordinate.DEF ||
+        second.Faces.Normal.USE == "" {
+        t.Error("Vertex data not shared between shapes")
+    }
+    points := strings.Split(first.Faces.Coordinate.Point, ",")
+    if len(points) != len(mesh.Vertices) / 3 {
+        t.Errorf("Expected %d points, got %d", len(mesh.Vertices) / 3,
+            len(points))
+    }
+    faces := strings.Split(first.Faces.CoordIndex, ",")
+    if len(faces) != int(mesh.Objects[0].VertexCount) / 3 ||
+        !strings.HasSuffix(faces[0], " -1") {
+        t.Errorf("Unexpected coordIndex: %s", first.Faces.CoordIndex)
+    }
+    mat := materials[mesh.Objects[0].MaterialRef]
+    // DEF names are shared with the shapes, which are named alike
+    if first.Appearance.DEF != mat.Name + "_2" ||
+        first.Appearance.Material.DiffuseColor != x3dFloats(mat.Kd) {
+        t.Error("Unexpected appearance")
+    }
+}
+
+func TestWriteVRML(t *testing.T) {
+    t.Log("Testing: VRML97 Export")
+    mesh, err := LoadOBJFrom(strings.NewReader(texplaneOBJ), true)
+    if err != nil { t.Error(err); return }
+    materials := map[string]*Material{"Material": &Material{Name: "Material",
+        Kd: []float32{1, 0.5, 0}, Tr: 0.25, KdMap: "tex \"1\".png"}}
+    var buf bytes.Buffer
+    err = WriteVRML(&buf, &mesh.TriangleMesh, materials, nil)
+    if err != nil { t.Error(err); return }
+    out := buf.String()
+    for _, s := range []string{
+        "#VRML V2.0 utf8\n",
+        "DEF Plane Shape {",
+        "appearance DEF Material Appearance {",
+        "diffuseColor 1 0.5 0\n",
+        "transparency 0.75\n",
+        "url \"tex \\\"1\\\".png\"\n",
+        "solid FALSE\n",
+        "coordIndex [ 0 1 2 -1, 3 0 2 -1 ]\n",
+        "coord DEF go3dm_coords Coordinate {",
+        "texCoord DEF go3dm_texcoords TextureCoordinate {",
+    } {
+        if !strings.Contains(out, s) {
+            t.Errorf("Missing %q in:\n%s", s, out)
+            return
+        }
+    }
+    if strings.Count(out, "{") != strings.Count(out, "}") {
+        t.Error("Unbalanced braces")
+    }
+}